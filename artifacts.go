@@ -0,0 +1,157 @@
+package tstr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const ErrCollectArtifacts = strerr.Error("failed to collect artifacts")
+
+// ArtifactsMode controls when artifacts are written.
+type ArtifactsMode int
+
+const (
+	// ArtifactsOnFailure writes artifacts only when starting dependencies, the test or stopping dependencies fails.
+	ArtifactsOnFailure ArtifactsMode = iota
+	// ArtifactsAlways writes artifacts after every run.
+	ArtifactsAlways
+)
+
+// ArtifactCollector is implemented by dependencies that can write post-mortem material, such as logs, into a directory.
+// CollectArtifacts is called after the test function has finished but before the dependency is stopped.
+type ArtifactCollector interface {
+	CollectArtifacts(dir string) error
+}
+
+// WithArtifacts enables writing artifacts into dir.
+// The artifacts are laid out per run, not per test, since the dependencies are shared by all tests of the run.
+// Each run, for example a test binary using RunMain, writes into its own directory named after the tester, see WithName,
+// with a -<n> suffix if the directory already exists.
+// The run directory contains timeline.json with the Runner timeline, error.txt with the returned error on failure
+// and deps/<index>-<dependency> directory for each started dependency that implements ArtifactCollector.
+func WithArtifacts(dir string, mode ArtifactsMode) Opt {
+	return func(t *Tester) error {
+		t.artifactsDir = dir
+		t.artifactsMode = mode
+		return nil
+	}
+}
+
+// WithName sets the name of the tester which is used for example as the artifacts directory name.
+// By default the name of the test binary without the .test suffix is used.
+func WithName(name string) Opt {
+	return func(t *Tester) error {
+		t.name = name
+		return nil
+	}
+}
+
+type artifacts struct {
+	root string
+	name string
+	mode ArtifactsMode
+	dir  string
+}
+
+func (t *Tester) artifacts() *artifacts {
+	if t.artifactsDir == "" {
+		return nil
+	}
+	return &artifacts{
+		root: t.artifactsDir,
+		name: sanitizeName(t.testerName()),
+		mode: t.artifactsMode,
+	}
+}
+
+// collect writes the artifacts of all started dependencies.
+func (a *artifacts) collect(r *Runner, failed bool) error {
+	if a == nil || (a.mode != ArtifactsAlways && !failed) {
+		return nil
+	}
+
+	var err error
+	for i, d := range r.started() {
+		c, ok := d.(ArtifactCollector)
+		if !ok {
+			continue
+		}
+		dir, dErr := a.mkdir("deps", fmt.Sprintf("%02d-%s", i, sanitizeName(dependencyName(d))))
+		if dErr == nil {
+			dErr = c.CollectArtifacts(dir)
+		}
+		if dErr != nil {
+			err = errors.Join(err, fmt.Errorf("%w: dependency %d: %w", ErrCollectArtifacts, i, dErr))
+		}
+	}
+	return err
+}
+
+// finish writes the timeline and the final error of the run.
+func (a *artifacts) finish(r *Runner, runErr error) error {
+	if a == nil || (a.dir == "" && a.mode != ArtifactsAlways && runErr == nil) {
+		return nil
+	}
+
+	dir, err := a.mkdir()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCollectArtifacts, err)
+	}
+
+	timeline, err := json.MarshalIndent(r.Timeline(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCollectArtifacts, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "timeline.json"), timeline, 0o600); err != nil {
+		return fmt.Errorf("%w: %w", ErrCollectArtifacts, err)
+	}
+
+	if runErr != nil {
+		if err := os.WriteFile(filepath.Join(dir, "error.txt"), []byte(runErr.Error()+"\n"), 0o600); err != nil {
+			return fmt.Errorf("%w: %w", ErrCollectArtifacts, err)
+		}
+	}
+	return nil
+}
+
+// mkdir creates the run directory on first call and the given sub directory inside it.
+func (a *artifacts) mkdir(elem ...string) (string, error) {
+	if a.dir == "" {
+		if err := os.MkdirAll(a.root, 0o750); err != nil {
+			return "", err
+		}
+		dir := filepath.Join(a.root, a.name)
+		for i := 2; ; i++ {
+			err := os.Mkdir(dir, 0o750)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, os.ErrExist) {
+				return "", err
+			}
+			dir = filepath.Join(a.root, a.name+"-"+strconv.Itoa(i))
+		}
+		a.dir = dir
+	}
+
+	dir := filepath.Join(append([]string{a.dir}, elem...)...)
+	return dir, os.MkdirAll(dir, 0o750)
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func sanitizeName(name string) string {
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "_"), "_.")
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
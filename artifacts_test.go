@@ -0,0 +1,147 @@
+package tstr_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithArtifacts(t *testing.T) {
+	testErr := errors.New("test failed")
+	tests := []struct {
+		name     string
+		mode     tstr.ArtifactsMode
+		code     int
+		stopErr  error
+		expected []string
+	}{
+		{
+			name: "OnFailure_Success",
+			mode: tstr.ArtifactsOnFailure,
+		},
+		{
+			name:     "OnFailure_TestFailure",
+			mode:     tstr.ArtifactsOnFailure,
+			code:     1,
+			expected: []string{"deps/00-tstr_test.collector/artifact.txt", "error.txt", "timeline.json"},
+		},
+		{
+			name:     "OnFailure_StopFailure",
+			mode:     tstr.ArtifactsOnFailure,
+			stopErr:  testErr,
+			expected: []string{"error.txt", "timeline.json"},
+		},
+		{
+			name:     "Always_Success",
+			mode:     tstr.ArtifactsAlways,
+			expected: []string{"deps/00-tstr_test.collector/artifact.txt", "timeline.json"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			tester := tstr.NewTester(
+				tstr.WithName(tt.name),
+				tstr.WithArtifacts(dir, tt.mode),
+				tstr.WithDeps(
+					&collector{DepFn: depfn.New(nil, nil, func() error { return tt.stopErr })},
+					depfn.New(nil, nil, nil),
+				),
+				tstr.WithM(exitCode(tt.code)),
+			)
+			require.NoError(t, tester.Init())
+			_ = tester.Run()
+
+			assert.Equal(t, tt.expected, listFiles(t, filepath.Join(dir, tt.name)))
+		})
+	}
+}
+
+func TestWithArtifacts_Timeline(t *testing.T) {
+	dir := t.TempDir()
+	err := tstr.Run(
+		tstr.WithName("timeline"),
+		tstr.WithArtifacts(dir, tstr.ArtifactsAlways),
+		tstr.WithDeps(depfn.New(nil, nil, nil)),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "timeline", "timeline.json"))
+	require.NoError(t, err)
+
+	var events []tstr.Event
+	require.NoError(t, json.Unmarshal(b, &events))
+	require.Len(t, events, 3)
+	for i, phase := range []tstr.Phase{tstr.PhaseStart, tstr.PhaseReady, tstr.PhaseStop} {
+		assert.Equal(t, phase, events[i].Phase)
+		assert.Equal(t, "depfn.DepFn", events[i].Dependency)
+	}
+}
+
+func TestWithArtifacts_RunDirPerRun(t *testing.T) {
+	dir := t.TempDir()
+	for range 2 {
+		err := tstr.Run(
+			tstr.WithName("repeated"),
+			tstr.WithArtifacts(dir, tstr.ArtifactsAlways),
+			tstr.WithFn(func() {}),
+		)
+		require.NoError(t, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "repeated", entries[0].Name())
+	assert.Equal(t, "repeated-2", entries[1].Name())
+}
+
+func TestWithArtifacts_CollectError(t *testing.T) {
+	err := tstr.Run(
+		tstr.WithArtifacts(t.TempDir(), tstr.ArtifactsAlways),
+		tstr.WithDeps(&collector{err: errors.New("collect failed")}),
+		tstr.WithFn(func() {}),
+	)
+	assert.ErrorIs(t, err, tstr.ErrCollectArtifacts)
+}
+
+type exitCode int
+
+func (c exitCode) Run() int { return int(c) }
+
+type collector struct {
+	depfn.DepFn
+	err error
+}
+
+func (c *collector) CollectArtifacts(dir string) error {
+	if c.err != nil {
+		return c.err
+	}
+	return os.WriteFile(filepath.Join(dir, "artifact.txt"), []byte("artifact"), 0o600)
+}
+
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if !errors.Is(err, os.ErrNotExist) {
+		require.NoError(t, err)
+	}
+	return files
+}
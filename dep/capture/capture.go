@@ -0,0 +1,419 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply        = strerr.Error("failed to apply Opt")
+	ErrMissingUpstream = strerr.Error("missing upstream URL")
+	ErrBadUpstream     = strerr.Error("bad upstream URL")
+	ErrTimeout         = strerr.Error("no matching exchange captured")
+)
+
+// Proxy is a reverse proxy which captures the HTTP exchanges with the upstream, typically the service under test.
+// Request and response bodies are buffered, so streaming responses are delivered only after they are complete.
+type Proxy struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+	upstream   string
+	target     *url.URL
+	outputs    expand.Values
+	transport  http.RoundTripper
+
+	mu        sync.Mutex
+	exchanges []Exchange
+	notify    chan struct{}
+}
+
+// Exchange is a captured request and its response.
+type Exchange struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Timings  Timings       `json:"timings"`
+	Request  Request       `json:"request"`
+	Response Response      `json:"response"`
+	// Error is set if the upstream couldn't be reached, in which case the client got 502 Bad Gateway.
+	Error string `json:"error,omitempty"`
+}
+
+// Timings split the duration of an exchange into phases.
+type Timings struct {
+	// Send is the time to connect and send the request.
+	Send time.Duration `json:"send"`
+	// Wait is the time from sending the request to the first byte of the response.
+	Wait time.Duration `json:"wait"`
+	// Receive is the time to read the response.
+	Receive time.Duration `json:"receive"`
+}
+
+// Request is a captured request. URL is the URL of the upstream request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    *url.URL    `json:"url"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Response is a captured response.
+type Response struct {
+	Status int         `json:"status"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Predicate selects exchanges, see Proxy.Exchanges.
+type Predicate func(Exchange) bool
+
+type Opt func(*Proxy) error
+
+// New creates new Proxy dependency.
+func New(opts ...Opt) *Proxy {
+	return &Proxy{opts: opts}
+}
+
+func (p *Proxy) Start() error {
+	p.serverOpts, p.upstream, p.transport = nil, "", nil
+	p.exchanges, p.notify = nil, make(chan struct{})
+	for _, opt := range p.opts {
+		if err := opt(p); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if p.upstream == "" {
+		return ErrMissingUpstream
+	}
+	upstream, err := expand.String(p.upstream, p.outputs)
+	if err != nil {
+		return err
+	}
+	p.target, err = url.Parse(upstream)
+	if err != nil || p.target.Scheme == "" || p.target.Host == "" {
+		return fmt.Errorf("%w: '%s'", ErrBadUpstream, upstream)
+	}
+
+	if p.transport == nil {
+		p.transport = &http.Transport{}
+		if t, ok := http.DefaultTransport.(*http.Transport); ok {
+			t = t.Clone()
+			t.Proxy = nil
+			p.transport = t
+		}
+	}
+
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(p.target)
+			r.SetXForwarded()
+		},
+		Transport: &recorder{proxy: p},
+	}
+	p.server = httpserver.New(append(slices.Clone(p.serverOpts), httpserver.WithHandler(rp))...)
+	return p.server.Start()
+}
+
+func (p *Proxy) Ready() error { return nil }
+
+func (p *Proxy) Stop() error {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Stop()
+}
+
+// Name returns the name set with WithName or "capture".
+func (p *Proxy) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "capture"
+}
+
+// Outputs returns the outputs of the underlying server, for example {{.capture.URL}}.
+func (p *Proxy) Outputs() map[string]string {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Outputs()
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders in the upstream URL.
+func (p *Proxy) SetOutputs(outputs map[string]map[string]string) {
+	if p.outputs == nil {
+		p.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(p.outputs, outputs)
+}
+
+// URL returns the base URL of the proxy which the tests should call instead of the upstream,
+// or an empty string if the proxy hasn't been started.
+func (p *Proxy) URL() string {
+	if p.server == nil {
+		return ""
+	}
+	return p.server.URL()
+}
+
+// Client returns a client for calling the proxy, see httpserver.Server.Client,
+// or a plain client if the proxy hasn't been started.
+func (p *Proxy) Client() *http.Client {
+	if p.server == nil {
+		return &http.Client{}
+	}
+	return p.server.Client()
+}
+
+// Upstream returns the resolved upstream URL or an empty string if the proxy hasn't been started.
+func (p *Proxy) Upstream() string {
+	if p.target == nil {
+		return ""
+	}
+	return p.target.String()
+}
+
+// Exchanges returns the captured exchanges matching all predicates in the order they were completed.
+func (p *Proxy) Exchanges(predicates ...Predicate) []Exchange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var matched []Exchange
+	for _, e := range p.exchanges {
+		if e.match(predicates) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+// Last returns the last captured exchange matching all predicates.
+func (p *Proxy) Last(predicates ...Predicate) (Exchange, bool) {
+	es := p.Exchanges(predicates...)
+	if len(es) == 0 {
+		return Exchange{}, false
+	}
+	return es[len(es)-1], true
+}
+
+// WaitFor waits until an exchange matching all predicates is captured and returns it.
+// Exchanges captured before the call are also considered.
+func (p *Proxy) WaitFor(ctx context.Context, predicates ...Predicate) (Exchange, error) {
+	for {
+		p.mu.Lock()
+		notify := p.notify
+		p.mu.Unlock()
+
+		if es := p.Exchanges(predicates...); len(es) > 0 {
+			return es[0], nil
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return Exchange{}, fmt.Errorf("%w: %w: captured: %s", ErrTimeout, context.Cause(ctx), p.summary())
+		}
+	}
+}
+
+// Reset removes the captured exchanges.
+func (p *Proxy) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exchanges = nil
+}
+
+// CollectArtifacts writes the captured exchanges into capture.har.
+func (p *Proxy) CollectArtifacts(dir string) error {
+	f, err := os.OpenFile(filepath.Join(dir, "capture.har"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	return errors.Join(p.WriteHAR(f), f.Close())
+}
+
+// WriteHAR writes the captured exchanges into w in HAR 1.2 format.
+func (p *Proxy) WriteHAR(w io.Writer) error {
+	return writeHAR(w, p.Exchanges())
+}
+
+func (p *Proxy) add(e Exchange) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.exchanges = append(p.exchanges, e)
+	close(p.notify)
+	p.notify = make(chan struct{})
+}
+
+func (p *Proxy) summary() string {
+	es := p.Exchanges()
+	if len(es) == 0 {
+		return "none"
+	}
+	ss := make([]string, 0, len(es))
+	for _, e := range es {
+		ss = append(ss, e.String())
+	}
+	return strings.Join(ss, ", ")
+}
+
+// recorder is the transport of the reverse proxy which captures the exchanges.
+type recorder struct {
+	proxy *Proxy
+}
+
+func (rec *recorder) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	e := Exchange{
+		Started: time.Now(),
+		Request: Request{Method: r.Method, URL: r.URL, Proto: r.Proto, Header: r.Header.Clone(), Body: body},
+	}
+	// The trace hooks are called from the goroutines of the transport.
+	var (
+		mu           sync.Mutex
+		wrote, first time.Time
+	)
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			wrote = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			first = time.Now()
+		},
+	}))
+
+	resp, err := rec.proxy.transport.RoundTrip(r)
+	if err == nil {
+		e.Response.Body, err = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(e.Response.Body))
+		e.Response.Status, e.Response.Proto, e.Response.Header = resp.StatusCode, resp.Proto, resp.Header.Clone()
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	end := time.Now()
+	e.Duration = end.Sub(e.Started)
+	mu.Lock()
+	switch {
+	case !first.IsZero():
+		e.Timings = Timings{Send: wrote.Sub(e.Started), Wait: first.Sub(wrote), Receive: end.Sub(first)}
+	case !wrote.IsZero():
+		e.Timings = Timings{Send: wrote.Sub(e.Started), Wait: end.Sub(wrote)}
+	default:
+		e.Timings = Timings{Send: e.Duration}
+	}
+	mu.Unlock()
+	rec.proxy.add(e)
+	return resp, err
+}
+
+func (e Exchange) String() string {
+	if e.Error != "" {
+		return fmt.Sprintf("%s %s (%s)", e.Request.Method, e.Request.URL.Path, e.Error)
+	}
+	return fmt.Sprintf("%s %s (%d, %s)", e.Request.Method, e.Request.URL.Path, e.Response.Status, e.Duration)
+}
+
+func (e Exchange) match(predicates []Predicate) bool {
+	for _, p := range predicates {
+		if !p(e) {
+			return false
+		}
+	}
+	return true
+}
+
+// Method selects exchanges with method.
+func Method(method string) Predicate {
+	return func(e Exchange) bool { return strings.EqualFold(e.Request.Method, method) }
+}
+
+// Path selects exchanges to path.
+func Path(path string) Predicate {
+	return func(e Exchange) bool { return e.Request.URL.Path == path }
+}
+
+// PathPrefix selects exchanges to paths starting with prefix.
+func PathPrefix(prefix string) Predicate {
+	return func(e Exchange) bool { return strings.HasPrefix(e.Request.URL.Path, prefix) }
+}
+
+// Status selects exchanges which were responded with status.
+func Status(status int) Predicate {
+	return func(e Exchange) bool { return e.Response.Status == status }
+}
+
+// Failed selects exchanges which were responded with 4xx or 5xx status or didn't reach the upstream.
+func Failed() Predicate {
+	return func(e Exchange) bool { return e.Error != "" || e.Response.Status >= 400 }
+}
+
+// WithName sets the name of the proxy which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(p *Proxy) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithUpstream sets the URL of the upstream, which is required.
+// The URL can contain placeholders, for example http://{{.app.Addr}}.
+func WithUpstream(url string) Opt {
+	return func(p *Proxy) error {
+		p.upstream = url
+		return nil
+	}
+}
+
+// WithTransport sets the transport used for the upstream requests, for example to trust a test CA.
+func WithTransport(rt http.RoundTripper) Opt {
+	return func(p *Proxy) error {
+		p.transport = rt
+		return nil
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithPort.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(p *Proxy) error {
+		p.serverOpts = append(p.serverOpts, opts...)
+		return nil
+	}
+}
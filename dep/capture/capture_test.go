@@ -0,0 +1,145 @@
+package capture_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/capture"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy(t *testing.T) {
+	app := httpserver.New(
+		httpserver.WithName("app"),
+		httpserver.WithJSONRoute("GET /users", http.StatusOK, []string{"alice"}),
+		httpserver.WithRoute("POST /users", httpserver.Response{Status: http.StatusCreated, Body: "created"}),
+		httpserver.WithRoute("GET /logo.png", httpserver.Response{
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": {"image/png"}},
+			Body:   "\x89PNG",
+		}),
+	)
+	deptest.ErrorIs(t, app, func() {
+		p := capture.New(capture.WithUpstream("{{.app.URL}}"))
+		p.SetOutputs(map[string]map[string]string{"app": app.Outputs()})
+		deptest.ErrorIs(t, p, func() {
+			assert.Equal(t, app.URL(), p.Upstream())
+			assert.Equal(t, p.URL(), p.Outputs()["URL"])
+
+			assert.Equal(t, `["alice"]`, strings.TrimSpace(do(t, p, http.MethodGet, "/users?page=1", "")))
+			assert.Equal(t, "created", do(t, p, http.MethodPost, "/users", `{"name":"bob"}`))
+			do(t, p, http.MethodGet, "/missing", "")
+			do(t, p, http.MethodGet, "/logo.png", "")
+
+			require.Len(t, p.Exchanges(), 4)
+			posts := p.Exchanges(capture.Method("post"), capture.Path("/users"))
+			require.Len(t, posts, 1)
+			assert.Equal(t, `{"name":"bob"}`, string(posts[0].Request.Body))
+			assert.Equal(t, "created", string(posts[0].Response.Body))
+			assert.Equal(t, http.StatusCreated, posts[0].Response.Status)
+			assert.Positive(t, posts[0].Duration)
+			assert.GreaterOrEqual(t, posts[0].Duration, posts[0].Timings.Send+posts[0].Timings.Wait+posts[0].Timings.Receive)
+
+			failed, ok := p.Last(capture.Failed())
+			require.True(t, ok)
+			assert.Equal(t, "/missing", failed.Request.URL.Path)
+			assert.Len(t, p.Exchanges(capture.PathPrefix("/users"), capture.Status(http.StatusOK)), 1)
+
+			e, err := p.WaitFor(t.Context(), capture.Path("/users"))
+			require.NoError(t, err)
+			assert.Equal(t, "page=1", e.Request.URL.RawQuery)
+
+			ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+			defer cancel()
+			_, err = p.WaitFor(ctx, capture.Path("/never"))
+			require.ErrorIs(t, err, capture.ErrTimeout)
+			assert.ErrorContains(t, err, "POST /users (201")
+
+			dir := t.TempDir()
+			require.NoError(t, p.CollectArtifacts(dir))
+			b, err := os.ReadFile(filepath.Join(dir, "capture.har"))
+			require.NoError(t, err)
+			var har struct {
+				Log struct {
+					Version string `json:"version"`
+					Entries []struct {
+						Request struct {
+							Method      string `json:"method"`
+							URL         string `json:"url"`
+							QueryString []struct {
+								Name, Value string
+							} `json:"queryString"`
+							PostData *struct {
+								Text string `json:"text"`
+							} `json:"postData"`
+						} `json:"request"`
+						Response struct {
+							Status  int `json:"status"`
+							Content struct {
+								Text     string `json:"text"`
+								Encoding string `json:"encoding"`
+							} `json:"content"`
+						} `json:"response"`
+					} `json:"entries"`
+				} `json:"log"`
+			}
+			require.NoError(t, json.Unmarshal(b, &har))
+			assert.Equal(t, "1.2", har.Log.Version)
+			require.Len(t, har.Log.Entries, 4)
+			assert.Equal(t, app.URL()+"/users?page=1", har.Log.Entries[0].Request.URL)
+			assert.Equal(t, "page", har.Log.Entries[0].Request.QueryString[0].Name)
+			assert.Equal(t, `{"name":"bob"}`, har.Log.Entries[1].Request.PostData.Text)
+			assert.Equal(t, http.StatusNotFound, har.Log.Entries[2].Response.Status)
+			assert.Equal(t, "base64", har.Log.Entries[3].Response.Content.Encoding)
+
+			p.Reset()
+			assert.Empty(t, p.Exchanges())
+		}, nil)
+	}, nil)
+}
+
+func TestProxy_UpstreamDown(t *testing.T) {
+	p := capture.New(capture.WithName("front"), capture.WithUpstream("http://127.0.0.1:1"))
+	deptest.ErrorIs(t, p, func() {
+		assert.Equal(t, "front", p.Name())
+		resp, err := http.Get(p.URL() + "/health")
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+
+		es := p.Exchanges(capture.Failed())
+		require.Len(t, es, 1)
+		assert.NotEmpty(t, es[0].Error)
+	}, nil)
+}
+
+func TestProxy_Errors(t *testing.T) {
+	p := capture.New()
+	deptest.ErrorIs(t, p, nil, capture.ErrMissingUpstream)
+	assert.Empty(t, p.URL())
+	assert.Empty(t, p.Upstream())
+	assert.NotNil(t, p.Client())
+	deptest.ErrorIs(t, capture.New(capture.WithUpstream("localhost:8080")), nil, capture.ErrBadUpstream)
+}
+
+func do(t *testing.T, p *capture.Proxy, method, path, body string) string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, p.URL()+path, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := p.Client().Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(b)
+}
@@ -0,0 +1,176 @@
+package capture
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR 1.2 types, see http://www.softwareishard.com/blog/har-12-spec/.
+type (
+	har struct {
+		Log harLog `json:"log"`
+	}
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+	harEntry struct {
+		StartedDateTime time.Time   `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		Comment         string      `json:"comment,omitempty"`
+	}
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+	}
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+		Encoding string `json:"encoding,omitempty"`
+	}
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+func writeHAR(w io.Writer, exchanges []Exchange) error {
+	h := har{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "tstr"},
+		Entries: make([]harEntry, 0, len(exchanges)),
+	}}
+	for _, e := range exchanges {
+		h.Log.Entries = append(h.Log.Entries, e.harEntry())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(h)
+}
+
+func (e Exchange) harEntry() harEntry {
+	req := harRequest{
+		Method:      e.Request.Method,
+		URL:         e.Request.URL.String(),
+		HTTPVersion: e.Request.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Request.Header),
+		QueryString: []harNameValue{},
+		HeadersSize: -1,
+		BodySize:    len(e.Request.Body),
+	}
+	query := e.Request.URL.Query()
+	for _, k := range slices.Sorted(maps.Keys(query)) {
+		for _, v := range query[k] {
+			req.QueryString = append(req.QueryString, harNameValue{Name: k, Value: v})
+		}
+	}
+	if len(e.Request.Body) > 0 {
+		req.PostData = &harPostData{MimeType: e.Request.Header.Get("Content-Type"), Text: string(e.Request.Body)}
+	}
+
+	resp := harResponse{
+		Status:      e.Response.Status,
+		StatusText:  http.StatusText(e.Response.Status),
+		HTTPVersion: e.Response.Proto,
+		Cookies:     []harNameValue{},
+		Headers:     harHeaders(e.Response.Header),
+		Content:     harContent{Size: len(e.Response.Body), MimeType: e.Response.Header.Get("Content-Type")},
+		RedirectURL: e.Response.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    len(e.Response.Body),
+	}
+	if resp.Content.MimeType == "" {
+		resp.Content.MimeType = "application/octet-stream"
+	}
+	if utf8.Valid(e.Response.Body) && isText(resp.Content.MimeType) {
+		resp.Content.Text = string(e.Response.Body)
+	} else if len(e.Response.Body) > 0 {
+		resp.Content.Text, resp.Content.Encoding = base64.StdEncoding.EncodeToString(e.Response.Body), "base64"
+	}
+
+	return harEntry{
+		StartedDateTime: e.Started,
+		Time:            millis(e.Duration),
+		Request:         req,
+		Response:        resp,
+		Timings: harTimings{
+			Send:    millis(e.Timings.Send),
+			Wait:    millis(e.Timings.Wait),
+			Receive: millis(e.Timings.Receive),
+		},
+		Comment: e.Error,
+	}
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	nvs := []harNameValue{}
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		for _, v := range h[k] {
+			nvs = append(nvs, harNameValue{Name: k, Value: v})
+		}
+	}
+	return nvs
+}
+
+// isText reports whether the media type is textual, other bodies are base64 encoded.
+func isText(mimeType string) bool {
+	mt, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return false
+	}
+	switch mt {
+	case "application/json", "application/xml", "application/javascript", "application/x-www-form-urlencoded":
+		return true
+	}
+	return strings.HasPrefix(mt, "text/") || strings.HasSuffix(mt, "+json") || strings.HasSuffix(mt, "+xml")
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -3,14 +3,23 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/port"
 	"github.com/go-tstr/tstr/strerr"
 	"golang.org/x/sync/errgroup"
 )
@@ -36,6 +45,12 @@ type Cmd struct {
 	stop         func(*exec.Cmd) error
 	cmd          *exec.Cmd
 	readyTimeout time.Duration
+	output       *outputBuffer
+	traceContext map[string]string
+	name         string
+	ports        []*port.Port
+	outputs      expand.Values
+	readyClient  *http.Client
 }
 
 type Opt func(*Cmd) error
@@ -46,6 +61,7 @@ func New(opts ...Opt) *Cmd {
 		ready:        func(context.Context, *exec.Cmd) error { return nil },
 		stop:         StopWithSignal(os.Interrupt),
 		readyTimeout: 30 * time.Second,
+		output:       &outputBuffer{limit: outputLimit},
 	}
 }
 
@@ -60,6 +76,27 @@ func (c *Cmd) Start() error {
 		return ErrMissingCmd
 	}
 
+	if err := c.expand(); err != nil {
+		return c.wrapErr(ErrStartFailed, err)
+	}
+
+	if len(c.traceContext) > 0 {
+		if c.cmd.Env == nil {
+			c.cmd.Env = os.Environ()
+		}
+		for _, k := range slices.Sorted(maps.Keys(c.traceContext)) {
+			c.cmd.Env = append(c.cmd.Env, strings.ToUpper(k)+"="+c.traceContext[k])
+		}
+	}
+
+	for _, p := range c.ports {
+		if err := p.Release(); err != nil {
+			return c.wrapErr(ErrStartFailed, err)
+		}
+	}
+
+	c.cmd.Stdout = c.teeOutput(c.cmd.Stdout)
+	c.cmd.Stderr = c.teeOutput(c.cmd.Stderr)
 	return c.wrapErr(ErrStartFailed, c.cmd.Start())
 }
 
@@ -82,7 +119,104 @@ func (c *Cmd) Ready() error {
 }
 
 func (c *Cmd) Stop() error {
-	return c.wrapErr(ErrStopFailed, c.stop(c.cmd))
+	err := c.stop(c.cmd)
+	for _, p := range c.ports {
+		err = errors.Join(err, p.Close())
+	}
+	return c.wrapErr(ErrStopFailed, err)
+}
+
+// Name returns the name set with WithName or the base name of the command.
+func (c *Cmd) Name() string {
+	if c.name != "" || c.cmd == nil {
+		return c.name
+	}
+	return filepath.Base(c.cmd.Path)
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders
+// such as {{.postgres.Port}} or ${api.URL} in the arguments, environment and working directory of the command.
+// Outputs from repeated calls are merged, so values set manually are kept when the command is started by tstr.
+// See the expand package for details.
+func (c *Cmd) SetOutputs(outputs map[string]map[string]string) {
+	if c.outputs == nil {
+		c.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(c.outputs, outputs)
+}
+
+// SetTraceContext sets the trace context which is passed to the command
+// as upper case environment variables, such as TRACEPARENT, so that the started process can join the trace.
+func (c *Cmd) SetTraceContext(carrier map[string]string) {
+	c.traceContext = carrier
+}
+
+// CollectArtifacts writes the command line, working directory and environment of the command into command.json
+// and the captured output of the command into output.log.
+func (c *Cmd) CollectArtifacts(dir string) error {
+	if c.cmd == nil {
+		return nil
+	}
+
+	info := struct {
+		Path     string   `json:"path"`
+		Args     []string `json:"args"`
+		Dir      string   `json:"dir"`
+		Env      []string `json:"env"`
+		Pid      int      `json:"pid,omitempty"`
+		ExitCode *int     `json:"exitCode,omitempty"`
+	}{
+		Path: c.cmd.Path,
+		Args: c.cmd.Args,
+		Dir:  c.cmd.Dir,
+		Env:  c.cmd.Environ(),
+	}
+	if c.cmd.Process != nil {
+		info.Pid = c.cmd.Process.Pid
+	}
+	if c.cmd.ProcessState != nil {
+		code := c.cmd.ProcessState.ExitCode()
+		info.ExitCode = &code
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "command.json"), b, 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "output.log"), c.output.Bytes(), 0o600)
+}
+
+// expand resolves the placeholders in the arguments, environment and working directory of the command.
+func (c *Cmd) expand() error {
+	vals, err := expand.Strings(slices.Concat(c.cmd.Args, c.cmd.Env, []string{c.cmd.Dir}), c.outputs)
+	if err != nil {
+		return err
+	}
+
+	args, env := len(c.cmd.Args), len(c.cmd.Env)
+	c.cmd.Args = vals[:args]
+	if c.cmd.Env != nil {
+		c.cmd.Env = vals[args : args+env]
+	}
+	c.cmd.Dir = vals[args+env]
+	return nil
+}
+
+// teeOutput makes w to also write into the output buffer used for artifacts.
+// Nil writer, which would discard the output, is replaced with the output buffer.
+// Files other than os.Stdout and os.Stderr, such as pipes created with StdoutPipe, are returned untouched
+// since replacing them would change how the output is consumed.
+func (c *Cmd) teeOutput(w io.Writer) io.Writer {
+	if w == nil {
+		return c.output
+	}
+	if f, ok := w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		return w
+	}
+	return io.MultiWriter(w, c.output)
 }
 
 func (c *Cmd) wrapErr(wErr, err error) error {
@@ -92,6 +226,14 @@ func (c *Cmd) wrapErr(wErr, err error) error {
 	return fmt.Errorf("cmd '%s' %w: %w", c.cmd.String(), wErr, err)
 }
 
+// WithName sets the name used to identify the command in errors, artifacts and traces.
+func WithName(name string) Opt {
+	return func(c *Cmd) error {
+		c.name = name
+		return nil
+	}
+}
+
 // WithCommand creates a new command with the given name and arguments.
 func WithCommand(name string, args ...string) Opt {
 	return func(c *Cmd) error {
@@ -115,6 +257,17 @@ func WithCommandFn(fn func() (*exec.Cmd, error)) Opt {
 	}
 }
 
+// WithPorts hands the reserved ports over to the command.
+// The ports are released right before the command is started so that the command can bind them
+// and closed when the command is stopped.
+// Pass the port numbers to the command with WithArgsAppend or WithEnvAppend.
+func WithPorts(ports ...*port.Port) Opt {
+	return func(c *Cmd) error {
+		c.ports = append(c.ports, ports...)
+		return nil
+	}
+}
+
 // WithReadyFn allows user to provide custom readiness function.
 // Given fn should block until the command is ready.
 func WithReadyFn(fn func(context.Context, *exec.Cmd) error) Opt {
@@ -125,6 +278,7 @@ func WithReadyFn(fn func(context.Context, *exec.Cmd) error) Opt {
 }
 
 // WithReadyHTTP sets the ready function to wait for url to return 200 OK.
+// Requests are made with the client set with WithReadyHTTPClient, if any.
 func WithReadyHTTP(url string) Opt {
 	const delay = 100 * time.Millisecond
 	return func(c *Cmd) error {
@@ -132,6 +286,13 @@ func WithReadyHTTP(url string) Opt {
 			client := &http.Client{
 				Timeout: 1 * time.Second,
 			}
+			if c.readyClient != nil {
+				cc := *c.readyClient
+				client = &cc
+				if client.Timeout == 0 {
+					client.Timeout = 1 * time.Second
+				}
+			}
 			for {
 				if ctx.Err() != nil {
 					return ctx.Err()
@@ -154,6 +315,18 @@ func WithReadyHTTP(url string) Opt {
 	}
 }
 
+// WithReadyHTTPClient sets the client used by WithReadyHTTP, for example to trust a test CA.
+// The probe uses a timeout of one second if the client has none.
+func WithReadyHTTPClient(client *http.Client) Opt {
+	return func(c *Cmd) error {
+		if client == nil {
+			return errors.New("nil client")
+		}
+		c.readyClient = client
+		return nil
+	}
+}
+
 // WithStopFn allows user to provide custom stop function.
 func WithStopFn(fn func(*exec.Cmd) error) Opt {
 	return func(c *Cmd) error {
@@ -173,6 +346,7 @@ func WithEnvSet(env ...string) Opt {
 
 // WithEnvAppend adds environment variables to commands current env.
 // By default the command inherits the environment of the current process and setting this option will override it.
+// Placeholders such as {{.postgres.Port}} are resolved when the command is started, see SetOutputs.
 func WithEnvAppend(env ...string) Opt {
 	return func(c *Cmd) error {
 		c.cmd.Env = append(c.cmd.Env, env...)
@@ -189,6 +363,7 @@ func WithArgsSet(args ...string) Opt {
 }
 
 // WithArgsAppend adds arguments to commands current argument list.
+// Placeholders such as {{.postgres.Port}} are resolved when the command is started, see SetOutputs.
 func WithArgsAppend(args ...string) Opt {
 	return func(c *Cmd) error {
 		c.cmd.Args = append(c.cmd.Args, args...)
@@ -197,6 +372,7 @@ func WithArgsAppend(args ...string) Opt {
 }
 
 // WithDir sets the working directory for the command.
+// Placeholders such as {{.workspace.Dir}} are resolved when the command is started, see SetOutputs.
 func WithDir(dir string) Opt {
 	return func(c *Cmd) error {
 		c.cmd.Dir = dir
@@ -207,7 +383,7 @@ func WithDir(dir string) Opt {
 // WithWaitMatchingLine sets the ready function so that it waits for the command to output a line that matches the given regular expression.
 func WithWaitMatchingLine(exp string) Opt {
 	return func(c *Cmd) error {
-		fn, err := MatchingLine(exp, c.cmd)
+		fn, err := matchingLine(exp, c.cmd, c.output)
 		if err != nil {
 			return err
 		}
@@ -320,6 +496,11 @@ func StopWithSignal(s os.Signal) func(*exec.Cmd) error {
 
 // MatchLine waits for the command to output a line that matches the given regular expression.
 func MatchingLine(exp string, cmd *exec.Cmd) (func(context.Context, *exec.Cmd) error, error) {
+	return matchingLine(exp, cmd, io.Discard)
+}
+
+// matchingLine works like MatchingLine but also writes all the scanned lines into w.
+func matchingLine(exp string, cmd *exec.Cmd, w io.Writer) (func(context.Context, *exec.Cmd) error, error) {
 	if cmd == nil {
 		return nil, ErrNilCmdRegexp
 	}
@@ -338,10 +519,12 @@ func MatchingLine(exp string, cmd *exec.Cmd) (func(context.Context, *exec.Cmd) e
 	return func(ctx context.Context, cmd *exec.Cmd) error {
 		scanner := bufio.NewScanner(stdout)
 		for scanner.Scan() {
+			writeLine(w, scanner.Bytes())
 			if re.Match(scanner.Bytes()) {
 				// drain the rest of the output on background
 				go func() {
 					for scanner.Scan() {
+						writeLine(w, scanner.Bytes())
 					}
 				}()
 				return nil
@@ -353,3 +536,34 @@ func MatchingLine(exp string, cmd *exec.Cmd) (func(context.Context, *exec.Cmd) e
 		return errors.Join(ErrNoMatchingLine, scanner.Err())
 	}, nil
 }
+
+func writeLine(w io.Writer, line []byte) {
+	b := make([]byte, 0, len(line)+1)
+	_, _ = w.Write(append(append(b, line...), '\n'))
+}
+
+// outputLimit is the maximum amount of output kept in memory for artifacts.
+const outputLimit = 4 << 20
+
+// outputBuffer is a concurrency safe buffer which keeps only the last limit bytes written into it.
+type outputBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+func (b *outputBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf...)
+}
@@ -2,6 +2,8 @@ package cmd_test
 
 import (
 	"context"
+	"encoding/json"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -10,8 +12,11 @@ import (
 	"syscall"
 	"testing"
 
+	"github.com/go-tstr/tstr"
 	"github.com/go-tstr/tstr/dep/cmd"
 	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/port"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -168,6 +173,18 @@ func TestWithReadyHTTP(t *testing.T) {
 	deptest.ErrorIs(t, c, nil, nil)
 }
 
+func TestWithReadyHTTPClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(srv.Close)
+	c := cmd.New(
+		cmd.WithReadyHTTP(srv.URL),
+		cmd.WithReadyHTTPClient(srv.Client()),
+		cmd.WithCommand("go", "version"),
+		cmd.WithStopFn(func(c *exec.Cmd) error { return nil }),
+	)
+	deptest.ErrorIs(t, c, nil, nil)
+}
+
 func TestCmd_WithGoCode_Coverage(t *testing.T) {
 	waitPkg := prepareCode(t)
 	coverDir, err := os.MkdirTemp("", "coverdir_")
@@ -187,6 +204,150 @@ func TestCmd_WithGoCode_Coverage(t *testing.T) {
 	require.Len(t, files, 2)
 }
 
+func TestCmd_CollectArtifacts(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []cmd.Opt
+	}{
+		{
+			name: "Stdout",
+			opts: []cmd.Opt{
+				cmd.WithCommand("go", "env", "GOPRIVATE"),
+				cmd.WithEnvAppend("GOPRIVATE=foo"),
+				cmd.WithWaitExit(),
+			},
+		},
+		{
+			name: "NilStdout",
+			opts: []cmd.Opt{
+				cmd.WithCommandFn(func() (*exec.Cmd, error) { return exec.Command("go", "env", "GOPRIVATE"), nil }),
+				cmd.WithEnvAppend("GOPRIVATE=foo"),
+				cmd.WithWaitExit(),
+			},
+		},
+		{
+			name: "WaitMatchingLine",
+			opts: []cmd.Opt{
+				cmd.WithCommand("go", "env", "GOPRIVATE"),
+				cmd.WithEnvAppend("GOPRIVATE=foo"),
+				cmd.WithWaitMatchingLine("foo"),
+				cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			c := cmd.New(tt.opts...)
+			deptest.ErrorIs(t, c, func() {
+				require.NoError(t, c.CollectArtifacts(dir))
+			}, nil)
+
+			output, err := os.ReadFile(filepath.Join(dir, "output.log"))
+			require.NoError(t, err)
+			assert.Equal(t, "foo\n", string(output))
+
+			b, err := os.ReadFile(filepath.Join(dir, "command.json"))
+			require.NoError(t, err)
+			var info struct {
+				Args []string `json:"args"`
+				Env  []string `json:"env"`
+			}
+			require.NoError(t, json.Unmarshal(b, &info))
+			assert.Equal(t, []string{"go", "env", "GOPRIVATE"}, info.Args)
+			assert.Contains(t, info.Env, "GOPRIVATE=foo")
+		})
+	}
+}
+
+func TestCmd_SetTraceContext(t *testing.T) {
+	const traceParent = "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	dir := t.TempDir()
+	c := cmd.New(
+		cmd.WithCommand("go", "version"),
+		cmd.WithWaitExit(),
+	)
+	c.SetTraceContext(map[string]string{"traceparent": traceParent})
+	deptest.ErrorIs(t, c, func() {
+		require.NoError(t, c.CollectArtifacts(dir))
+	}, nil)
+
+	b, err := os.ReadFile(filepath.Join(dir, "command.json"))
+	require.NoError(t, err)
+	var info struct {
+		Env []string `json:"env"`
+	}
+	require.NoError(t, json.Unmarshal(b, &info))
+	assert.Contains(t, info.Env, "TRACEPARENT="+traceParent)
+	assert.Contains(t, info.Env, "PATH="+os.Getenv("PATH"))
+}
+
+func TestCmd_Name(t *testing.T) {
+	c := cmd.New(
+		cmd.WithCommand("go", "version"),
+		cmd.WithWaitExit(),
+	)
+	assert.Empty(t, c.Name())
+	deptest.ErrorIs(t, c, func() {
+		assert.Equal(t, "go", c.Name())
+	}, nil)
+
+	c = cmd.New(
+		cmd.WithName("version"),
+		cmd.WithCommand("go", "version"),
+		cmd.WithWaitExit(),
+	)
+	deptest.ErrorIs(t, c, func() {
+		assert.Equal(t, "version", c.Name())
+	}, nil)
+}
+
+func TestCmd_WithPorts(t *testing.T) {
+	dir := t.TempDir()
+	p := port.MustReserve(port.TCP, port.WithLockDir(dir))
+	c := cmd.New(
+		cmd.WithCommand("go", "version"),
+		cmd.WithPorts(p),
+		cmd.WithWaitExit(),
+	)
+	deptest.ErrorIs(t, c, func() {
+		l, err := net.Listen("tcp", p.Addr())
+		require.NoError(t, err, "port should be released when command is started")
+		require.NoError(t, l.Close())
+	}, nil)
+	assert.NoFileExists(t, filepath.Join(dir, "tcp-"+p.String()+".lock"))
+}
+
+func TestCmd_Placeholders(t *testing.T) {
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()), port.WithName("api"))
+	err := tstr.Run(
+		tstr.WithDeps(
+			p,
+			cmd.New(
+				cmd.WithCommand("go", "env", "GOPRIVATE"),
+				cmd.WithEnvAppend("GOPRIVATE=${api.Port}"),
+				cmd.WithDir("{{.tmp.Dir}}"),
+				cmd.WithWaitMatchingLine("^"+p.String()+"$"),
+				cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+			),
+		),
+		tstr.WithFn(func() {}),
+	)
+	require.ErrorIs(t, err, expand.ErrUnresolved)
+	assert.ErrorContains(t, err, "unresolved placeholders: {{.tmp.Dir}}")
+
+	c := cmd.New(
+		cmd.WithCommand("go", "env", "GOPRIVATE"),
+		cmd.WithEnvAppend("GOPRIVATE=${api.Port}"),
+		cmd.WithDir("{{.tmp.Dir}}"),
+		cmd.WithWaitMatchingLine("^"+p.String()+"$"),
+		cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+	)
+	c.SetOutputs(map[string]map[string]string{"tmp": {"Dir": t.TempDir()}, "api": p.Outputs()})
+	deptest.ErrorIs(t, c, nil, nil)
+}
+
 func blockForever(context.Context, *exec.Cmd) error {
 	select {}
 }
@@ -2,7 +2,12 @@ package compose
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/go-tstr/tstr/strerr"
 	tc "github.com/testcontainers/testcontainers-go/modules/compose"
@@ -20,6 +25,7 @@ type Compose struct {
 	upOpts   []tc.StackUpOption
 	downOpts []tc.StackDownOption
 	ready    func(tc.ComposeStack) error
+	name     string
 }
 
 // New creates new Compose dependency.
@@ -48,17 +54,100 @@ func (c *Compose) Ready() error {
 }
 
 func (c *Compose) Stop() error {
+	if c.stack == nil {
+		return nil
+	}
 	return c.stack.Down(context.Background(), c.downOpts...)
 }
 
+// Name returns the name set with WithName.
+func (c *Compose) Name() string {
+	return c.name
+}
+
+// CollectArtifacts writes the state of each service container into ps.json
+// and the logs of each service into <service>.log.
+func (c *Compose) CollectArtifacts(dir string) error {
+	if c.stack == nil {
+		return nil
+	}
+
+	var errs error
+	ps := []psEntry{}
+	for _, name := range c.stack.Services() {
+		e, err := collectService(context.Background(), c.stack, name, dir)
+		if err != nil {
+			e.Error = err.Error()
+			errs = errors.Join(errs, fmt.Errorf("service %s: %w", name, err))
+		}
+		ps = append(ps, e)
+	}
+
+	b, err := json.MarshalIndent(ps, "", "  ")
+	if err != nil {
+		return errors.Join(errs, err)
+	}
+	return errors.Join(errs, os.WriteFile(filepath.Join(dir, "ps.json"), b, 0o600))
+}
+
+type psEntry struct {
+	Service string `json:"service"`
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	Image   string `json:"image,omitempty"`
+	State   string `json:"state,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func collectService(ctx context.Context, stack tc.ComposeStack, name, dir string) (_ psEntry, err error) {
+	e := psEntry{Service: name}
+	container, err := stack.ServiceContainer(ctx, name)
+	if err != nil {
+		return e, err
+	}
+	e.ID = container.GetContainerID()
+	e.Image = container.Image
+
+	info, err := container.Inspect(ctx)
+	if err != nil {
+		return e, err
+	}
+	e.Name = info.Name
+	if info.State != nil {
+		e.State = string(info.State.Status)
+	}
+
+	logs, err := container.Logs(ctx)
+	if err != nil {
+		return e, err
+	}
+	defer func() { err = errors.Join(err, logs.Close()) }()
+
+	f, err := os.Create(filepath.Join(dir, name+".log"))
+	if err != nil {
+		return e, err
+	}
+	_, err = io.Copy(f, logs)
+	return e, errors.Join(err, f.Close())
+}
+
+// WithName sets the name used to identify the compose stack in errors, artifacts and traces.
+func WithName(name string) Opt {
+	return func(c *Compose) error {
+		c.name = name
+		return nil
+	}
+}
+
 // WithFile creates compose stack from file.
 func WithFile(file string) Opt {
 	return func(c *Compose) error {
-		var err error
-		c.stack, err = tc.NewDockerCompose(file)
+		// Assign only a created stack, a nil *DockerCompose would make c.stack a non-nil interface.
+		s, err := tc.NewDockerCompose(file)
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrCreateStack, err)
 		}
+		c.stack = s
 		return nil
 	}
 }
@@ -3,6 +3,7 @@ package compose_test
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-tstr/tstr/dep/compose"
@@ -59,6 +60,20 @@ func TestCompose(t *testing.T) {
 	}
 }
 
+func TestCompose_CollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	c := compose.New(
+		compose.WithFile(prepareFile(t)),
+		compose.WithDownOptions(tc.RemoveVolumes(true)),
+	)
+	deptest.ErrorIs(t, c, func() {
+		require.NoError(t, c.CollectArtifacts(dir))
+	}, nil)
+
+	assert.FileExists(t, filepath.Join(dir, "ps.json"))
+	assert.FileExists(t, filepath.Join(dir, "postgres.log"))
+}
+
 const composeFile = `
 services:
   postgres:
@@ -2,10 +2,23 @@
 package container
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
 
+	"github.com/go-tstr/tstr/port"
 	"github.com/go-tstr/tstr/strerr"
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/api/types/network"
 	"github.com/testcontainers/testcontainers-go"
 )
 
@@ -18,6 +31,8 @@ type Container struct {
 	opts  []Opt
 	c     testcontainers.Container
 	ready func(testcontainers.Container) error
+	name  string
+	image string
 }
 
 type Opt func(*Container) error
@@ -46,11 +61,103 @@ func (c *Container) Stop() error {
 	return testcontainers.TerminateContainer(c.c)
 }
 
+// Name returns the name set with WithName or the image of the container.
+func (c *Container) Name() string {
+	if c.name != "" {
+		return c.name
+	}
+	return c.image
+}
+
+// Outputs returns the values which other dependencies can refer to with placeholders such as {{.postgres.Port}}:
+//   - Host is the host where the container ports are exposed.
+//   - Port is the host port mapped to the lowest exposed container port and Addr is Host:Port.
+//   - Port_<port> is the host port mapped to the container tcp port and Port_<port>_<proto> to ports of other protocols.
+func (c *Container) Outputs() map[string]string {
+	if c.c == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	out := map[string]string{"ID": c.c.GetContainerID()}
+	host, err := c.c.Host(ctx)
+	if err != nil {
+		return out
+	}
+	out["Host"] = host
+
+	info, err := c.c.Inspect(ctx)
+	if err != nil || info.NetworkSettings == nil {
+		return out
+	}
+
+	ports := slices.SortedFunc(maps.Keys(info.NetworkSettings.Ports), func(a, b network.Port) int {
+		return cmp.Or(cmp.Compare(a.Num(), b.Num()), cmp.Compare(a.Proto(), b.Proto()))
+	})
+	for _, p := range ports {
+		bindings := info.NetworkSettings.Ports[p]
+		if len(bindings) == 0 {
+			continue
+		}
+		key := "Port_" + p.Port()
+		if p.Proto() != network.TCP {
+			key += "_" + string(p.Proto())
+		}
+		out[key] = bindings[0].HostPort
+		if _, ok := out["Port"]; !ok {
+			out["Port"] = bindings[0].HostPort
+			out["Addr"] = net.JoinHostPort(host, bindings[0].HostPort)
+		}
+	}
+	return out
+}
+
+// CollectArtifacts writes the container inspect data into inspect.json and the container logs into container.log.
+func (c *Container) CollectArtifacts(dir string) (err error) {
+	if c.c == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	info, err := c.c.Inspect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container: %w", err)
+	}
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "inspect.json"), b, 0o600); err != nil {
+		return err
+	}
+
+	logs, err := c.c.Logs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get container logs: %w", err)
+	}
+	defer func() { err = errors.Join(err, logs.Close()) }()
+
+	f, err := os.Create(filepath.Join(dir, "container.log"))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, logs)
+	return errors.Join(err, f.Close())
+}
+
 // Container returns the underlying testcontainers.Container.
 func (c *Container) Container() testcontainers.Container {
 	return c.c
 }
 
+// WithName sets the name used to identify the container in errors, artifacts and traces.
+func WithName(name string) Opt {
+	return func(c *Container) error {
+		c.name = name
+		return nil
+	}
+}
+
 // WithReadyFn sets a custom readiness function which should block until ready.
 func WithReadyFn(fn func(testcontainers.Container) error) Opt {
 	return func(c *Container) error {
@@ -66,6 +173,7 @@ func WithModule[T testcontainers.Container](
 	opts ...testcontainers.ContainerCustomizer,
 ) Opt {
 	return func(c *Container) error {
+		c.image = img
 		var err error
 		c.c, err = runFn(context.Background(), img, opts...)
 		if err != nil {
@@ -78,6 +186,7 @@ func WithModule[T testcontainers.Container](
 // WithGenericContainer creates a container using the testcontainers.GenericContainer function.
 func WithGenericContainer(req testcontainers.GenericContainerRequest) Opt {
 	return func(c *Container) (err error) {
+		c.image = req.Image
 		c.c, err = testcontainers.GenericContainer(context.Background(), req)
 		if err != nil {
 			return fmt.Errorf("%w: %w", ErrCreateWithGenericContainer, err)
@@ -85,3 +194,39 @@ func WithGenericContainer(req testcontainers.GenericContainerRequest) Opt {
 		return nil
 	}
 }
+
+// WithHostPort is a testcontainers.ContainerCustomizer that exposes containerPort, such as "5432/tcp",
+// and binds it to the reserved host port p.
+// The port is released right before the container is created so that Docker can bind it.
+//
+// Example:
+//
+//	p := port.MustReserve(port.TCP)
+//	container.New(container.WithModule(postgres.Run, "postgres:16-alpine", container.WithHostPort(p, "5432/tcp")))
+func WithHostPort(p *port.Port, containerPort string) testcontainers.CustomizeRequestOption {
+	return func(req *testcontainers.GenericContainerRequest) error {
+		cp, err := network.ParsePort(containerPort)
+		if err != nil {
+			return err
+		}
+		hostIP, err := netip.ParseAddr(p.Host())
+		if err != nil {
+			return err
+		}
+		if err := testcontainers.WithExposedPorts(containerPort)(req); err != nil {
+			return err
+		}
+
+		modifier := req.HostConfigModifier
+		req.HostConfigModifier = func(hc *container.HostConfig) {
+			if modifier != nil {
+				modifier(hc)
+			}
+			if hc.PortBindings == nil {
+				hc.PortBindings = network.PortMap{}
+			}
+			hc.PortBindings[cp] = append(hc.PortBindings[cp], network.PortBinding{HostIP: hostIP, HostPort: p.String()})
+		}
+		return p.Release()
+	}
+}
@@ -2,10 +2,14 @@ package container_test
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/go-tstr/tstr/dep/container"
 	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/modules/minio"
 	"github.com/testcontainers/testcontainers-go/modules/postgres"
@@ -79,3 +83,33 @@ func TestContainer(t *testing.T) {
 		})
 	}
 }
+
+func TestContainer_CollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	c := container.New(
+		container.WithModule(postgres.Run, "postgres:16-alpine"),
+	)
+	deptest.ErrorIs(t, c, func() {
+		require.NoError(t, c.CollectArtifacts(dir))
+	}, nil)
+
+	assert.FileExists(t, filepath.Join(dir, "inspect.json"))
+	assert.FileExists(t, filepath.Join(dir, "container.log"))
+}
+
+func TestContainer_WithHostPort(t *testing.T) {
+	p := port.MustReserve(port.TCP)
+	c := container.New(
+		container.WithModule(postgres.Run, "postgres:16-alpine",
+			container.WithHostPort(p, "5432/tcp"),
+		),
+	)
+	deptest.ErrorIs(t, c, func() {
+		mapped, err := c.Container().MappedPort(context.Background(), "5432/tcp")
+		require.NoError(t, err)
+		assert.Equal(t, p.String(), mapped.Port())
+		assert.Equal(t, p.String(), c.Outputs()["Port"])
+		assert.Equal(t, p.String(), c.Outputs()["Port_5432"])
+	}, nil)
+	require.NoError(t, p.Close())
+}
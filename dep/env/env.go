@@ -0,0 +1,198 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply      = strerr.Error("failed to apply Opt")
+	ErrSet           = strerr.Error("failed to set environment variable")
+	ErrRestore       = strerr.Error("failed to restore environment variable")
+	ErrMissingOutput = strerr.Error("dependency has no outputs")
+)
+
+// Env sets process environment variables when started and restores the previous values when stopped.
+// Since the process environment is shared, Env must not be used in parallel tests.
+type Env struct {
+	opts     []Opt
+	name     string
+	changes  []change
+	previous []previous
+	outputs  expand.Values
+}
+
+type change struct {
+	key    string
+	value  string
+	unset  bool
+	export string
+}
+
+type previous struct {
+	key   string
+	value string
+	ok    bool
+}
+
+type Opt func(*Env) error
+
+// New creates new Env dependency.
+func New(opts ...Opt) *Env {
+	return &Env{opts: opts}
+}
+
+// Start applies the changes in the order they were given.
+// If a change fails the already applied changes are restored.
+func (e *Env) Start() error {
+	for _, opt := range e.opts {
+		if err := opt(e); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	for _, c := range e.changes {
+		if err := e.apply(c); err != nil {
+			return errors.Join(fmt.Errorf("%w: %w", ErrSet, err), e.restore())
+		}
+	}
+	return nil
+}
+
+func (e *Env) Ready() error { return nil }
+
+// Stop restores the exact values the variables had before Start.
+func (e *Env) Stop() error {
+	return e.restore()
+}
+
+// Name returns the name set with WithName or "env".
+func (e *Env) Name() string {
+	if e.name != "" {
+		return e.name
+	}
+	return "env"
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders
+// such as {{.postgres.Port}} in the values and for WithExport.
+func (e *Env) SetOutputs(outputs map[string]map[string]string) {
+	if e.outputs == nil {
+		e.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(e.outputs, outputs)
+}
+
+func (e *Env) apply(c change) error {
+	if c.export != "" {
+		outputs, ok := e.outputs[c.export]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrMissingOutput, c.export)
+		}
+		for _, k := range slices.Sorted(maps.Keys(outputs)) {
+			if err := e.set(c.key+strings.ToUpper(k), outputs[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if c.unset {
+		e.save(c.key)
+		return os.Unsetenv(c.key)
+	}
+
+	v, err := expand.String(c.value, e.outputs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.key, err)
+	}
+	return e.set(c.key, v)
+}
+
+func (e *Env) set(key, value string) error {
+	e.save(key)
+	return os.Setenv(key, value)
+}
+
+// save records the value of key before it's changed for the first time.
+func (e *Env) save(key string) {
+	if slices.ContainsFunc(e.previous, func(p previous) bool { return p.key == key }) {
+		return
+	}
+	v, ok := os.LookupEnv(key)
+	e.previous = append(e.previous, previous{key: key, value: v, ok: ok})
+}
+
+func (e *Env) restore() error {
+	var err error
+	for _, p := range slices.Backward(e.previous) {
+		if p.ok {
+			err = errors.Join(err, os.Setenv(p.key, p.value))
+		} else {
+			err = errors.Join(err, os.Unsetenv(p.key))
+		}
+	}
+	e.previous = nil
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrRestore, err)
+	}
+	return nil
+}
+
+// WithName sets the name of the dependency.
+func WithName(name string) Opt {
+	return func(e *Env) error {
+		e.name = name
+		return nil
+	}
+}
+
+// WithSet sets key to value.
+// Placeholders such as {{.postgres.Port}} in the value are resolved when the dependency is started.
+func WithSet(key, value string) Opt {
+	return func(e *Env) error {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			return fmt.Errorf("invalid key %q", key)
+		}
+		e.changes = append(e.changes, change{key: key, value: value})
+		return nil
+	}
+}
+
+// WithVars sets each key in vars to its value, see WithSet.
+func WithVars(vars map[string]string) Opt {
+	return func(e *Env) error {
+		for _, k := range slices.Sorted(maps.Keys(vars)) {
+			if err := WithSet(k, vars[k])(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithUnset unsets keys.
+func WithUnset(keys ...string) Opt {
+	return func(e *Env) error {
+		for _, k := range keys {
+			e.changes = append(e.changes, change{key: k, unset: true})
+		}
+		return nil
+	}
+}
+
+// WithExport sets every output of the named dependency as an environment variable
+// named with prefix followed by the upper case output key, for example PG_PORT for prefix "PG_".
+func WithExport(name, prefix string) Opt {
+	return func(e *Env) error {
+		e.changes = append(e.changes, change{key: prefix, export: name})
+		return nil
+	}
+}
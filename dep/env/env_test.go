@@ -0,0 +1,99 @@
+package env_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/env"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnv(t *testing.T) {
+	t.Setenv("TSTR_ENV_EXISTING", "old")
+	t.Setenv("TSTR_ENV_EMPTY", "")
+	t.Setenv("TSTR_ENV_REMOVED", "removed")
+	require.NoError(t, os.Unsetenv("TSTR_ENV_NEW"))
+
+	e := env.New(
+		env.WithSet("TSTR_ENV_EXISTING", "new"),
+		env.WithSet("TSTR_ENV_EXISTING", "newer"),
+		env.WithVars(map[string]string{"TSTR_ENV_NEW": "value", "TSTR_ENV_EMPTY": "set"}),
+		env.WithUnset("TSTR_ENV_REMOVED"),
+	)
+	deptest.ErrorIs(t, e, func() {
+		assertEnv(t, "TSTR_ENV_EXISTING", "newer", true)
+		assertEnv(t, "TSTR_ENV_NEW", "value", true)
+		assertEnv(t, "TSTR_ENV_EMPTY", "set", true)
+		assertEnv(t, "TSTR_ENV_REMOVED", "", false)
+	}, nil)
+
+	assertEnv(t, "TSTR_ENV_EXISTING", "old", true)
+	assertEnv(t, "TSTR_ENV_NEW", "", false)
+	assertEnv(t, "TSTR_ENV_EMPTY", "", true)
+	assertEnv(t, "TSTR_ENV_REMOVED", "removed", true)
+}
+
+func TestEnv_Outputs(t *testing.T) {
+	require.NoError(t, os.Unsetenv("TSTR_ENV_DATABASE_URL"))
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()), port.WithName("db"))
+	err := tstr.Run(
+		tstr.WithDeps(
+			p,
+			env.New(
+				env.WithSet("TSTR_ENV_DATABASE_URL", "postgres://{{.db.Addr}}/test"),
+				env.WithExport("db", "TSTR_ENV_DB_"),
+			),
+		),
+		tstr.WithFn(func() {
+			assertEnv(t, "TSTR_ENV_DATABASE_URL", "postgres://"+p.Addr()+"/test", true)
+			assertEnv(t, "TSTR_ENV_DB_PORT", p.String(), true)
+			assertEnv(t, "TSTR_ENV_DB_HOST", p.Host(), true)
+		}),
+	)
+	require.NoError(t, err)
+	assertEnv(t, "TSTR_ENV_DATABASE_URL", "", false)
+	assertEnv(t, "TSTR_ENV_DB_PORT", "", false)
+}
+
+func TestEnv_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  *env.Env
+		err  error
+	}{
+		{
+			name: "invalid_key",
+			env:  env.New(env.WithSet("A=B", "")),
+			err:  env.ErrOptApply,
+		},
+		{
+			name: "unresolved",
+			env:  env.New(env.WithSet("TSTR_ENV_ROLLBACK", "a"), env.WithSet("TSTR_ENV_UNRESOLVED", "${db.Port}")),
+			err:  expand.ErrUnresolved,
+		},
+		{
+			name: "missing_output",
+			env:  env.New(env.WithExport("db", "DB_")),
+			err:  env.ErrMissingOutput,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deptest.ErrorIs(t, tt.env, nil, tt.err)
+			assertEnv(t, "TSTR_ENV_ROLLBACK", "", false)
+		})
+	}
+}
+
+func assertEnv(t *testing.T, key, value string, ok bool) {
+	t.Helper()
+	v, found := os.LookupEnv(key)
+	assert.Equal(t, ok, found, key)
+	assert.Equal(t, value, v, key)
+}
@@ -0,0 +1,301 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/strerr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	ErrOptApply     = strerr.Error("failed to apply Opt")
+	ErrMissingProbe = strerr.Error("missing probe")
+	ErrUnreachable  = strerr.Error("external service unreachable")
+)
+
+// attemptTimeout limits a single probe attempt.
+const attemptTimeout = 2 * time.Second
+
+// Service is a service which is already running outside of the tests, such as a shared queue or a local database.
+// Starting it does nothing, Ready waits until all probes succeed.
+// If the service stays unreachable Ready fails, unless WithSkipIfUnreachable is used,
+// in which case the tests are expected to call SkipIfUnreachable.
+type Service struct {
+	opts     []Opt
+	name     string
+	probes   []probe
+	outputs  map[string]string
+	timeout  time.Duration
+	interval time.Duration
+	skip     bool
+	probed   bool
+	err      error
+}
+
+type probe struct {
+	name string
+	fn   func(context.Context) error
+}
+
+type Opt func(*Service) error
+
+// New creates new Service dependency.
+func New(opts ...Opt) *Service {
+	return &Service{opts: opts}
+}
+
+func (s *Service) Start() error {
+	s.probes, s.outputs = nil, map[string]string{}
+	s.timeout, s.interval, s.skip = 10*time.Second, 200*time.Millisecond, false
+	s.probed, s.err = false, nil
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+	if len(s.probes) == 0 {
+		return ErrMissingProbe
+	}
+	return nil
+}
+
+// Ready probes the service until all probes succeed or the timeout set with WithTimeout expires.
+func (s *Service) Ready() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	for {
+		err := s.probe(ctx)
+		if err == nil {
+			s.probed, s.err = true, nil
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.probed, s.err = true, fmt.Errorf("%w: %s: %w", ErrUnreachable, s.Name(), err)
+			if s.skip {
+				return nil
+			}
+			return s.err
+		case <-time.After(s.interval):
+		}
+	}
+}
+
+func (s *Service) Stop() error { return nil }
+
+// Name returns the name set with WithName or "external".
+func (s *Service) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "external"
+}
+
+// Outputs returns the endpoint of the service, such as Addr, Host and Port for WithTCP or URL for WithHTTP,
+// and the values set with WithOutputs, for example {{.external.Addr}}.
+func (s *Service) Outputs() map[string]string {
+	return maps.Clone(s.outputs)
+}
+
+// Reachable reports whether the last probing succeeded.
+func (s *Service) Reachable() bool {
+	return s.probed && s.err == nil
+}
+
+// Err returns the error of the last probing, which wraps ErrUnreachable, or nil if the service was reachable.
+func (s *Service) Err() error {
+	return s.err
+}
+
+// SkipIfUnreachable skips the test if the service was unreachable, see WithSkipIfUnreachable.
+func (s *Service) SkipIfUnreachable(t testing.TB) {
+	t.Helper()
+	if s.err != nil {
+		t.Skip(s.err.Error())
+	}
+}
+
+func (s *Service) probe(ctx context.Context) error {
+	var errs []error
+	for _, p := range s.probes {
+		attemptCtx, cancel := context.WithTimeout(ctx, attemptTimeout)
+		err := p.fn(attemptCtx)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) addProbe(name string, fn func(context.Context) error) {
+	s.probes = append(s.probes, probe{name: name, fn: fn})
+}
+
+func (s *Service) setAddr(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	s.outputs["Addr"], s.outputs["Host"], s.outputs["Port"] = addr, host, port
+	return nil
+}
+
+// WithName sets the name of the service which is used for its outputs and errors.
+func WithName(name string) Opt {
+	return func(s *Service) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithTCP probes that a TCP connection to addr can be established and publishes Addr, Host and Port.
+func WithTCP(addr string) Opt {
+	return func(s *Service) error {
+		if err := s.setAddr(addr); err != nil {
+			return err
+		}
+		s.addProbe("tcp "+addr, func(ctx context.Context) error {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		})
+		return nil
+	}
+}
+
+// WithHTTP probes that a GET request to rawURL returns 2xx status and publishes URL, Addr, Host and Port.
+func WithHTTP(rawURL string) Opt {
+	return WithHTTPClient(rawURL, &http.Client{})
+}
+
+// WithHTTPClient is like WithHTTP but makes the requests with client, for example to trust a test CA.
+func WithHTTPClient(rawURL string, client *http.Client) Opt {
+	return func(s *Service) error {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("unsupported URL scheme '%s'", u.Scheme)
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+		}
+		if err := s.setAddr(net.JoinHostPort(u.Hostname(), port)); err != nil {
+			return err
+		}
+		s.outputs["URL"] = strings.TrimSuffix(rawURL, "/")
+		s.addProbe("http "+rawURL, func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+			if err != nil {
+				return err
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return err
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				return fmt.Errorf("unexpected status %s", resp.Status)
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// WithGRPCHealth probes that the standard gRPC health service at addr reports service as serving
+// and publishes Addr, Host and Port. An empty service checks the overall health of the server.
+// The connection is made without TLS.
+func WithGRPCHealth(addr, service string) Opt {
+	return func(s *Service) error {
+		if err := s.setAddr(addr); err != nil {
+			return err
+		}
+		s.addProbe("grpc "+addr, func(ctx context.Context) (err error) {
+			conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+			if err != nil {
+				return err
+			}
+			defer func() { err = errors.Join(err, conn.Close()) }()
+			resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				return err
+			}
+			if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+				return fmt.Errorf("service '%s' is %s", service, resp.GetStatus())
+			}
+			return nil
+		})
+		return nil
+	}
+}
+
+// WithDNS probes that host resolves and publishes Host.
+func WithDNS(host string) Opt {
+	return func(s *Service) error {
+		s.outputs["Host"] = host
+		s.addProbe("dns "+host, func(ctx context.Context) error {
+			_, err := net.DefaultResolver.LookupHost(ctx, host)
+			return err
+		})
+		return nil
+	}
+}
+
+// WithProbe adds a custom probe, which is called until it returns nil.
+func WithProbe(name string, fn func(context.Context) error) Opt {
+	return func(s *Service) error {
+		s.addProbe(name, fn)
+		return nil
+	}
+}
+
+// WithOutputs publishes additional outputs, for example a DSN of a database.
+func WithOutputs(outputs map[string]string) Opt {
+	return func(s *Service) error {
+		maps.Copy(s.outputs, outputs)
+		return nil
+	}
+}
+
+// WithTimeout sets how long the service is probed before it's considered unreachable, defaults to 10 seconds.
+func WithTimeout(d time.Duration) Opt {
+	return func(s *Service) error {
+		s.timeout = d
+		return nil
+	}
+}
+
+// WithInterval sets the delay between the probing attempts, defaults to 200 milliseconds.
+func WithInterval(d time.Duration) Opt {
+	return func(s *Service) error {
+		s.interval = d
+		return nil
+	}
+}
+
+// WithSkipIfUnreachable makes Ready succeed even if the service is unreachable,
+// so that the tests can skip themselves with SkipIfUnreachable instead of failing the whole package.
+func WithSkipIfUnreachable() Opt {
+	return func(s *Service) error {
+		s.skip = true
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package external_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/external"
+	"github.com/go-tstr/tstr/dep/grpcserver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestService_Reachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		opt     external.Opt
+		outputs map[string]string
+	}{
+		{"tcp", external.WithTCP(l.Addr().String()), nil},
+		{"http", external.WithHTTP(srv.URL + "/"), map[string]string{"URL": srv.URL}},
+		{"dns", external.WithDNS("localhost"), map[string]string{"Host": "localhost"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := external.New(tt.opt, external.WithOutputs(map[string]string{"DSN": "dsn"}))
+			deptest.ErrorIs(t, s, func() {
+				assert.True(t, s.Reachable())
+				require.NoError(t, s.Err())
+				s.SkipIfUnreachable(t)
+				o := s.Outputs()
+				assert.Equal(t, "dsn", o["DSN"])
+				for k, v := range tt.outputs {
+					assert.Equal(t, v, o[k])
+				}
+			}, nil)
+		})
+	}
+
+	s := external.New(external.WithTCP(l.Addr().String()))
+	deptest.ErrorIs(t, s, func() {
+		host, port, err := net.SplitHostPort(l.Addr().String())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"Addr": l.Addr().String(), "Host": host, "Port": port}, s.Outputs())
+	}, nil)
+}
+
+func TestService_GRPCHealth(t *testing.T) {
+	backend := grpcserver.New()
+	deptest.ErrorIs(t, backend, func() {
+		s := external.New(external.WithGRPCHealth(backend.Addr(), ""), external.WithTimeout(500*time.Millisecond))
+		deptest.ErrorIs(t, s, func() {
+			assert.True(t, s.Reachable())
+		}, nil)
+
+		backend.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		deptest.ErrorIs(t, s, nil, external.ErrUnreachable)
+	}, nil)
+}
+
+func TestService_Unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	opts := []external.Opt{
+		external.WithName("queue"),
+		external.WithTCP(addr),
+		external.WithTimeout(100 * time.Millisecond),
+		external.WithInterval(10 * time.Millisecond),
+	}
+	deptest.ErrorIs(t, external.New(opts...), nil, external.ErrUnreachable)
+
+	s := external.New(append(opts, external.WithSkipIfUnreachable())...)
+	deptest.ErrorIs(t, s, func() {
+		assert.False(t, s.Reachable())
+		require.ErrorIs(t, s.Err(), external.ErrUnreachable)
+		assert.ErrorContains(t, s.Err(), "queue: tcp "+addr)
+
+		var skipped bool
+		t.Run("skip", func(t *testing.T) {
+			defer func() { skipped = t.Skipped() }()
+			s.SkipIfUnreachable(t)
+		})
+		assert.True(t, skipped)
+	}, nil)
+}
+
+func TestService_Probe(t *testing.T) {
+	calls := 0
+	s := external.New(
+		external.WithProbe("custom", func(context.Context) error {
+			calls++
+			if calls < 3 {
+				return errors.New("not yet")
+			}
+			return nil
+		}),
+		external.WithInterval(time.Millisecond),
+	)
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, 3, calls)
+	}, nil)
+}
+
+func TestService_Errors(t *testing.T) {
+	deptest.ErrorIs(t, external.New(), nil, external.ErrMissingProbe)
+	deptest.ErrorIs(t, external.New(external.WithTCP("no-port")), nil, external.ErrOptApply)
+	deptest.ErrorIs(t, external.New(external.WithHTTP("ftp://example.com")), nil, external.ErrOptApply)
+}
@@ -0,0 +1,225 @@
+package goroutine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply    = strerr.Error("failed to apply Opt")
+	ErrMissingFn   = strerr.Error("missing function")
+	ErrReadyFailed = strerr.Error("failed to verify readiness")
+	ErrExited      = strerr.Error("function returned before stop")
+	ErrPanic       = strerr.Error("function panicked")
+	ErrStopTimeout = strerr.Error("function didn't return before timeout")
+)
+
+// Goroutine runs a function in a goroutine until it's stopped.
+// The context passed to the function is canceled on Stop.
+type Goroutine struct {
+	opts         []Opt
+	name         string
+	fn           func(context.Context) error
+	ready        func(context.Context) error
+	readyTimeout time.Duration
+	stopTimeout  time.Duration
+	cancel       context.CancelFunc
+	done         chan struct{}
+
+	mu      sync.Mutex
+	err     error
+	stopped bool
+}
+
+type Opt func(*Goroutine) error
+
+// New creates new Goroutine dependency.
+func New(opts ...Opt) *Goroutine {
+	return &Goroutine{
+		opts:         opts,
+		ready:        func(context.Context) error { return nil },
+		readyTimeout: 30 * time.Second,
+		stopTimeout:  10 * time.Second,
+	}
+}
+
+func (g *Goroutine) Start() error {
+	for _, opt := range g.opts {
+		if err := opt(g); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if g.fn == nil {
+		return ErrMissingFn
+	}
+
+	var ctx context.Context
+	ctx, g.cancel = context.WithCancel(context.Background())
+	g.done = make(chan struct{})
+	g.err, g.stopped = nil, false
+	go g.run(ctx)
+	return nil
+}
+
+// Ready waits until the ready check succeeds.
+// It fails if the function returns or panics before it's ready.
+func (g *Goroutine) Ready() error {
+	ctx, cancel := context.WithTimeout(context.Background(), g.readyTimeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- g.ready(ctx) }()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrReadyFailed, err)
+		}
+		return g.Health()
+	case <-g.done:
+		return fmt.Errorf("%w: %w", ErrReadyFailed, g.Health())
+	case <-ctx.Done():
+		return fmt.Errorf("%w: timeout after %s", ErrReadyFailed, g.readyTimeout)
+	}
+}
+
+// Stop cancels the context of the function and waits until it returns.
+// Errors returned by the function are reported unless they are caused by the cancellation.
+func (g *Goroutine) Stop() error {
+	if g.cancel == nil {
+		return nil
+	}
+
+	err := g.Health()
+	g.mu.Lock()
+	g.stopped = true
+	g.mu.Unlock()
+	g.cancel()
+
+	select {
+	case <-g.done:
+	case <-time.After(g.stopTimeout):
+		return errors.Join(err, fmt.Errorf("%w: %s", ErrStopTimeout, g.stopTimeout))
+	}
+
+	if err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if errors.Is(g.err, context.Canceled) {
+		return nil
+	}
+	return g.err
+}
+
+// Name returns the name set with WithName or "goroutine".
+func (g *Goroutine) Name() string {
+	if g.name != "" {
+		return g.name
+	}
+	return "goroutine"
+}
+
+// Health returns an error wrapping ErrExited if the function returned before Stop was called
+// or ErrPanic if it panicked, and nil while it's running.
+func (g *Goroutine) Health() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	select {
+	case <-g.done:
+	default:
+		return nil
+	}
+	if g.stopped {
+		return nil
+	}
+	switch {
+	case g.err == nil:
+		return ErrExited
+	case errors.Is(g.err, ErrPanic):
+		return g.err
+	default:
+		return fmt.Errorf("%w: %w", ErrExited, g.err)
+	}
+}
+
+// Done returns a channel which is closed when the function returns.
+func (g *Goroutine) Done() <-chan struct{} {
+	return g.done
+}
+
+func (g *Goroutine) run(ctx context.Context) {
+	var err error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v\n%s", ErrPanic, r, debug.Stack())
+		}
+		g.mu.Lock()
+		g.err = err
+		g.mu.Unlock()
+		close(g.done)
+	}()
+	err = g.fn(ctx)
+}
+
+// WithName sets the name of the dependency.
+func WithName(name string) Opt {
+	return func(g *Goroutine) error {
+		g.name = name
+		return nil
+	}
+}
+
+// WithFn sets the function which is run in the goroutine.
+// The function should return when the context is canceled.
+func WithFn(fn func(context.Context) error) Opt {
+	return func(g *Goroutine) error {
+		g.fn = fn
+		return nil
+	}
+}
+
+// WithReadyChan makes Ready wait until ch is closed or receives a value.
+func WithReadyChan(ch <-chan struct{}) Opt {
+	return WithReadyFn(func(ctx context.Context) error {
+		select {
+		case <-ch:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// WithReadyFn sets the function which Ready calls to check if the function is ready.
+// The check is aborted if the function returns before it's ready.
+func WithReadyFn(fn func(context.Context) error) Opt {
+	return func(g *Goroutine) error {
+		g.ready = fn
+		return nil
+	}
+}
+
+// WithReadyTimeout sets the timeout for Ready, defaults to 30 seconds.
+func WithReadyTimeout(d time.Duration) Opt {
+	return func(g *Goroutine) error {
+		g.readyTimeout = d
+		return nil
+	}
+}
+
+// WithStopTimeout sets how long Stop waits for the function to return, defaults to 10 seconds.
+func WithStopTimeout(d time.Duration) Opt {
+	return func(g *Goroutine) error {
+		g.stopTimeout = d
+		return nil
+	}
+}
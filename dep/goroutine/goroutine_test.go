@@ -0,0 +1,150 @@
+package goroutine_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/goroutine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutine(t *testing.T) {
+	errFn := errors.New("fn error")
+	tests := []struct {
+		name string
+		opts []goroutine.Opt
+		err  error
+	}{
+		{
+			name: "MissingFn",
+			err:  goroutine.ErrMissingFn,
+		},
+		{
+			name: "ExitedBeforeReady",
+			opts: []goroutine.Opt{
+				goroutine.WithFn(func(context.Context) error { return errFn }),
+				goroutine.WithReadyChan(make(chan struct{})),
+			},
+			err: goroutine.ErrExited,
+		},
+		{
+			name: "PanicBeforeReady",
+			opts: []goroutine.Opt{
+				goroutine.WithFn(func(context.Context) error { panic("boom") }),
+				goroutine.WithReadyChan(make(chan struct{})),
+			},
+			err: goroutine.ErrPanic,
+		},
+		{
+			name: "ReadyTimeout",
+			opts: []goroutine.Opt{
+				goroutine.WithFn(blockUntilDone),
+				goroutine.WithReadyChan(make(chan struct{})),
+				goroutine.WithReadyTimeout(10 * time.Millisecond),
+			},
+			err: goroutine.ErrReadyFailed,
+		},
+		{
+			name: "StopTimeout",
+			opts: []goroutine.Opt{
+				goroutine.WithFn(func(context.Context) error { select {} }),
+				goroutine.WithStopTimeout(10 * time.Millisecond),
+			},
+			err: goroutine.ErrStopTimeout,
+		},
+		{
+			name: "StopError",
+			opts: []goroutine.Opt{
+				goroutine.WithFn(func(ctx context.Context) error {
+					<-ctx.Done()
+					return errFn
+				}),
+			},
+			err: errFn,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deptest.ErrorIs(t, goroutine.New(tt.opts...), nil, tt.err)
+		})
+	}
+}
+
+func TestGoroutine_ReadyChan(t *testing.T) {
+	ready := make(chan struct{})
+	g := goroutine.New(
+		goroutine.WithFn(func(ctx context.Context) error {
+			close(ready)
+			<-ctx.Done()
+			return ctx.Err()
+		}),
+		goroutine.WithReadyChan(ready),
+	)
+	deptest.ErrorIs(t, g, func() {
+		assert.NoError(t, g.Health())
+	}, nil)
+}
+
+func TestGoroutine_Health(t *testing.T) {
+	stop := make(chan struct{})
+	g := goroutine.New(goroutine.WithFn(func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		return nil
+	}))
+
+	require.NoError(t, g.Start())
+	require.NoError(t, g.Ready())
+	require.NoError(t, g.Health())
+
+	close(stop)
+	<-g.Done()
+	require.ErrorIs(t, g.Health(), goroutine.ErrExited)
+	require.ErrorIs(t, g.Stop(), goroutine.ErrExited)
+}
+
+func TestGoroutine_Server(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := &http.Server{ReadHeaderTimeout: time.Second}
+
+	g := goroutine.New(
+		goroutine.WithName("server"),
+		goroutine.WithFn(func(ctx context.Context) error {
+			go func() {
+				<-ctx.Done()
+				_ = srv.Close()
+			}()
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				return err
+			}
+			return nil
+		}),
+		goroutine.WithReadyFn(func(ctx context.Context) error {
+			var d net.Dialer
+			c, err := d.DialContext(ctx, "tcp", l.Addr().String())
+			if err != nil {
+				return err
+			}
+			return c.Close()
+		}),
+	)
+	deptest.ErrorIs(t, g, func() {
+		assert.Equal(t, "server", g.Name())
+		assert.NoError(t, g.Health())
+	}, nil)
+}
+
+func blockUntilDone(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,427 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/port"
+	"github.com/go-tstr/tstr/strerr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ErrOptApply    = strerr.Error("failed to apply Opt")
+	ErrListen      = strerr.Error("failed to listen")
+	ErrReadyFailed = strerr.Error("failed to verify readiness")
+)
+
+// Server is a gRPC server which serves the standard health service, registered service implementations
+// and dynamic handlers for unary methods. All calls are recorded.
+type Server struct {
+	opts         []Opt
+	name         string
+	port         *port.Port
+	serverOpts   []grpc.ServerOption
+	services     []service
+	reflection   bool
+	readyTimeout time.Duration
+	listener     net.Listener
+	server       *grpc.Server
+	health       *health.Server
+	done         chan error
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	calls    []Call
+}
+
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// Handler handles a unary call. The request is protobuf encoded, see Unary for a typed handler.
+type Handler func(ctx context.Context, req []byte) (proto.Message, error)
+
+// Call is a recorded call.
+type Call struct {
+	Time time.Time
+	// Method is the full method name, e.g. /pkg.Service/Method.
+	Method   string
+	Metadata metadata.MD
+	// Request is the protobuf encoded request, the first message of streaming calls.
+	Request []byte
+	Code    codes.Code
+	Message string
+}
+
+// Decode decodes the request of the call into m.
+func (c Call) Decode(m proto.Message) error {
+	return proto.Unmarshal(c.Request, m)
+}
+
+type Opt func(*Server) error
+
+// New creates new Server dependency.
+func New(opts ...Opt) *Server {
+	return &Server{opts: opts, readyTimeout: 10 * time.Second}
+}
+
+func (s *Server) Start() error {
+	s.serverOpts, s.services, s.reflection, s.calls = nil, nil, false, nil
+	s.handlers = map[string]Handler{}
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	addr := "127.0.0.1:0"
+	if s.port != nil {
+		if err := s.port.Release(); err != nil {
+			return fmt.Errorf("%w: %w", ErrListen, err)
+		}
+		addr = s.port.Addr()
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+	s.listener = l
+
+	s.server = grpc.NewServer(append([]grpc.ServerOption{
+		grpc.ForceServerCodec(codec{}),
+		grpc.UnknownServiceHandler(s.unknown),
+		grpc.ChainUnaryInterceptor(s.recordUnary),
+		grpc.ChainStreamInterceptor(s.recordStream),
+	}, s.serverOpts...)...)
+
+	s.health = health.NewServer()
+	healthpb.RegisterHealthServer(s.server, s.health)
+	for _, svc := range s.services {
+		s.server.RegisterService(svc.desc, svc.impl)
+		s.health.SetServingStatus(svc.desc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	}
+	for m := range s.handlers {
+		s.health.SetServingStatus(serviceName(m), healthpb.HealthCheckResponse_SERVING)
+	}
+	if s.reflection {
+		reflection.Register(s.server)
+	}
+
+	s.done = make(chan error, 1)
+	go func() { s.done <- s.server.Serve(l) }()
+	return nil
+}
+
+// Ready checks the overall serving status with the gRPC health service.
+func (s *Server) Ready() (err error) {
+	conn, err := s.NewClient()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadyFailed, err)
+	}
+	defer func() { err = errors.Join(err, conn.Close()) }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.readyTimeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrReadyFailed, err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("%w: status %s", ErrReadyFailed, resp.GetStatus())
+	}
+	return nil
+}
+
+// Stop stops the server, closing all connections.
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	s.server.Stop()
+	err := <-s.done
+	if errors.Is(err, grpc.ErrServerStopped) {
+		err = nil
+	}
+	if s.port != nil {
+		err = errors.Join(err, s.port.Close())
+	}
+	return err
+}
+
+// Name returns the name set with WithName or "grpc".
+func (s *Server) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "grpc"
+}
+
+// Outputs returns the Addr, Host and Port of the server, for example {{.grpc.Addr}}.
+func (s *Server) Outputs() map[string]string {
+	if s.listener == nil {
+		return nil
+	}
+	host, p, _ := net.SplitHostPort(s.Addr())
+	return map[string]string{"Addr": s.Addr(), "Host": host, "Port": p}
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// NewClient creates a client connection to the server without transport security.
+func (s *Server) NewClient(opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	return grpc.NewClient(s.Addr(), append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)...)
+}
+
+// SetServingStatus sets the status reported by the health service for service, "" is the overall status.
+func (s *Server) SetServingStatus(service string, st healthpb.HealthCheckResponse_ServingStatus) {
+	s.health.SetServingStatus(service, st)
+}
+
+// Handle sets the handler of the unary method, e.g. /pkg.Service/Method, replacing any previous handler.
+// Methods of services registered with WithService can't be handled dynamically.
+func (s *Server) Handle(method string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// Calls returns the recorded calls in the order they completed. Health checks and reflection calls are not recorded.
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls)
+}
+
+// CallsTo returns the recorded calls to method.
+func (s *Server) CallsTo(method string) []Call {
+	var calls []Call
+	for _, c := range s.Calls() {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Reset removes the recorded calls.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = nil
+}
+
+// unknown serves the methods which are not part of registered services with the dynamic handlers.
+func (s *Server) unknown(_ any, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var req rawMessage
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	h, ok := s.handlers[method]
+	s.mu.Unlock()
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "no handler for method %s", method)
+	}
+	resp, err := h(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(resp)
+}
+
+func (s *Server) recordUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	var b []byte
+	if m, ok := req.(proto.Message); ok {
+		b, _ = proto.Marshal(m)
+	}
+	s.record(ctx, info.FullMethod, b, err)
+	return resp, err
+}
+
+func (s *Server) recordStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rs := &recordingStream{ServerStream: ss}
+	err := handler(srv, rs)
+	s.record(ss.Context(), info.FullMethod, rs.first, err)
+	return err
+}
+
+func (s *Server) record(ctx context.Context, method string, req []byte, err error) {
+	if strings.HasPrefix(method, "/grpc.health.v1.") || strings.HasPrefix(method, "/grpc.reflection.") {
+		return
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	st := status.Convert(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, Call{
+		Time:     time.Now(),
+		Method:   method,
+		Metadata: md.Copy(),
+		Request:  req,
+		Code:     st.Code(),
+		Message:  st.Message(),
+	})
+}
+
+// recordingStream keeps the first received message.
+type recordingStream struct {
+	grpc.ServerStream
+	first    []byte
+	received bool
+}
+
+func (rs *recordingStream) RecvMsg(m any) error {
+	if err := rs.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if !rs.received {
+		rs.received = true
+		switch m := m.(type) {
+		case *rawMessage:
+			rs.first = *m
+		case proto.Message:
+			rs.first, _ = proto.Marshal(m)
+		}
+	}
+	return nil
+}
+
+// rawMessage is a protobuf encoded message which is passed through the codec as is.
+type rawMessage []byte
+
+// codec is the proto codec which also handles rawMessage.
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case *rawMessage:
+		return *v, nil
+	case proto.Message:
+		return proto.Marshal(v)
+	default:
+		return nil, fmt.Errorf("unsupported message type %T", v)
+	}
+}
+
+func (codec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *rawMessage:
+		*v = slices.Clone(data)
+		return nil
+	case proto.Message:
+		return proto.Unmarshal(data, v)
+	default:
+		return fmt.Errorf("unsupported message type %T", v)
+	}
+}
+
+func (codec) Name() string { return "proto" }
+
+// serviceName returns the service of the full method name /pkg.Service/Method.
+func serviceName(method string) string {
+	svc, _, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	return svc
+}
+
+// Unary returns a handler which decodes the request into Req and calls fn.
+func Unary[Req proto.Message, Resp proto.Message](fn func(context.Context, Req) (Resp, error)) Handler {
+	return func(ctx context.Context, b []byte) (proto.Message, error) {
+		var zero Req
+		req, ok := zero.ProtoReflect().Type().New().Interface().(Req)
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported request type %T", zero)
+		}
+		if err := proto.Unmarshal(b, req); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+		}
+		return fn(ctx, req)
+	}
+}
+
+// Respond returns a handler which always responds with m.
+func Respond(m proto.Message) Handler {
+	return func(context.Context, []byte) (proto.Message, error) { return m, nil }
+}
+
+// Fail returns a handler which always fails with code and msg.
+func Fail(code codes.Code, msg string) Handler {
+	return func(context.Context, []byte) (proto.Message, error) { return nil, status.Error(code, msg) }
+}
+
+// WithName sets the name of the server which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *Server) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithPort sets the port the server listens on.
+func WithPort(p *port.Port) Opt {
+	return func(s *Server) error {
+		s.port = p
+		return nil
+	}
+}
+
+// WithService registers a service implementation, e.g. WithService(&pb.Greeter_ServiceDesc, impl).
+func WithService(desc *grpc.ServiceDesc, impl any) Opt {
+	return func(s *Server) error {
+		s.services = append(s.services, service{desc: desc, impl: impl})
+		return nil
+	}
+}
+
+// WithHandler sets the handler of the unary method, see Server.Handle.
+func WithHandler(method string, h Handler) Opt {
+	return func(s *Server) error {
+		s.handlers[method] = h
+		return nil
+	}
+}
+
+// WithReflection registers the server reflection service, which allows using tools like grpcurl.
+func WithReflection() Opt {
+	return func(s *Server) error {
+		s.reflection = true
+		return nil
+	}
+}
+
+// WithReadyTimeout sets the timeout of the health check in Ready, defaults to 10 seconds.
+func WithReadyTimeout(d time.Duration) Opt {
+	return func(s *Server) error {
+		s.readyTimeout = d
+		return nil
+	}
+}
+
+// WithServerOpts sets additional options of the underlying grpc.Server.
+func WithServerOpts(opts ...grpc.ServerOption) Opt {
+	return func(s *Server) error {
+		s.serverOpts = append(s.serverOpts, opts...)
+		return nil
+	}
+}
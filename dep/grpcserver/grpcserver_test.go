@@ -0,0 +1,134 @@
+package grpcserver_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/grpcserver"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const unaryCall = "/grpc.testing.TestService/UnaryCall"
+
+func TestServer_Handlers(t *testing.T) {
+	s := grpcserver.New(
+		grpcserver.WithName("backend"),
+		grpcserver.WithHandler(unaryCall, grpcserver.Unary(func(_ context.Context, req *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			return &testpb.SimpleResponse{Username: "user", Payload: req.GetPayload()}, nil
+		})),
+	)
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, s.Addr(), s.Outputs()["Addr"])
+		client := testpb.NewTestServiceClient(dial(t, s))
+
+		ctx := metadata.AppendToOutgoingContext(t.Context(), "x-request-id", "1")
+		resp, err := client.UnaryCall(ctx, &testpb.SimpleRequest{Payload: &testpb.Payload{Body: []byte("hello")}})
+		require.NoError(t, err)
+		assert.Equal(t, "user", resp.GetUsername())
+		assert.Equal(t, []byte("hello"), resp.GetPayload().GetBody())
+
+		s.Handle(unaryCall, grpcserver.Fail(codes.Unavailable, "down"))
+		_, err = client.UnaryCall(t.Context(), &testpb.SimpleRequest{})
+		assert.Equal(t, codes.Unavailable, status.Code(err))
+
+		s.Handle(unaryCall, grpcserver.Respond(&testpb.SimpleResponse{Username: "static"}))
+		resp, err = client.UnaryCall(t.Context(), &testpb.SimpleRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, "static", resp.GetUsername())
+
+		_, err = client.EmptyCall(t.Context(), &testpb.Empty{})
+		assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+		calls := s.CallsTo(unaryCall)
+		require.Len(t, calls, 3)
+		assert.Equal(t, []string{"1"}, calls[0].Metadata.Get("x-request-id"))
+		assert.Equal(t, codes.OK, calls[0].Code)
+		assert.Equal(t, codes.Unavailable, calls[1].Code)
+		assert.Equal(t, "down", calls[1].Message)
+		var req testpb.SimpleRequest
+		require.NoError(t, calls[0].Decode(&req))
+		assert.Equal(t, []byte("hello"), req.GetPayload().GetBody())
+		assert.Len(t, s.Calls(), 4)
+
+		s.Reset()
+		assert.Empty(t, s.Calls())
+	}, nil)
+}
+
+type testService struct {
+	testpb.UnimplementedTestServiceServer
+}
+
+func (testService) EmptyCall(context.Context, *testpb.Empty) (*testpb.Empty, error) {
+	return &testpb.Empty{}, nil
+}
+
+func (testService) StreamingInputCall(stream grpc.ClientStreamingServer[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse]) error {
+	size := 0
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&testpb.StreamingInputCallResponse{AggregatedPayloadSize: int32(size)})
+		}
+		if err != nil {
+			return err
+		}
+		size += len(req.GetPayload().GetBody())
+	}
+}
+
+func TestServer_Service(t *testing.T) {
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()), port.WithName("grpcserver"))
+	s := grpcserver.New(grpcserver.WithPort(p), grpcserver.WithService(&testpb.TestService_ServiceDesc, testService{}), grpcserver.WithReflection())
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, p.Addr(), s.Addr())
+		conn := dial(t, s)
+		client := testpb.NewTestServiceClient(conn)
+
+		_, err := client.EmptyCall(t.Context(), &testpb.Empty{})
+		require.NoError(t, err)
+
+		stream, err := client.StreamingInputCall(t.Context())
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte("abc")}}))
+		require.NoError(t, stream.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte("de")}}))
+		resp, err := stream.CloseAndRecv()
+		require.NoError(t, err)
+		assert.Equal(t, int32(5), resp.GetAggregatedPayloadSize())
+
+		calls := s.Calls()
+		require.Len(t, calls, 2)
+		assert.Equal(t, "/grpc.testing.TestService/EmptyCall", calls[0].Method)
+		var req testpb.StreamingInputCallRequest
+		require.NoError(t, calls[1].Decode(&req))
+		assert.Equal(t, []byte("abc"), req.GetPayload().GetBody())
+
+		health := healthpb.NewHealthClient(conn)
+		hr, err := health.Check(t.Context(), &healthpb.HealthCheckRequest{Service: "grpc.testing.TestService"})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, hr.GetStatus())
+
+		s.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		require.ErrorIs(t, s.Ready(), grpcserver.ErrReadyFailed)
+		assert.Len(t, s.Calls(), 2)
+	}, nil)
+}
+
+func dial(t *testing.T, s *grpcserver.Server) *grpc.ClientConn {
+	t.Helper()
+	conn, err := s.NewClient()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
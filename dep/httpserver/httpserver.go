@@ -0,0 +1,307 @@
+package httpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/port"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply = strerr.Error("failed to apply Opt")
+	ErrListen   = strerr.Error("failed to listen")
+)
+
+// Server is an in-process HTTP server backed by httptest.Server.
+// It records every request it receives, see Requests.
+type Server struct {
+	opts     []Opt
+	name     string
+	handler  http.Handler
+	mux      *http.ServeMux
+	tls      bool
+	http2    bool
+	port     *port.Port
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []Request
+}
+
+// Request is a recorded request.
+type Request struct {
+	Time   time.Time   `json:"time"`
+	Method string      `json:"method"`
+	URL    *url.URL    `json:"url"`
+	Proto  string      `json:"proto"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// Response is a canned response, see WithRoute.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   string
+}
+
+type Opt func(*Server) error
+
+// New creates new Server dependency.
+// Requests which don't match any route or handler get 404 response.
+func New(opts ...Opt) *Server {
+	return &Server{opts: opts}
+}
+
+func (s *Server) Start() error {
+	s.mux = http.NewServeMux()
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	s.server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	if s.port != nil {
+		if err := s.listen(); err != nil {
+			return fmt.Errorf("%w: %w", ErrListen, err)
+		}
+	}
+
+	if s.tls {
+		s.server.EnableHTTP2 = s.http2
+		s.server.StartTLS()
+		return nil
+	}
+
+	if s.http2 {
+		s.server.Config.Protocols = &http.Protocols{}
+		s.server.Config.Protocols.SetHTTP1(true)
+		s.server.Config.Protocols.SetUnencryptedHTTP2(true)
+	}
+	s.server.Start()
+	return nil
+}
+
+func (s *Server) Ready() error { return nil }
+
+func (s *Server) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	s.server.Close()
+	if s.port != nil {
+		return s.port.Close()
+	}
+	return nil
+}
+
+// Name returns the name set with WithName or "httpserver".
+func (s *Server) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "httpserver"
+}
+
+// Outputs returns the URL, Addr, Host and Port of the server, for example {{.httpserver.URL}}.
+func (s *Server) Outputs() map[string]string {
+	if s.server == nil {
+		return nil
+	}
+	host, p, _ := net.SplitHostPort(s.server.Listener.Addr().String())
+	return map[string]string{
+		"URL":  s.server.URL,
+		"Addr": s.server.Listener.Addr().String(),
+		"Host": host,
+		"Port": p,
+	}
+}
+
+// URL returns the base URL of the server or empty string if the server hasn't been started.
+func (s *Server) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL
+}
+
+// Client returns a client configured to trust the TLS certificate of the server and to use HTTP/2 if enabled,
+// or a plain client if the server hasn't been started.
+func (s *Server) Client() *http.Client {
+	if s.server == nil {
+		return &http.Client{}
+	}
+	c := s.server.Client()
+	if s.http2 && !s.tls {
+		if t, ok := c.Transport.(*http.Transport); ok {
+			t.Protocols = &http.Protocols{}
+			t.Protocols.SetUnencryptedHTTP2(true)
+		}
+	}
+	return c
+}
+
+// Server returns the underlying httptest.Server.
+func (s *Server) Server() *httptest.Server {
+	return s.server
+}
+
+// Requests returns the recorded requests in the order they were received.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.requests)
+}
+
+// Reset clears the recorded requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+}
+
+// CollectArtifacts writes the recorded requests into requests.json.
+func (s *Server) CollectArtifacts(dir string) error {
+	b, err := json.MarshalIndent(s.Requests(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "requests.json"), b, 0o600)
+}
+
+// listen replaces the listener opened by httptest with one bound to the port set with WithPort.
+func (s *Server) listen() error {
+	if err := errors.Join(s.server.Listener.Close(), s.port.Release()); err != nil {
+		return err
+	}
+	l, err := net.Listen(string(s.port.Network()), s.port.Addr())
+	if err != nil {
+		return err
+	}
+	s.server.Listener = l
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Time:   time.Now(),
+		Method: r.Method,
+		URL:    r.URL,
+		Proto:  r.Proto,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	s.mu.Unlock()
+
+	if _, pattern := s.mux.Handler(r); pattern != "" || s.handler == nil {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+	s.handler.ServeHTTP(w, r)
+}
+
+// WithName sets the name of the server which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *Server) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithHandler sets the handler for requests which don't match any route set with WithRoute.
+func WithHandler(h http.Handler) Opt {
+	return func(s *Server) error {
+		if h == nil {
+			return errors.New("nil handler")
+		}
+		s.handler = h
+		return nil
+	}
+}
+
+// WithRoute responds with r to requests matching pattern.
+// The pattern uses http.ServeMux syntax, for example "GET /users/{id}".
+// Routes take precedence over the handler set with WithHandler.
+func WithRoute(pattern string, r Response) Opt {
+	return func(s *Server) (err error) {
+		// ServeMux panics on invalid and conflicting patterns.
+		defer func() {
+			if v := recover(); v != nil {
+				err = fmt.Errorf("invalid pattern %q: %v", pattern, v)
+			}
+		}()
+		s.mux.HandleFunc(pattern, func(w http.ResponseWriter, _ *http.Request) {
+			for k, v := range r.Header {
+				w.Header()[k] = v
+			}
+			status := r.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, r.Body)
+		})
+		return nil
+	}
+}
+
+// WithJSONRoute responds with status and v encoded as JSON to requests matching pattern, see WithRoute.
+func WithJSONRoute(pattern string, status int, v any) Opt {
+	return func(s *Server) error {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return WithRoute(pattern, Response{
+			Status: status,
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body:   string(b),
+		})(s)
+	}
+}
+
+// WithTLS serves HTTPS with a self-signed certificate, see Client.
+func WithTLS() Opt {
+	return func(s *Server) error {
+		s.tls = true
+		return nil
+	}
+}
+
+// WithHTTP2 enables HTTP/2. Without TLS the server accepts unencrypted HTTP/2 with prior knowledge.
+func WithHTTP2() Opt {
+	return func(s *Server) error {
+		s.http2 = true
+		return nil
+	}
+}
+
+// WithPort makes the server listen on a port reserved with the port package.
+// The port is closed when the server is stopped.
+func WithPort(p *port.Port) Opt {
+	return func(s *Server) error {
+		s.port = p
+		return nil
+	}
+}
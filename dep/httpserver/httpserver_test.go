@@ -0,0 +1,126 @@
+package httpserver_test
+
+import (
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/cmd"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []httpserver.Opt
+		proto string
+	}{
+		{name: "HTTP", proto: "HTTP/1.1"},
+		{name: "HTTP2", opts: []httpserver.Opt{httpserver.WithHTTP2()}, proto: "HTTP/2.0"},
+		{name: "TLS", opts: []httpserver.Opt{httpserver.WithTLS()}, proto: "HTTP/1.1"},
+		{name: "TLS_HTTP2", opts: []httpserver.Opt{httpserver.WithTLS(), httpserver.WithHTTP2()}, proto: "HTTP/2.0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := httpserver.New(append(tt.opts,
+				httpserver.WithRoute("GET /users/{id}", httpserver.Response{
+					Status: http.StatusAccepted,
+					Header: http.Header{"X-Test": {"test"}},
+					Body:   "user",
+				}),
+				httpserver.WithJSONRoute("POST /items", http.StatusCreated, map[string]string{"id": "1"}),
+				httpserver.WithHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = io.WriteString(w, "fallback "+r.URL.Path)
+				})),
+			)...)
+
+			deptest.ErrorIs(t, s, func() {
+				c := s.Client()
+				assertResponse(t, c, http.MethodGet, s.URL()+"/users/1", http.StatusAccepted, "user")
+				assertResponse(t, c, http.MethodPost, s.URL()+"/items", http.StatusCreated, `{"id":"1"}`)
+				assertResponse(t, c, http.MethodGet, s.URL()+"/other", http.StatusOK, "fallback /other")
+
+				reqs := s.Requests()
+				require.Len(t, reqs, 3)
+				assert.Equal(t, http.MethodPost, reqs[1].Method)
+				assert.Equal(t, "/items", reqs[1].URL.Path)
+				assert.Equal(t, "body", string(reqs[1].Body))
+				assert.Equal(t, tt.proto, reqs[0].Proto)
+
+				s.Reset()
+				assert.Empty(t, s.Requests())
+				assert.Equal(t, s.URL(), s.Outputs()["URL"])
+			}, nil)
+		})
+	}
+}
+
+func TestServer_NotFound(t *testing.T) {
+	s := httpserver.New()
+	assert.Empty(t, s.URL())
+	assert.NotNil(t, s.Client())
+	deptest.ErrorIs(t, s, func() {
+		assertResponse(t, s.Client(), http.MethodGet, s.URL(), http.StatusNotFound, "404 page not found\n")
+	}, nil)
+}
+
+func TestServer_Errors(t *testing.T) {
+	deptest.ErrorIs(t, httpserver.New(httpserver.WithRoute("bad pattern here", httpserver.Response{})), nil, httpserver.ErrOptApply)
+	deptest.ErrorIs(t, httpserver.New(httpserver.WithHandler(nil)), nil, httpserver.ErrOptApply)
+}
+
+func TestServer_Cmd(t *testing.T) {
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()))
+	s := httpserver.New(
+		httpserver.WithName("api"),
+		httpserver.WithPort(p),
+		httpserver.WithRoute("GET /", httpserver.Response{Body: "ok"}),
+	)
+	err := tstr.Run(
+		tstr.WithDeps(
+			s,
+			cmd.New(
+				cmd.WithCommand("go", "env", "GOPROXY"),
+				cmd.WithEnvAppend("GOPROXY={{.api.URL}}"),
+				cmd.WithWaitMatchingLine("^http://"+p.Addr()+"$"),
+				cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+			),
+		),
+		tstr.WithFn(func() {
+			assert.Equal(t, "http://"+p.Addr(), s.URL())
+		}),
+	)
+	require.NoError(t, err)
+}
+
+func TestServer_CollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	s := httpserver.New()
+	deptest.ErrorIs(t, s, func() {
+		assertResponse(t, s.Client(), http.MethodGet, s.URL(), http.StatusNotFound, "404 page not found\n")
+		require.NoError(t, s.CollectArtifacts(dir))
+	}, nil)
+	assert.FileExists(t, filepath.Join(dir, "requests.json"))
+}
+
+func assertResponse(t *testing.T, c *http.Client, method, url string, status int, body string) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, url, strings.NewReader("body"))
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, status, resp.StatusCode)
+	assert.Equal(t, body, string(b))
+}
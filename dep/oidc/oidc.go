@@ -0,0 +1,400 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply     = strerr.Error("failed to apply Opt")
+	ErrKey          = strerr.Error("failed to generate signing key")
+	ErrInvalidToken = strerr.Error("invalid token")
+	ErrNotStarted   = strerr.Error("provider not started")
+)
+
+// Provider is a fake OpenID Connect provider which issues RS256 signed JWTs.
+// It serves discovery, JWKS, token and userinfo endpoints.
+type Provider struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+	clients    map[string]string
+	users      map[string]User
+	audience   []string
+	ttl        time.Duration
+
+	mu   sync.RWMutex
+	keys []*key
+}
+
+// User is a user which can get tokens with the password grant.
+type User struct {
+	Password string
+	// Claims are added to the tokens and userinfo of the user. The subject defaults to the username.
+	Claims Claims
+}
+
+// Claims are the claims of a token.
+// Values of type time.Time are encoded as Unix timestamps.
+type Claims map[string]any
+
+type Opt func(*Provider) error
+
+// New creates new Provider dependency.
+func New(opts ...Opt) *Provider {
+	return &Provider{
+		opts: opts,
+		ttl:  time.Hour,
+	}
+}
+
+func (p *Provider) Start() error {
+	p.serverOpts, p.clients, p.users, p.audience, p.keys = nil, map[string]string{}, map[string]User{}, nil, nil
+	for _, opt := range p.opts {
+		if err := opt(p); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if err := p.RotateKey(); err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("GET /jwks", p.jwks)
+	mux.HandleFunc("POST /token", p.token)
+	mux.HandleFunc("GET /userinfo", p.userinfo)
+	p.server = httpserver.New(append(slices.Clone(p.serverOpts), httpserver.WithHandler(mux))...)
+	return p.server.Start()
+}
+
+func (p *Provider) Ready() error { return nil }
+
+func (p *Provider) Stop() error {
+	if p.server == nil {
+		return nil
+	}
+	return p.server.Stop()
+}
+
+// Name returns the name set with WithName or "oidc".
+func (p *Provider) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "oidc"
+}
+
+// Outputs returns the outputs of the underlying server with Issuer, JWKSURL and TokenURL,
+// for example {{.oidc.Issuer}}.
+func (p *Provider) Outputs() map[string]string {
+	if p.server == nil {
+		return nil
+	}
+	o := p.server.Outputs()
+	o["Issuer"] = p.Issuer()
+	o["JWKSURL"] = p.Issuer() + "/jwks"
+	o["TokenURL"] = p.Issuer() + "/token"
+	return o
+}
+
+// Issuer returns the issuer URL, which is also the base URL of the provider,
+// or an empty string if the provider hasn't been started.
+func (p *Provider) Issuer() string {
+	if p.server == nil {
+		return ""
+	}
+	return p.server.URL()
+}
+
+// Client returns a client for calling the provider, see httpserver.Server.Client,
+// or a plain client if the provider hasn't been started.
+func (p *Provider) Client() *http.Client {
+	if p.server == nil {
+		return &http.Client{}
+	}
+	return p.server.Client()
+}
+
+// Token mints a token signed with the current key.
+// The iss, iat, exp and aud claims default to the issuer, current time, token TTL and the audience set with WithAudience,
+// and can be overridden with claims. It returns ErrNotStarted if the provider hasn't been started.
+func (p *Provider) Token(claims Claims) (string, error) {
+	if p.server == nil {
+		return "", ErrNotStarted
+	}
+	now := time.Now()
+	c := Claims{
+		"iss": p.Issuer(),
+		"iat": now.Unix(),
+		"exp": now.Add(p.ttl).Unix(),
+	}
+	if len(p.audience) > 0 {
+		c["aud"] = p.audience
+	}
+	for k, v := range claims {
+		if t, ok := v.(time.Time); ok {
+			v = t.Unix()
+		}
+		c[k] = v
+	}
+
+	p.mu.RLock()
+	k := p.keys[0]
+	p.mu.RUnlock()
+	return k.sign(c)
+}
+
+// MustToken is like Token but panics on error.
+func (p *Provider) MustToken(claims Claims) string {
+	t, err := p.Token(claims)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Verify verifies the signature and expiry of token against the keys in JWKS and returns its claims.
+func (p *Provider) Verify(token string) (Claims, error) {
+	p.mu.RLock()
+	keys := slices.Clone(p.keys)
+	p.mu.RUnlock()
+
+	c, err := verify(token, keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return c, nil
+}
+
+// RotateKey generates a new signing key. The previous keys stay in JWKS so that existing tokens remain valid,
+// use RemovePreviousKeys to remove them.
+func (p *Provider) RotateKey() error {
+	k, err := newKey()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKey, err)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = append([]*key{k}, p.keys...)
+	return nil
+}
+
+// RemovePreviousKeys removes all but the current signing key from JWKS.
+func (p *Provider) RemovePreviousKeys() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = p.keys[:1]
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	iss := p.Issuer()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                iss,
+		"jwks_uri":                              iss + "/jwks",
+		"token_endpoint":                        iss + "/token",
+		"userinfo_endpoint":                     iss + "/userinfo",
+		"grant_types_supported":                 []string{"client_credentials", "password"},
+		"response_types_supported":              []string{"token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, _ *http.Request) {
+	p.mu.RLock()
+	keys := make([]jwk, 0, len(p.keys))
+	for _, k := range p.keys {
+		keys = append(keys, k.jwk())
+	}
+	p.mu.RUnlock()
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if !p.validClient(clientID, secret) {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	access, id, code := p.grant(r.PostForm, clientID)
+	if code != "" {
+		tokenError(w, http.StatusBadRequest, code)
+		return
+	}
+	resp, err := p.tokenResponse(access, id)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// grant returns the claims of the access token and, for the password grant, of the ID token,
+// or the OAuth error code if the grant is invalid.
+func (p *Provider) grant(form url.Values, clientID string) (access, id Claims, code string) {
+	access = Claims{"sub": clientID, "client_id": clientID}
+	if scope := form.Get("scope"); scope != "" {
+		access["scope"] = scope
+	}
+	if aud := form["audience"]; len(aud) > 0 {
+		access["aud"] = aud
+	}
+
+	switch form.Get("grant_type") {
+	case "client_credentials":
+		return access, nil, ""
+	case "password":
+		username := form.Get("username")
+		u, ok := p.users[username]
+		if !ok || subtle.ConstantTimeCompare([]byte(u.Password), []byte(form.Get("password"))) != 1 {
+			return nil, nil, "invalid_grant"
+		}
+		access["sub"] = username
+		maps.Copy(access, u.Claims)
+
+		// The ID token is issued to the client, so its audience is the client ID.
+		id = Claims{"sub": username, "auth_time": time.Now()}
+		maps.Copy(id, u.Claims)
+		id["aud"], id["azp"] = clientID, clientID
+		return access, id, ""
+	default:
+		return nil, nil, "unsupported_grant_type"
+	}
+}
+
+func (p *Provider) tokenResponse(access, id Claims) (map[string]any, error) {
+	token, err := p.Token(access)
+	if err != nil {
+		return nil, err
+	}
+	resp := map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(p.ttl.Seconds()),
+	}
+	if scope, ok := access["scope"]; ok {
+		resp["scope"] = scope
+	}
+	if id != nil {
+		if resp["id_token"], err = p.Token(id); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (p *Provider) userinfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		tokenError(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+	claims, err := p.Verify(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		tokenError(w, http.StatusUnauthorized, "invalid_token")
+		return
+	}
+
+	info := Claims{"sub": claims["sub"]}
+	if sub, ok := claims["sub"].(string); ok {
+		if u, ok := p.users[sub]; ok {
+			maps.Copy(info, u.Claims)
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// validClient reports whether the client credentials are valid. All clients are accepted if none are configured.
+func (p *Provider) validClient(id, secret string) bool {
+	if len(p.clients) == 0 {
+		return true
+	}
+	s, ok := p.clients[id]
+	return ok && subtle.ConstantTimeCompare([]byte(s), []byte(secret)) == 1
+}
+
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// WithName sets the name of the provider which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(p *Provider) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithClient adds a client for the client credentials grant and for authenticating the password grant.
+// If no clients are added all client credentials are accepted.
+func WithClient(id, secret string) Opt {
+	return func(p *Provider) error {
+		p.clients[id] = secret
+		return nil
+	}
+}
+
+// WithUser adds a user for the password grant.
+func WithUser(username string, u User) Opt {
+	return func(p *Provider) error {
+		p.users[username] = u
+		return nil
+	}
+}
+
+// WithAudience sets the default audience of the tokens.
+func WithAudience(aud ...string) Opt {
+	return func(p *Provider) error {
+		p.audience = aud
+		return nil
+	}
+}
+
+// WithTokenTTL sets the lifetime of the tokens, defaults to one hour.
+func WithTokenTTL(d time.Duration) Opt {
+	return func(p *Provider) error {
+		p.ttl = d
+		return nil
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithTLS.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(p *Provider) error {
+		p.serverOpts = append(p.serverOpts, opts...)
+		return nil
+	}
+}
@@ -0,0 +1,215 @@
+package oidc_test
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/cmd"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/dep/oidc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvider(t *testing.T) {
+	p := oidc.New(
+		oidc.WithClient("service", "secret"),
+		oidc.WithUser("alice", oidc.User{Password: "pw", Claims: oidc.Claims{"email": "alice@example.com"}}),
+		oidc.WithAudience("api"),
+		oidc.WithServerOpts(httpserver.WithTLS()),
+	)
+	assert.Empty(t, p.Issuer())
+	_, err := p.Token(nil)
+	require.ErrorIs(t, err, oidc.ErrNotStarted)
+
+	deptest.ErrorIs(t, p, func() {
+		var discovery map[string]any
+		getJSON(t, p, p.Issuer()+"/.well-known/openid-configuration", "", &discovery)
+		assert.Equal(t, p.Issuer(), discovery["issuer"])
+		assert.Equal(t, p.Outputs()["JWKSURL"], discovery["jwks_uri"])
+
+		t.Run("ClientCredentials", func(t *testing.T) {
+			resp := token(t, p, url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"secret"}, "scope": {"read"}})
+			require.Equal(t, http.StatusOK, resp.status)
+			claims := verifyWithJWKS(t, p, resp.str(t, "access_token"))
+			assert.Equal(t, "service", claims["sub"])
+			assert.Equal(t, "read", claims["scope"])
+			assert.Equal(t, []any{"api"}, claims["aud"])
+			assert.Equal(t, p.Issuer(), claims["iss"])
+			assert.NotContains(t, resp.body, "id_token")
+		})
+
+		t.Run("Password", func(t *testing.T) {
+			resp := token(t, p, url.Values{"grant_type": {"password"}, "client_id": {"service"}, "client_secret": {"secret"}, "username": {"alice"}, "password": {"pw"}})
+			require.Equal(t, http.StatusOK, resp.status)
+			access := resp.str(t, "access_token")
+			assert.Equal(t, "alice@example.com", verifyWithJWKS(t, p, access)["email"])
+
+			id := verifyWithJWKS(t, p, resp.str(t, "id_token"))
+			assert.Equal(t, "alice", id["sub"])
+			assert.Equal(t, "service", id["aud"])
+			assert.Equal(t, "service", id["azp"])
+			assert.Equal(t, "alice@example.com", id["email"])
+			assert.Equal(t, p.Issuer(), id["iss"])
+			assert.Contains(t, id, "auth_time")
+			assert.NotContains(t, id, "client_id")
+
+			var info map[string]any
+			getJSON(t, p, p.Issuer()+"/userinfo", access, &info)
+			assert.Equal(t, map[string]any{"sub": "alice", "email": "alice@example.com"}, info)
+		})
+
+		t.Run("Errors", func(t *testing.T) {
+			resp := token(t, p, url.Values{"grant_type": {"client_credentials"}, "client_id": {"service"}, "client_secret": {"wrong"}})
+			assert.Equal(t, http.StatusUnauthorized, resp.status)
+			assert.Equal(t, "invalid_client", resp.body["error"])
+
+			resp = token(t, p, url.Values{"grant_type": {"password"}, "client_id": {"service"}, "client_secret": {"secret"}, "username": {"alice"}, "password": {"wrong"}})
+			assert.Equal(t, "invalid_grant", resp.body["error"])
+
+			resp = token(t, p, url.Values{"grant_type": {"implicit"}, "client_id": {"service"}, "client_secret": {"secret"}})
+			assert.Equal(t, "unsupported_grant_type", resp.body["error"])
+		})
+
+		t.Run("Token", func(t *testing.T) {
+			tok := p.MustToken(oidc.Claims{"sub": "custom", "aud": "other", "roles": []string{"admin"}})
+			claims, err := p.Verify(tok)
+			require.NoError(t, err)
+			assert.Equal(t, "other", claims["aud"])
+			assert.Equal(t, []any{"admin"}, claims["roles"])
+
+			expired := p.MustToken(oidc.Claims{"exp": time.Now().Add(-time.Minute)})
+			_, err = p.Verify(expired)
+			require.ErrorIs(t, err, oidc.ErrInvalidToken)
+		})
+
+		t.Run("RotateKey", func(t *testing.T) {
+			old := p.MustToken(nil)
+			require.NoError(t, p.RotateKey())
+			verifyWithJWKS(t, p, old)
+			verifyWithJWKS(t, p, p.MustToken(nil))
+
+			p.RemovePreviousKeys()
+			_, err := p.Verify(old)
+			require.ErrorIs(t, err, oidc.ErrInvalidToken)
+		})
+	}, nil)
+}
+
+func TestProvider_Cmd(t *testing.T) {
+	err := tstr.Run(
+		tstr.WithDeps(
+			oidc.New(oidc.WithName("idp")),
+			cmd.New(
+				cmd.WithCommand("go", "env", "GOPROXY"),
+				cmd.WithEnvAppend("GOPROXY={{.idp.Issuer}}"),
+				cmd.WithWaitMatchingLine("^http://127.0.0.1:"),
+				cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+			),
+		),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+}
+
+type tokenResponse struct {
+	status int
+	body   map[string]any
+}
+
+func token(t *testing.T, p *oidc.Provider, form url.Values) tokenResponse {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, p.Outputs()["TokenURL"], strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := p.Client().Do(req)
+	require.NoError(t, err)
+
+	r := tokenResponse{status: resp.StatusCode}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&r.body))
+	require.NoError(t, resp.Body.Close())
+	return r
+}
+
+// str returns the string field of the response body.
+func (r tokenResponse) str(t *testing.T, field string) string {
+	t.Helper()
+	v, ok := r.body[field].(string)
+	require.True(t, ok, "%s is not a string: %v", field, r.body[field])
+	return v
+}
+
+func getJSON(t *testing.T, p *oidc.Provider, u, bearer string, v any) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, u, nil)
+	require.NoError(t, err)
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	resp, err := p.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	require.NoError(t, resp.Body.Close())
+}
+
+// verifyWithJWKS verifies token with the keys published by the provider like a relying party would.
+func verifyWithJWKS(t *testing.T, p *oidc.Provider, token string) map[string]any {
+	t.Helper()
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	getJSON(t, p, p.Outputs()["JWKSURL"], "", &set)
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+	var header struct {
+		Kid string `json:"kid"`
+	}
+	decode(t, parts[0], &header)
+
+	for _, k := range set.Keys {
+		if k.Kid != header.Kid {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		require.NoError(t, err)
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		require.NoError(t, err)
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		require.NoError(t, err)
+		sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		require.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig))
+
+		var claims map[string]any
+		decode(t, parts[1], &claims)
+		return claims
+	}
+	require.Fail(t, "key not found in JWKS", header.Kid)
+	return nil
+}
+
+func decode(t *testing.T, s string, v any) {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(b, v))
+}
@@ -0,0 +1,472 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply    = strerr.Error("failed to apply Opt")
+	ErrIssue       = strerr.Error("failed to issue certificate")
+	ErrWrite       = strerr.Error("failed to write certificates")
+	ErrUnknownCert = strerr.Error("unknown certificate")
+	ErrNotStarted  = strerr.Error("pki not started")
+)
+
+// PKI is a throwaway certificate authority which issues server and client certificates
+// and writes them into a temporary directory for processes started with other dependencies.
+type PKI struct {
+	opts     []Opt
+	name     string
+	validity time.Duration
+	requests []request
+
+	mu         sync.RWMutex
+	dir        string
+	ca         *Cert
+	pool       *x509.CertPool
+	certs      map[string]*Cert
+	transports map[string]*http.Transport
+}
+
+// Cert is a certificate issued by the PKI.
+type Cert struct {
+	Name        string
+	Certificate *x509.Certificate
+	// TLS holds the certificate with its private key, for example for tls.Config.Certificates.
+	TLS tls.Certificate
+	// CertPEM and KeyPEM are the PEM encoded certificate and PKCS #8 private key.
+	CertPEM, KeyPEM []byte
+	// ChainPEM is the bundle of the certificate followed by the CA certificate, it's empty for the CA.
+	ChainPEM []byte
+	// CertFile, KeyFile and ChainFile are the paths of the files containing CertPEM, KeyPEM and ChainPEM.
+	CertFile, KeyFile, ChainFile string
+
+	key *ecdsa.PrivateKey
+}
+
+type request struct {
+	name   string
+	cn     string
+	sans   []string
+	usages []x509.ExtKeyUsage
+}
+
+type Opt func(*PKI) error
+
+// New creates new PKI dependency.
+func New(opts ...Opt) *PKI {
+	return &PKI{
+		opts:     opts,
+		validity: 24 * time.Hour,
+	}
+}
+
+func (p *PKI) Start() error {
+	p.requests = nil
+	for _, opt := range p.opts {
+		if err := opt(p); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "tstr-pki-")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+
+	ca, err := p.newCA()
+	if err != nil {
+		return errors.Join(fmt.Errorf("%w: %w", ErrIssue, err), os.RemoveAll(dir))
+	}
+	if err := ca.write(dir); err != nil {
+		return errors.Join(err, os.RemoveAll(dir))
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Certificate)
+
+	p.mu.Lock()
+	p.dir, p.ca, p.pool, p.certs, p.transports = dir, ca, pool, map[string]*Cert{}, map[string]*http.Transport{}
+	p.mu.Unlock()
+
+	for _, r := range p.requests {
+		if _, err := p.issue(r); err != nil {
+			return errors.Join(err, p.Stop())
+		}
+	}
+	return nil
+}
+
+func (p *PKI) Ready() error { return nil }
+
+// Stop removes the directory holding the certificates.
+func (p *PKI) Stop() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, t := range p.transports {
+		t.CloseIdleConnections()
+	}
+	dir := p.dir
+	p.dir, p.ca, p.pool, p.certs, p.transports = "", nil, nil, nil, nil
+	if dir == "" {
+		return nil
+	}
+	return os.RemoveAll(dir)
+}
+
+// Name returns the name set with WithName or "pki".
+func (p *PKI) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "pki"
+}
+
+// Outputs returns Dir, CAFile and CAPEM, and <name>CertFile, <name>KeyFile, <name>ChainFile,
+// <name>CertPEM, <name>KeyPEM and <name>ChainPEM for each issued certificate,
+// for example {{.pki.CAFile}} or {{.pki.serverChainFile}}.
+func (p *PKI) Outputs() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.ca == nil {
+		return nil
+	}
+	o := map[string]string{
+		"Dir":    p.dir,
+		"CAFile": p.ca.CertFile,
+		"CAPEM":  string(p.ca.CertPEM),
+	}
+	for name, c := range p.certs {
+		o[name+"CertFile"] = c.CertFile
+		o[name+"KeyFile"] = c.KeyFile
+		o[name+"ChainFile"] = c.ChainFile
+		o[name+"CertPEM"] = string(c.CertPEM)
+		o[name+"KeyPEM"] = string(c.KeyPEM)
+		o[name+"ChainPEM"] = string(c.ChainPEM)
+	}
+	return o
+}
+
+// Dir returns the directory holding the certificates.
+func (p *PKI) Dir() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.dir
+}
+
+// CA returns the certificate of the CA. Its key is not written to disk.
+func (p *PKI) CA() *Cert {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.ca
+}
+
+// CertPool returns a pool containing the CA certificate.
+func (p *PKI) CertPool() *x509.CertPool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pool
+}
+
+// Cert returns the certificate issued with name.
+func (p *PKI) Cert(name string) (*Cert, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.ca == nil {
+		return nil, ErrNotStarted
+	}
+	c, ok := p.certs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCert, name)
+	}
+	return c, nil
+}
+
+// IssueServerCert issues a server certificate for sans and writes it into Dir, see WithServerCert.
+func (p *PKI) IssueServerCert(name string, sans ...string) (*Cert, error) {
+	return p.issue(serverRequest(name, sans))
+}
+
+// IssueClientCert issues a client certificate with commonName and writes it into Dir, see WithClientCert.
+func (p *PKI) IssueClientCert(name, commonName string) (*Cert, error) {
+	return p.issue(clientRequest(name, commonName))
+}
+
+// ServerTLSConfig returns a config serving the certificate name.
+// Client certificates signed by the CA are verified if given,
+// set ClientAuth to tls.RequireAndVerifyClientCert to require them.
+func (p *PKI) ServerTLSConfig(name string) (*tls.Config, error) {
+	c, err := p.Cert(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{c.TLS},
+		ClientCAs:    p.CertPool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// ClientTLSConfig returns a config which trusts the CA and presents the client certificate name.
+// An empty name configures no client certificate.
+func (p *PKI) ClientTLSConfig(name string) (*tls.Config, error) {
+	pool := p.CertPool()
+	if pool == nil {
+		return nil, ErrNotStarted
+	}
+	cfg := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	if name == "" {
+		return cfg, nil
+	}
+	c, err := p.Cert(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Certificates = []tls.Certificate{c.TLS}
+	return cfg, nil
+}
+
+// Client returns a client which trusts the CA.
+// The client can be created before the PKI is started, for example for cmd.WithReadyHTTPClient.
+func (p *PKI) Client() *http.Client {
+	return &http.Client{Transport: &transport{pki: p}}
+}
+
+// MTLSClient is like Client but also presents the client certificate name.
+func (p *PKI) MTLSClient(name string) *http.Client {
+	return &http.Client{Transport: &transport{pki: p, cert: name}}
+}
+
+// transport resolves the TLS config on first use so that clients survive restarts of the PKI.
+type transport struct {
+	pki  *PKI
+	cert string
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt, err := t.pki.transport(t.cert)
+	if err != nil {
+		return nil, err
+	}
+	return rt.RoundTrip(r)
+}
+
+func (p *PKI) transport(name string) (*http.Transport, error) {
+	p.mu.RLock()
+	rt, ok := p.transports[name]
+	p.mu.RUnlock()
+	if ok {
+		return rt, nil
+	}
+
+	cfg, err := p.ClientTLSConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	// A plain transport is used if http.DefaultTransport has been replaced.
+	rt = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		rt = t.Clone()
+	}
+	rt.TLSClientConfig = cfg
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.transports == nil {
+		return nil, ErrNotStarted
+	}
+	if existing, ok := p.transports[name]; ok {
+		return existing, nil
+	}
+	p.transports[name] = rt
+	return rt, nil
+}
+
+func (p *PKI) newCA() (*Cert, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := p.template(p.Name() + " test CA")
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	return newCert("ca", tmpl, tmpl, key, key)
+}
+
+func (p *PKI) issue(r request) (*Cert, error) {
+	p.mu.RLock()
+	ca, dir := p.ca, p.dir
+	p.mu.RUnlock()
+	if ca == nil {
+		return nil, ErrNotStarted
+	}
+
+	c, err := p.sign(ca, r)
+	if err != nil {
+		return nil, fmt.Errorf("%w '%s': %w", ErrIssue, r.name, err)
+	}
+	c.ChainPEM = append(slices.Clone(c.CertPEM), ca.CertPEM...)
+	if err := c.write(dir); err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.certs == nil {
+		return nil, ErrNotStarted
+	}
+	p.certs[r.name] = c
+	return c, nil
+}
+
+func (p *PKI) sign(ca *Cert, r request) (*Cert, error) {
+	if r.name == "" || r.name == "ca" || filepath.Base(r.name) != r.name {
+		return nil, fmt.Errorf("invalid name '%s'", r.name)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := p.template(r.cn)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	tmpl.ExtKeyUsage = r.usages
+	for _, san := range r.sans {
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, san)
+		}
+	}
+	return newCert(r.name, tmpl, ca.Certificate, key, ca.key)
+}
+
+func (p *PKI) template(cn string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"tstr"}},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(p.validity),
+	}, nil
+}
+
+func newCert(name string, tmpl, parent *x509.Certificate, key, parentKey *ecdsa.PrivateKey) (*Cert, error) {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cert{
+		Name:        name,
+		Certificate: cert,
+		CertPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		KeyPEM:      pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		key:         key,
+	}
+	c.TLS = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+	return c, nil
+}
+
+// write writes the certificate into <name>.pem and, except for the CA,
+// the key into <name>-key.pem and the chain into <name>-chain.pem.
+func (c *Cert) write(dir string) error {
+	c.CertFile = filepath.Join(dir, c.Name+".pem")
+	if err := os.WriteFile(c.CertFile, c.CertPEM, 0o600); err != nil {
+		return fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+	if c.Certificate.IsCA {
+		return nil
+	}
+	c.KeyFile = filepath.Join(dir, c.Name+"-key.pem")
+	if err := os.WriteFile(c.KeyFile, c.KeyPEM, 0o600); err != nil {
+		return fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+	c.ChainFile = filepath.Join(dir, c.Name+"-chain.pem")
+	if err := os.WriteFile(c.ChainFile, c.ChainPEM, 0o600); err != nil {
+		return fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+	return nil
+}
+
+func serverRequest(name string, sans []string) request {
+	if len(sans) == 0 {
+		sans = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	return request{name: name, cn: sans[0], sans: sans, usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+}
+
+func clientRequest(name, commonName string) request {
+	return request{name: name, cn: commonName, usages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+}
+
+// WithName sets the name of the PKI which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(p *PKI) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithServerCert issues a server certificate called name for the DNS names and IP addresses in sans.
+// The sans default to localhost, 127.0.0.1 and ::1.
+func WithServerCert(name string, sans ...string) Opt {
+	return func(p *PKI) error {
+		p.requests = append(p.requests, serverRequest(name, sans))
+		return nil
+	}
+}
+
+// WithClientCert issues a client certificate called name with commonName as its subject.
+func WithClientCert(name, commonName string) Opt {
+	return func(p *PKI) error {
+		p.requests = append(p.requests, clientRequest(name, commonName))
+		return nil
+	}
+}
+
+// WithValidity sets how long the certificates are valid, defaults to 24 hours.
+func WithValidity(d time.Duration) Opt {
+	return func(p *PKI) error {
+		if d <= 0 {
+			return errors.New("validity must be positive")
+		}
+		p.validity = d
+		return nil
+	}
+}
@@ -0,0 +1,126 @@
+package pki_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/cmd"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPKI(t *testing.T) {
+	p := pki.New(
+		pki.WithServerCert("server"),
+		pki.WithClientCert("client", "alice"),
+	)
+	client, mtlsClient := p.Client(), p.MTLSClient("client")
+
+	var dir string
+	deptest.ErrorIs(t, p, func() {
+		dir = p.Dir()
+		o := p.Outputs()
+		assert.Equal(t, dir, o["Dir"])
+		assert.Equal(t, string(p.CA().CertPEM), o["CAPEM"])
+		for _, k := range []string{"CAFile", "serverCertFile", "serverKeyFile", "serverChainFile", "clientCertFile", "clientKeyFile"} {
+			assert.FileExists(t, o[k])
+		}
+		b, err := os.ReadFile(o["serverCertFile"])
+		require.NoError(t, err)
+		assert.Equal(t, o["serverCertPEM"], string(b))
+		assert.Equal(t, o["serverCertPEM"]+o["CAPEM"], o["serverChainPEM"])
+		b, err = os.ReadFile(o["serverChainFile"])
+		require.NoError(t, err)
+		assert.Equal(t, o["serverChainPEM"], string(b))
+		_, err = tls.X509KeyPair([]byte(o["serverChainPEM"]), []byte(o["serverKeyPEM"]))
+		require.NoError(t, err)
+
+		_, err = tls.LoadX509KeyPair(o["clientCertFile"], o["clientKeyFile"])
+		require.NoError(t, err)
+
+		server, err := p.Cert("server")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"localhost"}, server.Certificate.DNSNames)
+		assert.Len(t, server.Certificate.IPAddresses, 2)
+
+		cfg, err := p.ServerTLSConfig("server")
+		require.NoError(t, err)
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}))
+		srv.TLS = cfg
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		resp, err := mtlsClient.Get(srv.URL)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		require.NoError(t, resp.Body.Close())
+
+		resp, err = client.Get(srv.URL) //nolint:bodyclose // The request fails without a response.
+		require.Error(t, err)
+		assert.Nil(t, resp)
+
+		resp, err = http.Get(srv.URL) //nolint:bodyclose // The request fails without a response.
+		require.Error(t, err)
+		assert.Nil(t, resp)
+
+		_, err = p.Cert("missing")
+		require.ErrorIs(t, err, pki.ErrUnknownCert)
+	}, nil)
+	assert.NoDirExists(t, dir)
+}
+
+func TestPKI_IssueServerCert(t *testing.T) {
+	p := pki.New(pki.WithName("certs"), pki.WithValidity(time.Hour))
+	deptest.ErrorIs(t, p, func() {
+		assert.Equal(t, "certs", p.Name())
+		c, err := p.IssueServerCert("api", "api.test", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Equal(t, []string{"api.test"}, c.Certificate.DNSNames)
+		assert.Equal(t, "10.0.0.1", c.Certificate.IPAddresses[0].String())
+		assert.WithinDuration(t, time.Now().Add(time.Hour), c.Certificate.NotAfter, time.Minute)
+		assert.Contains(t, p.Outputs(), "apiCertFile")
+
+		_, err = c.Certificate.Verify(x509.VerifyOptions{DNSName: "api.test", Roots: p.CertPool()})
+		require.NoError(t, err)
+
+		_, err = p.IssueServerCert("../escape")
+		require.ErrorIs(t, err, pki.ErrIssue)
+	}, nil)
+}
+
+func TestPKI_ReadyHTTP(t *testing.T) {
+	p := pki.New(pki.WithServerCert("server"))
+	deptest.ErrorIs(t, p, func() {
+		cfg, err := p.ServerTLSConfig("server")
+		require.NoError(t, err)
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+		srv.TLS = cfg
+		srv.StartTLS()
+		t.Cleanup(srv.Close)
+
+		c := cmd.New(
+			cmd.WithReadyHTTP(srv.URL),
+			cmd.WithReadyHTTPClient(p.Client()),
+			cmd.WithCommand("go", "version"),
+			cmd.WithStopFn(func(*exec.Cmd) error { return nil }),
+		)
+		deptest.ErrorIs(t, c, nil, nil)
+	}, nil)
+}
+
+func TestPKI_Errors(t *testing.T) {
+	_, err := pki.New().ClientTLSConfig("")
+	require.ErrorIs(t, err, pki.ErrNotStarted)
+	deptest.ErrorIs(t, pki.New(pki.WithValidity(0)), nil, pki.ErrOptApply)
+}
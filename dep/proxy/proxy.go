@@ -0,0 +1,386 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/port"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply        = strerr.Error("failed to apply Opt")
+	ErrMissingUpstream = strerr.Error("missing upstream address")
+	ErrListen          = strerr.Error("failed to listen")
+)
+
+const dialTimeout = 5 * time.Second
+
+// Proxy is a TCP proxy which forwards connections to an upstream address and injects faults.
+// The faults can be changed at any time, for example from the test function.
+type Proxy struct {
+	opts     []Opt
+	name     string
+	upstream string
+	port     *port.Port
+	listener net.Listener
+	outputs  expand.Values
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[*conn]struct{}
+	closed bool
+	faults Faults
+}
+
+// Faults are the faults injected by the proxy. The zero value forwards the traffic as is.
+type Faults struct {
+	// Latency delays every chunk of data forwarded in either direction.
+	Latency time.Duration
+	// Bandwidth limits the throughput of each direction of each connection in bytes per second.
+	Bandwidth int
+	// Reset resets new connections immediately after they are accepted.
+	Reset bool
+	// Blackhole keeps the connections open but drops all data in both directions.
+	Blackhole bool
+	// HalfOpen closes the upstream side of the connections while the client side stays open
+	// without receiving any data, as if the upstream disappeared without notice.
+	HalfOpen bool
+}
+
+type conn struct {
+	client   net.Conn
+	mu       sync.Mutex
+	upstream net.Conn
+}
+
+type Opt func(*Proxy) error
+
+// New creates new Proxy dependency.
+func New(opts ...Opt) *Proxy {
+	return &Proxy{opts: opts}
+}
+
+func (p *Proxy) Start() error {
+	for _, opt := range p.opts {
+		if err := opt(p); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if p.upstream == "" {
+		return ErrMissingUpstream
+	}
+	upstream, err := expand.String(p.upstream, p.outputs)
+	if err != nil {
+		return err
+	}
+	p.upstream = upstream
+
+	addr := "127.0.0.1:0"
+	if p.port != nil {
+		if err := p.port.Release(); err != nil {
+			return fmt.Errorf("%w: %w", ErrListen, err)
+		}
+		addr = p.port.Addr()
+	}
+
+	p.listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+
+	p.conns, p.closed = map[*conn]struct{}{}, false
+	p.wg.Go(p.accept)
+	return nil
+}
+
+func (p *Proxy) Ready() error { return nil }
+
+// Stop closes the listener and all connections.
+func (p *Proxy) Stop() error {
+	if p.listener == nil {
+		return nil
+	}
+	err := p.listener.Close()
+	p.mu.Lock()
+	p.closed = true
+	for c := range p.conns {
+		c.close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+
+	if p.port != nil {
+		err = errors.Join(err, p.port.Close())
+	}
+	return err
+}
+
+// Name returns the name set with WithName or "proxy".
+func (p *Proxy) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return "proxy"
+}
+
+// Outputs returns the Addr, Host and Port of the proxy, for example {{.proxy.Addr}}.
+func (p *Proxy) Outputs() map[string]string {
+	if p.listener == nil {
+		return nil
+	}
+	host, port, _ := net.SplitHostPort(p.Addr())
+	return map[string]string{"Addr": p.Addr(), "Host": host, "Port": port}
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders in the upstream address.
+func (p *Proxy) SetOutputs(outputs map[string]map[string]string) {
+	if p.outputs == nil {
+		p.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(p.outputs, outputs)
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+// Upstream returns the resolved upstream address.
+func (p *Proxy) Upstream() string {
+	return p.upstream
+}
+
+// Faults returns the current faults.
+func (p *Proxy) Faults() Faults {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.faults
+}
+
+// SetFaults replaces the current faults. The faults apply to both new and existing connections.
+func (p *Proxy) SetFaults(f Faults) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.faults = f
+	if f.HalfOpen {
+		for c := range p.conns {
+			c.closeUpstream()
+		}
+	}
+}
+
+// SetLatency sets Faults.Latency.
+func (p *Proxy) SetLatency(d time.Duration) {
+	p.update(func(f *Faults) { f.Latency = d })
+}
+
+// SetBandwidth sets Faults.Bandwidth, zero removes the limit.
+func (p *Proxy) SetBandwidth(bytesPerSecond int) {
+	p.update(func(f *Faults) { f.Bandwidth = bytesPerSecond })
+}
+
+// SetReset sets Faults.Reset.
+func (p *Proxy) SetReset(enabled bool) {
+	p.update(func(f *Faults) { f.Reset = enabled })
+}
+
+// SetBlackhole sets Faults.Blackhole.
+func (p *Proxy) SetBlackhole(enabled bool) {
+	p.update(func(f *Faults) { f.Blackhole = enabled })
+}
+
+// SetHalfOpen sets Faults.HalfOpen.
+func (p *Proxy) SetHalfOpen(enabled bool) {
+	p.update(func(f *Faults) { f.HalfOpen = enabled })
+}
+
+// Heal removes all faults. Connections closed by the faults are not restored.
+func (p *Proxy) Heal() {
+	p.SetFaults(Faults{})
+}
+
+// ResetConnections resets all open connections.
+func (p *Proxy) ResetConnections() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c := range p.conns {
+		c.close()
+	}
+}
+
+func (p *Proxy) update(fn func(*Faults)) {
+	f := p.Faults()
+	fn(&f)
+	p.SetFaults(f)
+}
+
+func (p *Proxy) accept() {
+	for {
+		c, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Go(func() { p.handle(c) })
+	}
+}
+
+func (p *Proxy) handle(client net.Conn) {
+	f := p.Faults()
+	if f.Reset {
+		reset(client)
+		return
+	}
+
+	c := &conn{client: client}
+	if !f.Blackhole && !f.HalfOpen {
+		upstream, err := net.DialTimeout("tcp", p.upstream, dialTimeout)
+		if err != nil {
+			reset(client)
+			return
+		}
+		c.upstream = upstream
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		c.close()
+		return
+	}
+	p.conns[c] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.conns, c)
+		p.mu.Unlock()
+		c.close()
+	}()
+
+	if c.upstream == nil {
+		_, _ = io.Copy(io.Discard, client)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { p.pipe(c.upstream, client, false) })
+	p.pipe(client, c.upstream, true)
+	wg.Wait()
+}
+
+// pipe copies from src to dst applying the faults.
+func (p *Proxy) pipe(dst, src net.Conn, toClient bool) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf[:p.Faults().chunkSize(len(buf))])
+		if n > 0 && !p.forward(dst, buf[:n]) {
+			return
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// With half open connections the client must not notice that the upstream is gone.
+	if toClient && p.Faults().HalfOpen {
+		return
+	}
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+}
+
+// forward writes b into dst unless the current faults drop it and reports whether dst can still be written to.
+func (p *Proxy) forward(dst net.Conn, b []byte) bool {
+	f := p.Faults()
+	if f.drops() {
+		return true
+	}
+	time.Sleep(f.delay(len(b)))
+	_, err := dst.Write(b)
+	return err == nil
+}
+
+// chunkSize limits the amount of data read at once to the Bandwidth.
+func (f Faults) chunkSize(size int) int {
+	if f.Bandwidth > 0 && f.Bandwidth < size {
+		return f.Bandwidth
+	}
+	return size
+}
+
+// delay returns how long forwarding n bytes takes with the Latency and the Bandwidth.
+func (f Faults) delay(n int) time.Duration {
+	d := f.Latency
+	if f.Bandwidth > 0 {
+		d += time.Duration(n) * time.Second / time.Duration(f.Bandwidth)
+	}
+	return d
+}
+
+// drops reports whether the data is dropped because of Blackhole or HalfOpen.
+func (f Faults) drops() bool {
+	return f.Blackhole || f.HalfOpen
+}
+
+func (c *conn) closeUpstream() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.upstream != nil {
+		_ = c.upstream.Close()
+	}
+}
+
+func (c *conn) close() {
+	c.closeUpstream()
+	reset(c.client)
+}
+
+// reset closes c so that the peer gets a connection reset instead of a graceful close.
+func reset(c net.Conn) {
+	if tc, ok := c.(*net.TCPConn); ok {
+		_ = tc.SetLinger(0)
+	}
+	_ = c.Close()
+}
+
+// WithName sets the name of the proxy which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(p *Proxy) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithUpstream sets the address the connections are forwarded to.
+// Placeholders such as {{.postgres.Addr}} are resolved when the proxy is started.
+func WithUpstream(addr string) Opt {
+	return func(p *Proxy) error {
+		p.upstream = addr
+		return nil
+	}
+}
+
+// WithPort makes the proxy listen on a port reserved with the port package.
+// The port is closed when the proxy is stopped.
+func WithPort(pt *port.Port) Opt {
+	return func(p *Proxy) error {
+		p.port = pt
+		return nil
+	}
+}
+
+// WithFaults sets the faults injected from the start, see SetFaults.
+func WithFaults(f Faults) Opt {
+	return func(p *Proxy) error {
+		p.faults = f
+		return nil
+	}
+}
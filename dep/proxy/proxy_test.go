@@ -0,0 +1,172 @@
+package proxy_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/dep/proxy"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxy_Outputs(t *testing.T) {
+	api := httpserver.New(
+		httpserver.WithName("api"),
+		httpserver.WithRoute("GET /", httpserver.Response{Body: "ok"}),
+	)
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()))
+	px := proxy.New(proxy.WithUpstream("{{.api.Addr}}"), proxy.WithPort(p))
+
+	err := tstr.Run(
+		tstr.WithDeps(api, px),
+		tstr.WithFn(func() {
+			assert.Equal(t, p.Addr(), px.Addr())
+			assert.Equal(t, api.Outputs()["Addr"], px.Upstream())
+
+			resp, err := http.Get("http://" + px.Addr()) //nolint:noctx
+			require.NoError(t, err)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, "ok", string(b))
+		}),
+	)
+	require.NoError(t, err)
+}
+
+func TestProxy_Faults(t *testing.T) {
+	upstream := echoServer(t)
+	px := proxy.New(proxy.WithUpstream(upstream.addr))
+
+	deptest.ErrorIs(t, px, func() {
+		t.Run("Forward", func(t *testing.T) {
+			c := dial(t, px)
+			assert.Equal(t, "hello", roundTrip(t, c, "hello"))
+		})
+
+		t.Run("Latency", func(t *testing.T) {
+			px.SetLatency(100 * time.Millisecond)
+			defer px.Heal()
+			c := dial(t, px)
+			start := time.Now()
+			assert.Equal(t, "hello", roundTrip(t, c, "hello"))
+			assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+		})
+
+		t.Run("Bandwidth", func(t *testing.T) {
+			px.SetBandwidth(10_000)
+			defer px.Heal()
+			c := dial(t, px)
+			start := time.Now()
+			msg := strings.Repeat("a", 1000)
+			assert.Equal(t, msg, roundTrip(t, c, msg))
+			assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		})
+
+		t.Run("Blackhole", func(t *testing.T) {
+			c := dial(t, px)
+			px.SetBlackhole(true)
+			defer px.Heal()
+			assertTimeout(t, c, "hello")
+			assertTimeout(t, dial(t, px), "hello")
+		})
+
+		t.Run("HalfOpen", func(t *testing.T) {
+			c := dial(t, px)
+			assert.Equal(t, "hello", roundTrip(t, c, "hello"))
+			closed := upstream.closed.Load()
+			px.SetHalfOpen(true)
+			defer px.Heal()
+			assertTimeout(t, c, "hello")
+			assert.Eventually(t, func() bool { return upstream.closed.Load() > closed }, time.Second, 10*time.Millisecond)
+		})
+
+		t.Run("Reset", func(t *testing.T) {
+			px.SetReset(true)
+			defer px.Heal()
+			c := dial(t, px)
+			_, err := c.Read(make([]byte, 1))
+			require.Error(t, err)
+		})
+
+		t.Run("ResetConnections", func(t *testing.T) {
+			c := dial(t, px)
+			assert.Equal(t, "hello", roundTrip(t, c, "hello"))
+			px.ResetConnections()
+			_, err := c.Read(make([]byte, 1))
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, os.ErrDeadlineExceeded)
+		})
+	}, nil)
+}
+
+func TestProxy_Errors(t *testing.T) {
+	deptest.ErrorIs(t, proxy.New(), nil, proxy.ErrMissingUpstream)
+	deptest.ErrorIs(t, proxy.New(proxy.WithUpstream("{{.db.Addr}}")), nil, expand.ErrUnresolved)
+}
+
+type echo struct {
+	addr   string
+	closed atomic.Int32
+}
+
+func echoServer(t *testing.T) *echo {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, l.Close()) })
+
+	e := &echo{addr: l.Addr().String()}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(c, c)
+				_ = c.Close()
+				e.closed.Add(1)
+			}()
+		}
+	}()
+	return e
+}
+
+func dial(t *testing.T, px *proxy.Proxy) net.Conn {
+	c, err := net.Dial("tcp", px.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func roundTrip(t *testing.T, c net.Conn, msg string) string {
+	t.Helper()
+	require.NoError(t, c.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err := io.WriteString(c, msg+"\n")
+	require.NoError(t, err)
+	line, err := bufio.NewReader(c).ReadString('\n')
+	require.NoError(t, err)
+	return strings.TrimSuffix(line, "\n")
+}
+
+func assertTimeout(t *testing.T, c net.Conn, msg string) {
+	t.Helper()
+	require.NoError(t, c.SetDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err := io.WriteString(c, msg+"\n")
+	require.NoError(t, err)
+	_, err = c.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, os.ErrDeadlineExceeded), "expected timeout, got %v", err)
+}
@@ -0,0 +1,1351 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const version = "7.2.0"
+
+var (
+	errSyntax   = errors.New("ERR syntax error")
+	errNotInt   = errors.New("ERR value is not an integer or out of range")
+	errNotFloat = errors.New("ERR value is not a valid float")
+	errNoKey    = errors.New("ERR no such key")
+	okReply     = simple("OK")
+)
+
+// command is a supported command. The arity includes the command name and is the minimum number of arguments if negative.
+type command struct {
+	fn    func(c *client, args []string) any
+	arity int
+	// noAuth commands are allowed before authentication.
+	noAuth bool
+	// pubsub commands are allowed in the RESP2 subscribed state.
+	pubsub bool
+	// noQueue commands are run immediately inside MULTI.
+	noQueue bool
+}
+
+// commands is the command table. Commands that inspect the table do it through Server.commands
+// since referring to commands from the table would be an initialization cycle.
+var commands = map[string]command{
+	// Connection
+	"ping":    {fn: ping, arity: -1, pubsub: true},
+	"echo":    {fn: func(_ *client, args []string) any { return args[0] }, arity: 2},
+	"hello":   {fn: hello, arity: -1, noAuth: true, pubsub: true, noQueue: true},
+	"auth":    {fn: auth, arity: -2, noAuth: true, noQueue: true},
+	"select":  {fn: selectDB, arity: 2},
+	"quit":    {fn: quit, arity: -1, noAuth: true, pubsub: true, noQueue: true},
+	"client":  {fn: clientCmd, arity: -2},
+	"command": {fn: commandCmd, arity: -1},
+	"info":    {fn: info, arity: -1},
+	"dbsize":  {fn: dbsize, arity: 1},
+	"flushdb": {fn: flushdb, arity: -1},
+	"flushall": {fn: func(c *client, _ []string) any {
+		for _, d := range c.s.dbs {
+			d.flush()
+		}
+		return okReply
+	}, arity: -1},
+
+	// Keys
+	"del":       {fn: del, arity: -2},
+	"unlink":    {fn: del, arity: -2},
+	"exists":    {fn: exists, arity: -2},
+	"expire":    {fn: expireIn(time.Second), arity: -3},
+	"pexpire":   {fn: expireIn(time.Millisecond), arity: -3},
+	"expireat":  {fn: expireAt(time.Second), arity: -3},
+	"pexpireat": {fn: expireAt(time.Millisecond), arity: -3},
+	"ttl":       {fn: ttl(time.Second), arity: 2},
+	"pttl":      {fn: ttl(time.Millisecond), arity: 2},
+	"persist":   {fn: persist, arity: 2},
+	"type":      {fn: typeCmd, arity: 2},
+	"keys":      {fn: keys, arity: 2},
+	"scan":      {fn: scan, arity: -2},
+	"rename":    {fn: rename, arity: 3},
+
+	// Strings
+	"get":         {fn: get, arity: 2},
+	"set":         {fn: setCmd, arity: -3},
+	"setnx":       {fn: setnx, arity: 3},
+	"setex":       {fn: setex(time.Second), arity: 4},
+	"psetex":      {fn: setex(time.Millisecond), arity: 4},
+	"mget":        {fn: mget, arity: -2},
+	"mset":        {fn: mset, arity: -3},
+	"getdel":      {fn: getdel, arity: 2},
+	"getset":      {fn: getset, arity: 3},
+	"append":      {fn: appendCmd, arity: 3},
+	"strlen":      {fn: strlen, arity: 2},
+	"incr":        {fn: func(c *client, args []string) any { return incrBy(c, args[0], 1) }, arity: 2},
+	"decr":        {fn: func(c *client, args []string) any { return incrBy(c, args[0], -1) }, arity: 2},
+	"incrby":      {fn: incrByCmd(1), arity: 3},
+	"decrby":      {fn: incrByCmd(-1), arity: 3},
+	"incrbyfloat": {fn: incrByFloat, arity: 3},
+
+	// Hashes
+	"hset":    {fn: hset, arity: -4},
+	"hmset":   {fn: hmset, arity: -4},
+	"hsetnx":  {fn: hsetnx, arity: 4},
+	"hget":    {fn: hget, arity: 3},
+	"hmget":   {fn: hmget, arity: -3},
+	"hdel":    {fn: hdel, arity: -3},
+	"hgetall": {fn: hgetall, arity: 2},
+	"hkeys":   {fn: hkeys, arity: 2},
+	"hvals":   {fn: hvals, arity: 2},
+	"hlen":    {fn: hlen, arity: 2},
+	"hexists": {fn: hexists, arity: 3},
+	"hincrby": {fn: hincrby, arity: 4},
+
+	// Lists
+	"lpush":  {fn: push(true), arity: -3},
+	"rpush":  {fn: push(false), arity: -3},
+	"lpop":   {fn: pop(true), arity: -2},
+	"rpop":   {fn: pop(false), arity: -2},
+	"llen":   {fn: llen, arity: 2},
+	"lrange": {fn: lrange, arity: 4},
+	"lindex": {fn: lindex, arity: 3},
+	"lset":   {fn: lset, arity: 4},
+	"ltrim":  {fn: ltrim, arity: 4},
+	"lrem":   {fn: lrem, arity: 4},
+
+	// Sets
+	"sadd":       {fn: sadd, arity: -3},
+	"srem":       {fn: srem, arity: -3},
+	"smembers":   {fn: smembers, arity: 2},
+	"sismember":  {fn: sismember, arity: 3},
+	"smismember": {fn: smismember, arity: -3},
+	"scard":      {fn: scard, arity: 2},
+	"sinter":     {fn: setOp(intersect), arity: -2},
+	"sunion":     {fn: setOp(union), arity: -2},
+	"sdiff":      {fn: setOp(diff), arity: -2},
+
+	// Pub/sub
+	"subscribe":    {fn: subscribe(false), arity: -2, pubsub: true},
+	"psubscribe":   {fn: subscribe(true), arity: -2, pubsub: true},
+	"unsubscribe":  {fn: unsubscribe(false), arity: -1, pubsub: true},
+	"punsubscribe": {fn: unsubscribe(true), arity: -1, pubsub: true},
+	"publish":      {fn: publish, arity: 3},
+
+	// Transactions
+	"multi":   {fn: multi, arity: 1, noQueue: true},
+	"exec":    {fn: exec, arity: 1, noQueue: true},
+	"discard": {fn: discard, arity: 1, noQueue: true},
+	"watch":   {fn: watch, arity: -2, noQueue: true},
+	"unwatch": {fn: unwatch, arity: 1},
+}
+
+func ping(c *client, args []string) any {
+	msg := ""
+	if len(args) > 0 {
+		msg = args[0]
+	}
+	switch {
+	case c.proto == 2 && c.subscriptions() > 0:
+		return []any{"pong", msg}
+	case len(args) > 0:
+		return msg
+	default:
+		return simple("PONG")
+	}
+}
+
+func hello(c *client, args []string) any {
+	proto := c.proto
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v != 2 && v != 3 {
+			return errors.New("NOPROTO unsupported protocol version")
+		}
+		proto = v
+		if err := c.helloOpts(args[1:]); err != nil {
+			return err
+		}
+	}
+	if c.s.password != "" && !c.authed {
+		return errors.New("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used")
+	}
+
+	c.proto = proto
+	modules := []any{}
+	return mapReply{
+		"server", "redis",
+		"version", version,
+		"proto", proto,
+		"id", c.id,
+		"mode", "standalone",
+		"role", "master",
+		"modules", modules,
+	}
+}
+
+// helloOpts applies the AUTH and SETNAME options of HELLO.
+func (c *client) helloOpts(args []string) error {
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			if err := c.auth(args[i+1], args[i+2]); err != nil {
+				return err
+			}
+			i += 2
+		case "SETNAME":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			c.name = args[i+1]
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	return nil
+}
+
+func auth(c *client, args []string) any {
+	var err error
+	switch len(args) {
+	case 1:
+		err = c.auth("default", args[0])
+	case 2:
+		err = c.auth(args[0], args[1])
+	default:
+		return errSyntax
+	}
+	if err != nil {
+		return err
+	}
+	return okReply
+}
+
+func (c *client) auth(user, password string) error {
+	if c.s.password == "" {
+		return errors.New("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	if user != "default" || password != c.s.password {
+		return errors.New("WRONGPASS invalid username-password pair or user is disabled.") //nolint:staticcheck // Clients match the exact Redis error text.
+	}
+	c.authed = true
+	return nil
+}
+
+func selectDB(c *client, args []string) any {
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errNotInt
+	}
+	if n < 0 || n >= databases {
+		return errors.New("ERR DB index is out of range")
+	}
+	c.db = n
+	return okReply
+}
+
+func quit(c *client, _ []string) any {
+	c.quit = true
+	return okReply
+}
+
+func clientCmd(c *client, args []string) any {
+	switch strings.ToUpper(args[0]) {
+	case "SETNAME":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		c.name = args[1]
+		return okReply
+	case "GETNAME":
+		if c.name == "" {
+			return nil
+		}
+		return c.name
+	case "ID":
+		return c.id
+	case "SETINFO":
+		return okReply
+	default:
+		return fmt.Errorf("ERR unsupported command 'CLIENT %s': not implemented by the tstr redis stand-in", args[0])
+	}
+}
+
+func commandCmd(c *client, args []string) any {
+	if len(args) > 0 && strings.EqualFold(args[0], "COUNT") {
+		return len(c.s.commands)
+	}
+	return []any{}
+}
+
+func info(c *client, _ []string) any {
+	_, p, _ := strings.Cut(c.s.Addr(), ":")
+	return "# Server\r\nredis_version:" + version + "\r\nredis_mode:standalone\r\ntcp_port:" + p + "\r\n"
+}
+
+func dbsize(c *client, _ []string) any {
+	return len(c.database().keys("*", c.s.now()))
+}
+
+func flushdb(c *client, _ []string) any {
+	c.database().flush()
+	return okReply
+}
+
+func del(c *client, args []string) any {
+	d, now, n := c.database(), c.s.now(), 0
+	for _, k := range args {
+		if _, ok := d.get(k, now); ok && d.del(k) {
+			n++
+		}
+	}
+	return n
+}
+
+func exists(c *client, args []string) any {
+	d, now, n := c.database(), c.s.now(), 0
+	for _, k := range args {
+		if _, ok := d.get(k, now); ok {
+			n++
+		}
+	}
+	return n
+}
+
+func expireIn(unit time.Duration) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		return expire(c, args[0], c.s.now().Add(time.Duration(n)*unit), args[2:])
+	}
+}
+
+func expireAt(unit time.Duration) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		return expire(c, args[0], time.UnixMilli(n*unit.Milliseconds()), args[2:])
+	}
+}
+
+func expire(c *client, key string, at time.Time, flags []string) any {
+	d, now := c.database(), c.s.now()
+	if _, ok := d.get(key, now); !ok {
+		return 0
+	}
+	cur, has := d.expires[key]
+	for _, f := range flags {
+		ok, err := expireCond(f, at, cur, has)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return 0
+		}
+	}
+	if !at.After(now) {
+		d.del(key)
+		return 1
+	}
+	d.expires[key] = at
+	d.versions[key]++
+	return 1
+}
+
+// expireCond reports whether the NX, XX, GT or LT flag allows replacing the expiry cur with at.
+func expireCond(flag string, at, cur time.Time, has bool) (bool, error) {
+	switch strings.ToUpper(flag) {
+	case "NX":
+		return !has, nil
+	case "XX":
+		return has, nil
+	case "GT":
+		return has && at.After(cur), nil
+	case "LT":
+		return !has || at.Before(cur), nil
+	default:
+		return false, errSyntax
+	}
+}
+
+func ttl(unit time.Duration) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		d, now := c.database(), c.s.now()
+		if _, ok := d.get(args[0], now); !ok {
+			return -2
+		}
+		exp, ok := d.expires[args[0]]
+		if !ok {
+			return -1
+		}
+		return int64((exp.Sub(now) + unit/2) / unit)
+	}
+}
+
+func persist(c *client, args []string) any {
+	d := c.database()
+	if _, ok := d.get(args[0], c.s.now()); !ok {
+		return 0
+	}
+	if _, ok := d.expires[args[0]]; !ok {
+		return 0
+	}
+	delete(d.expires, args[0])
+	d.versions[args[0]]++
+	return 1
+}
+
+func typeCmd(c *client, args []string) any {
+	v, _ := c.database().get(args[0], c.s.now())
+	return simple(typeName(v))
+}
+
+func keys(c *client, args []string) any {
+	return c.database().keys(args[0], c.s.now())
+}
+
+// scan returns all matching keys at once with cursor 0.
+func scan(c *client, args []string) any {
+	pattern, typ, err := scanOpts(args[1:])
+	if err != nil {
+		return err
+	}
+
+	d, now := c.database(), c.s.now()
+	ks := []string{}
+	for _, k := range d.keys(pattern, now) {
+		if v, _ := d.get(k, now); typ == "" || typeName(v) == typ {
+			ks = append(ks, k)
+		}
+	}
+	return []any{"0", ks}
+}
+
+// scanOpts parses the MATCH, COUNT and TYPE options of SCAN.
+func scanOpts(args []string) (pattern, typ string, err error) {
+	pattern = "*"
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return "", "", errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			pattern = args[i+1]
+		case "COUNT":
+			if _, err := strconv.Atoi(args[i+1]); err != nil {
+				return "", "", errNotInt
+			}
+		case "TYPE":
+			typ = strings.ToLower(args[i+1])
+		default:
+			return "", "", errSyntax
+		}
+	}
+	return pattern, typ, nil
+}
+
+func rename(c *client, args []string) any {
+	d := c.database()
+	v, ok := d.get(args[0], c.s.now())
+	if !ok {
+		return errNoKey
+	}
+	exp, hasExp := d.expires[args[0]]
+	d.del(args[0])
+	d.del(args[1])
+	d.put(args[1], v)
+	if hasExp {
+		d.expires[args[1]] = exp
+	}
+	return okReply
+}
+
+func get(c *client, args []string) any {
+	s, ok, err := typed[string](c.database(), args[0], c.s.now())
+	switch {
+	case err != nil:
+		return err
+	case !ok:
+		return nil
+	default:
+		return s
+	}
+}
+
+func setCmd(c *client, args []string) any {
+	key, val := args[0], args[1]
+	now := c.s.now()
+	o, err := parseSetOpts(args[2:], now)
+	if err != nil {
+		return err
+	}
+
+	d := c.database()
+	old, exists := d.get(key, now)
+	var prev any
+	if o.get && exists {
+		s, ok := old.(string)
+		if !ok {
+			return errWrongType
+		}
+		prev = s
+	}
+	if o.skip(exists) {
+		if o.get {
+			return prev
+		}
+		return nil
+	}
+
+	d.put(key, val)
+	if !o.keep {
+		delete(d.expires, key)
+	}
+	if !o.exp.IsZero() {
+		d.expires[key] = o.exp
+	}
+	if o.get {
+		return prev
+	}
+	return okReply
+}
+
+// setOpts are the options of SET.
+type setOpts struct {
+	nx, xx, keep, get bool
+	exp               time.Time
+}
+
+func parseSetOpts(args []string, now time.Time) (setOpts, error) {
+	var o setOpts
+	for i := 0; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			o.nx = true
+		case "XX":
+			o.xx = true
+		case "KEEPTTL":
+			o.keep = true
+		case "GET":
+			o.get = true
+		case "EX", "PX", "EXAT", "PXAT":
+			i++
+			if err := o.expiry(opt, args[i:], now); err != nil {
+				return o, err
+			}
+		default:
+			return o, errSyntax
+		}
+	}
+	if o.conflict() {
+		return o, errSyntax
+	}
+	return o, nil
+}
+
+// expiry sets the expiry time given with the EX, PX, EXAT or PXAT option, args starts from the option value.
+func (o *setOpts) expiry(opt string, args []string, now time.Time) error {
+	if len(args) == 0 || !o.exp.IsZero() {
+		return errSyntax
+	}
+	n, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	if n <= 0 {
+		return errors.New("ERR invalid expire time in 'set' command")
+	}
+	switch opt {
+	case "EX":
+		o.exp = now.Add(time.Duration(n) * time.Second)
+	case "PX":
+		o.exp = now.Add(time.Duration(n) * time.Millisecond)
+	case "EXAT":
+		o.exp = time.Unix(n, 0)
+	default:
+		o.exp = time.UnixMilli(n)
+	}
+	return nil
+}
+
+// conflict reports whether both NX and XX or both KEEPTTL and an expiry time are given.
+func (o setOpts) conflict() bool {
+	return o.nx && o.xx || o.keep && !o.exp.IsZero()
+}
+
+// skip reports whether NX or XX prevents setting a key which exists or not.
+func (o setOpts) skip(exists bool) bool {
+	return o.nx && exists || o.xx && !exists
+}
+
+func setnx(c *client, args []string) any {
+	d := c.database()
+	if _, ok := d.get(args[0], c.s.now()); ok {
+		return 0
+	}
+	d.put(args[0], args[1])
+	return 1
+}
+
+func setex(unit time.Duration) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		if n <= 0 {
+			return errors.New("ERR invalid expire time")
+		}
+		d := c.database()
+		d.put(args[0], args[2])
+		d.expires[args[0]] = c.s.now().Add(time.Duration(n) * unit)
+		return okReply
+	}
+}
+
+func mget(c *client, args []string) any {
+	d, now := c.database(), c.s.now()
+	vs := make([]any, 0, len(args))
+	for _, k := range args {
+		s, ok, err := typed[string](d, k, now)
+		if !ok || err != nil {
+			vs = append(vs, nil)
+			continue
+		}
+		vs = append(vs, s)
+	}
+	return vs
+}
+
+func mset(c *client, args []string) any {
+	if len(args)%2 != 0 {
+		return errors.New("ERR wrong number of arguments for 'mset' command")
+	}
+	d := c.database()
+	for i := 0; i < len(args); i += 2 {
+		d.put(args[i], args[i+1])
+		delete(d.expires, args[i])
+	}
+	return okReply
+}
+
+func getdel(c *client, args []string) any {
+	v := get(c, args)
+	if _, ok := v.(string); ok {
+		c.database().del(args[0])
+	}
+	return v
+}
+
+func getset(c *client, args []string) any {
+	v := get(c, args[:1])
+	if _, ok := v.(error); ok {
+		return v
+	}
+	d := c.database()
+	d.put(args[0], args[1])
+	delete(d.expires, args[0])
+	return v
+}
+
+func appendCmd(c *client, args []string) any {
+	d := c.database()
+	s, _, err := typed[string](d, args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	s += args[1]
+	d.put(args[0], s)
+	return len(s)
+}
+
+func strlen(c *client, args []string) any {
+	s, _, err := typed[string](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	return len(s)
+}
+
+func incrByCmd(sign int64) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || sign < 0 && n == math.MinInt64 {
+			return errNotInt
+		}
+		return incrBy(c, args[0], sign*n)
+	}
+}
+
+func incrBy(c *client, key string, delta int64) any {
+	d := c.database()
+	s, ok, err := typed[string](d, key, c.s.now())
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return errNotInt
+		}
+	}
+	if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += delta
+	d.put(key, strconv.FormatInt(n, 10))
+	return n
+}
+
+func incrByFloat(c *client, args []string) any {
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return errNotFloat
+	}
+	d := c.database()
+	s, ok, err := typed[string](d, args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	var f float64
+	if ok {
+		if f, err = strconv.ParseFloat(s, 64); err != nil {
+			return errNotFloat
+		}
+	}
+	f += delta
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errors.New("ERR increment would produce NaN or Infinity")
+	}
+	v := formatFloat(f)
+	d.put(args[0], v)
+	return v
+}
+
+// hashFor returns the hash of key, creating it if create is set.
+func hashFor(c *client, key string, create bool) (hash, error) {
+	d := c.database()
+	h, ok, err := typed[hash](d, key, c.s.now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok && create {
+		h = hash{}
+		d.put(key, h)
+	}
+	return h, nil
+}
+
+func hset(c *client, args []string) any {
+	if len(args)%2 != 1 {
+		return errors.New("ERR wrong number of arguments for 'hset' command")
+	}
+	h, err := hashFor(c, args[0], true)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	c.database().versions[args[0]]++
+	return n
+}
+
+func hmset(c *client, args []string) any {
+	if err, ok := hset(c, args).(error); ok {
+		return err
+	}
+	return okReply
+}
+
+func hsetnx(c *client, args []string) any {
+	h, err := hashFor(c, args[0], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return 0
+	}
+	h[args[1]] = args[2]
+	c.database().versions[args[0]]++
+	return 1
+}
+
+func hget(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	v, ok := h[args[1]]
+	if !ok {
+		return nil
+	}
+	return v
+}
+
+func hmget(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	vs := make([]any, 0, len(args)-1)
+	for _, f := range args[1:] {
+		if v, ok := h[f]; ok {
+			vs = append(vs, v)
+		} else {
+			vs = append(vs, nil)
+		}
+	}
+	return vs
+}
+
+func hdel(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range args[1:] {
+		if _, ok := h[f]; ok {
+			delete(h, f)
+			n++
+		}
+	}
+	d := c.database()
+	if len(h) == 0 {
+		d.del(args[0])
+	} else if n > 0 {
+		d.versions[args[0]]++
+	}
+	return n
+}
+
+func hgetall(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	m := mapReply{}
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		m = append(m, k, h[k])
+	}
+	return m
+}
+
+func hkeys(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	return slices.Sorted(maps.Keys(h))
+}
+
+func hvals(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	vs := []string{}
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		vs = append(vs, h[k])
+	}
+	return vs
+}
+
+func hlen(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	return len(h)
+}
+
+func hexists(c *client, args []string) any {
+	h, err := hashFor(c, args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return 1
+	}
+	return 0
+}
+
+func hincrby(c *client, args []string) any {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	h, err := hashFor(c, args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, ok := h[args[1]]; ok {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return errors.New("ERR hash value is not an integer")
+		}
+	}
+	if delta > 0 && n > math.MaxInt64-delta || delta < 0 && n < math.MinInt64-delta {
+		return errors.New("ERR increment or decrement would overflow")
+	}
+	n += delta
+	h[args[1]] = strconv.FormatInt(n, 10)
+	c.database().versions[args[0]]++
+	return n
+}
+
+// putList stores l into key, removing the key if l is empty.
+func putList(c *client, key string, l list) {
+	if len(l) == 0 {
+		c.database().del(key)
+		return
+	}
+	c.database().put(key, l)
+}
+
+func push(head bool) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		l, _, err := typed[list](c.database(), args[0], c.s.now())
+		if err != nil {
+			return err
+		}
+		for _, v := range args[1:] {
+			if head {
+				l = append(list{v}, l...)
+			} else {
+				l = append(l, v)
+			}
+		}
+		putList(c, args[0], l)
+		return len(l)
+	}
+}
+
+func pop(head bool) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		if len(args) > 2 {
+			return errSyntax
+		}
+		l, ok, err := typed[list](c.database(), args[0], c.s.now())
+		if err != nil {
+			return err
+		}
+		count := 1
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 0 {
+				return errors.New("ERR value is out of range, must be positive")
+			}
+			count = n
+			if !ok {
+				return nilArray{}
+			}
+		}
+		if !ok {
+			return nil
+		}
+
+		count = min(count, len(l))
+		var popped list
+		if head {
+			popped, l = l[:count], l[count:]
+		} else {
+			popped, l = slices.Clone(l[len(l)-count:]), l[:len(l)-count]
+			slices.Reverse(popped)
+		}
+		putList(c, args[0], slices.Clone(l))
+		if len(args) == 2 {
+			return []string(popped)
+		}
+		return popped[0]
+	}
+}
+
+func llen(c *client, args []string) any {
+	l, _, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	return len(l)
+}
+
+func lrange(c *client, args []string) any {
+	l, _, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	start, stop, err := listRange(args[1], args[2], len(l))
+	if err != nil {
+		return err
+	}
+	if start > stop {
+		return []string{}
+	}
+	return []string(l[start : stop+1])
+}
+
+func lindex(c *client, args []string) any {
+	l, _, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	if i < 0 {
+		i += len(l)
+	}
+	if i < 0 || i >= len(l) {
+		return nil
+	}
+	return l[i]
+}
+
+func lset(c *client, args []string) any {
+	l, ok, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoKey
+	}
+	i, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+	if i < 0 {
+		i += len(l)
+	}
+	if i < 0 || i >= len(l) {
+		return errors.New("ERR index out of range")
+	}
+	l[i] = args[2]
+	c.database().versions[args[0]]++
+	return okReply
+}
+
+func ltrim(c *client, args []string) any {
+	l, _, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	start, stop, err := listRange(args[1], args[2], len(l))
+	if err != nil {
+		return err
+	}
+	if start > stop {
+		putList(c, args[0], nil)
+	} else {
+		putList(c, args[0], slices.Clone(l[start:stop+1]))
+	}
+	return okReply
+}
+
+func lrem(c *client, args []string) any {
+	l, _, err := typed[list](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errNotInt
+	}
+
+	fromTail := count < 0
+	if fromTail {
+		count = -count
+		slices.Reverse(l)
+	}
+	kept, removed := list{}, 0
+	for _, v := range l {
+		if v == args[2] && (count == 0 || removed < count) {
+			removed++
+			continue
+		}
+		kept = append(kept, v)
+	}
+	if fromTail {
+		slices.Reverse(kept)
+	}
+	putList(c, args[0], kept)
+	return removed
+}
+
+// listRange normalizes the inclusive range start..stop for a list of length n. Empty ranges have start > stop.
+func listRange(startArg, stopArg string, n int) (int, int, error) {
+	start, err1 := strconv.Atoi(startArg)
+	stop, err2 := strconv.Atoi(stopArg)
+	if err1 != nil || err2 != nil {
+		return 0, 0, errNotInt
+	}
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start, stop = max(start, 0), min(stop, n-1)
+	if start >= n {
+		return 1, 0, nil
+	}
+	return start, stop, nil
+}
+
+func sadd(c *client, args []string) any {
+	d := c.database()
+	st, ok, err := typed[set](d, args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		st = set{}
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, ok := st[m]; !ok {
+			st[m] = struct{}{}
+			n++
+		}
+	}
+	d.put(args[0], st)
+	return n
+}
+
+func srem(c *client, args []string) any {
+	d := c.database()
+	st, _, err := typed[set](d, args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, ok := st[m]; ok {
+			delete(st, m)
+			n++
+		}
+	}
+	if len(st) == 0 {
+		d.del(args[0])
+	} else if n > 0 {
+		d.versions[args[0]]++
+	}
+	return n
+}
+
+func smembers(c *client, args []string) any {
+	st, _, err := typed[set](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	return members(st)
+}
+
+func sismember(c *client, args []string) any {
+	st, _, err := typed[set](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	if _, ok := st[args[1]]; ok {
+		return 1
+	}
+	return 0
+}
+
+func smismember(c *client, args []string) any {
+	st, _, err := typed[set](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	vs := make([]any, 0, len(args)-1)
+	for _, m := range args[1:] {
+		if _, ok := st[m]; ok {
+			vs = append(vs, 1)
+		} else {
+			vs = append(vs, 0)
+		}
+	}
+	return vs
+}
+
+func scard(c *client, args []string) any {
+	st, _, err := typed[set](c.database(), args[0], c.s.now())
+	if err != nil {
+		return err
+	}
+	return len(st)
+}
+
+func setOp(op func(a, b set) set) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		d, now := c.database(), c.s.now()
+		var res set
+		for i, k := range args {
+			st, _, err := typed[set](d, k, now)
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				res = maps.Clone(st)
+				if res == nil {
+					res = set{}
+				}
+				continue
+			}
+			res = op(res, st)
+		}
+		return members(res)
+	}
+}
+
+func intersect(a, b set) set {
+	res := set{}
+	for m := range a {
+		if _, ok := b[m]; ok {
+			res[m] = struct{}{}
+		}
+	}
+	return res
+}
+
+func union(a, b set) set {
+	res := maps.Clone(a)
+	maps.Copy(res, b)
+	return res
+}
+
+func diff(a, b set) set {
+	res := set{}
+	for m := range a {
+		if _, ok := b[m]; !ok {
+			res[m] = struct{}{}
+		}
+	}
+	return res
+}
+
+func members(st set) setReply {
+	r := setReply{}
+	for _, m := range slices.Sorted(maps.Keys(st)) {
+		r = append(r, m)
+	}
+	return r
+}
+
+func subscribe(pattern bool) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		kind, subs := "subscribe", c.channels
+		if pattern {
+			kind, subs = "psubscribe", c.patterns
+		}
+		var r replies
+		for _, ch := range args {
+			subs[ch] = struct{}{}
+			r = append(r, pushReply{kind, ch, c.subscriptions()})
+		}
+		return r
+	}
+}
+
+func unsubscribe(pattern bool) func(*client, []string) any {
+	return func(c *client, args []string) any {
+		kind, subs := "unsubscribe", c.channels
+		if pattern {
+			kind, subs = "punsubscribe", c.patterns
+		}
+		if len(args) == 0 {
+			args = slices.Sorted(maps.Keys(subs))
+		}
+		if len(args) == 0 {
+			return pushReply{kind, nil, c.subscriptions()}
+		}
+		var r replies
+		for _, ch := range args {
+			delete(subs, ch)
+			r = append(r, pushReply{kind, ch, c.subscriptions()})
+		}
+		return r
+	}
+}
+
+func publish(c *client, args []string) any {
+	ds := c.s.publish(args[0], args[1])
+	c.after = append(c.after, ds...)
+	return len(ds)
+}
+
+func multi(c *client, _ []string) any {
+	if c.multi {
+		return errors.New("ERR MULTI calls can not be nested")
+	}
+	c.multi, c.dirty, c.queue = true, false, nil
+	return okReply
+}
+
+func exec(c *client, _ []string) any {
+	if !c.multi {
+		return errors.New("ERR EXEC without MULTI")
+	}
+	queue, dirty, watched := c.queue, c.dirty, c.watched
+	c.multi, c.dirty, c.queue, c.watched = false, false, nil, nil
+	if dirty {
+		return errors.New("EXECABORT Transaction discarded because of previous errors.") //nolint:staticcheck // Clients match the exact Redis error text.
+	}
+
+	now := c.s.now()
+	for k, v := range watched {
+		d := c.s.dbs[k.db]
+		d.get(k.key, now)
+		if d.versions[k.key] != v {
+			return nilArray{}
+		}
+	}
+
+	results := make([]any, 0, len(queue))
+	for _, args := range queue {
+		results = append(results, c.s.commands[strings.ToLower(args[0])].fn(c, args[1:]))
+	}
+	return results
+}
+
+func discard(c *client, _ []string) any {
+	if !c.multi {
+		return errors.New("ERR DISCARD without MULTI")
+	}
+	c.multi, c.dirty, c.queue, c.watched = false, false, nil, nil
+	return okReply
+}
+
+func watch(c *client, args []string) any {
+	if c.multi {
+		return errors.New("ERR WATCH inside MULTI is not allowed")
+	}
+	if c.watched == nil {
+		c.watched = map[watchKey]uint64{}
+	}
+	d, now := c.database(), c.s.now()
+	for _, k := range args {
+		d.get(k, now)
+		c.watched[watchKey{c.db, k}] = d.versions[k]
+	}
+	return okReply
+}
+
+func unwatch(c *client, _ []string) any {
+	c.watched = nil
+	return okReply
+}
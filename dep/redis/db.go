@@ -0,0 +1,181 @@
+package redis
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const databases = 16
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// Value types stored in a database. Strings are stored as string.
+type (
+	hash map[string]string
+	list []string
+	set  map[string]struct{}
+)
+
+// db is a single numbered database.
+type db struct {
+	data    map[string]any
+	expires map[string]time.Time
+	// versions are incremented on every change of a key, see WATCH.
+	versions map[string]uint64
+}
+
+func newDB() *db {
+	return &db{data: map[string]any{}, expires: map[string]time.Time{}, versions: map[string]uint64{}}
+}
+
+// get returns the value of key, removing it first if it has expired.
+func (d *db) get(key string, now time.Time) (any, bool) {
+	if exp, ok := d.expires[key]; ok && !now.Before(exp) {
+		d.del(key)
+	}
+	v, ok := d.data[key]
+	return v, ok
+}
+
+// put sets the value of key keeping its expiry.
+func (d *db) put(key string, v any) {
+	d.data[key] = v
+	d.versions[key]++
+}
+
+func (d *db) del(key string) bool {
+	if _, ok := d.data[key]; !ok {
+		return false
+	}
+	delete(d.data, key)
+	delete(d.expires, key)
+	d.versions[key]++
+	return true
+}
+
+func (d *db) flush() {
+	for k := range d.data {
+		d.versions[k]++
+	}
+	d.data, d.expires = map[string]any{}, map[string]time.Time{}
+}
+
+// keys returns the live keys matching the glob pattern in lexical order.
+func (d *db) keys(pattern string, now time.Time) []string {
+	var keys []string
+	for _, k := range slices.Sorted(maps.Keys(d.data)) {
+		if _, ok := d.get(k, now); ok && match(pattern, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// typed returns the value of key as T. Missing keys return the zero value.
+func typed[T any](d *db, key string, now time.Time) (T, bool, error) {
+	var zero T
+	v, ok := d.get(key, now)
+	if !ok {
+		return zero, false, nil
+	}
+	t, ok := v.(T)
+	if !ok {
+		return zero, false, errWrongType
+	}
+	return t, true, nil
+}
+
+func typeName(v any) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case hash:
+		return "hash"
+	case list:
+		return "list"
+	case set:
+		return "set"
+	default:
+		return "none"
+	}
+}
+
+// match reports whether s matches the Redis glob style pattern supporting *, ?, [...] and \ escapes.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == '*' {
+			return matchStar(strings.TrimLeft(pattern, "*"), s)
+		}
+		n, ok := matchOne(pattern, s)
+		if !ok {
+			return false
+		}
+		pattern, s = pattern[n:], s[1:]
+	}
+	return s == ""
+}
+
+// matchStar reports whether the pattern following a * matches s or any of its suffixes.
+func matchStar(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	for i := range len(s) + 1 {
+		if match(pattern, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOne matches the first byte of s against the first element of pattern, which isn't a *.
+// It returns the length of the element.
+func matchOne(pattern, s string) (int, bool) {
+	if s == "" {
+		return 0, false
+	}
+	switch pattern[0] {
+	case '?':
+		return 1, true
+	case '[':
+		end := strings.IndexByte(pattern[1:], ']')
+		if end < 0 {
+			return 1, s[0] == '['
+		}
+		return end + 2, matchClass(pattern[1:end+1], s[0])
+	case '\\':
+		if len(pattern) > 1 {
+			return 2, s[0] == pattern[1]
+		}
+	}
+	return 1, s[0] == pattern[0]
+}
+
+func matchClass(class string, c byte) bool {
+	if rest, ok := strings.CutPrefix(class, "^"); ok {
+		return !inClass(rest, c)
+	}
+	return inClass(class, c)
+}
+
+// inClass reports whether c is one of the characters or ranges of class.
+func inClass(class string, c byte) bool {
+	for i := 0; i < len(class); i++ {
+		lo, hi := class[i], class[i]
+		switch {
+		case class[i] == '\\' && i+1 < len(class):
+			i++
+			lo, hi = class[i], class[i]
+		case i+2 < len(class) && class[i+1] == '-':
+			lo, hi = min(class[i], class[i+2]), max(class[i], class[i+2])
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			return true
+		}
+	}
+	return false
+}
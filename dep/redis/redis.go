@@ -0,0 +1,422 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/port"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply = strerr.Error("failed to apply Opt")
+	ErrListen   = strerr.Error("failed to listen")
+)
+
+// Server is an in-process Redis stand-in speaking RESP2 and RESP3.
+// It supports strings, hashes, lists, sets, key expiry, pub/sub and transactions.
+// Unsupported commands are rejected with an error naming the command.
+type Server struct {
+	opts     []Opt
+	commands map[string]command
+	name     string
+	port     *port.Port
+	password string
+	clock    func() time.Time
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	conns  map[*client]struct{}
+	closed bool
+	dbs    []*db
+	offset time.Duration
+	lastID int64
+}
+
+type Opt func(*Server) error
+
+// New creates new Server dependency.
+func New(opts ...Opt) *Server {
+	return &Server{opts: opts, commands: commands}
+}
+
+func (s *Server) Start() error {
+	s.password, s.clock, s.offset = "", time.Now, 0
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	addr := "127.0.0.1:0"
+	if s.port != nil {
+		if err := s.port.Release(); err != nil {
+			return fmt.Errorf("%w: %w", ErrListen, err)
+		}
+		addr = s.port.Addr()
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+	s.listener = l
+	s.conns, s.closed = map[*client]struct{}{}, false
+	s.dbs = make([]*db, databases)
+	for i := range s.dbs {
+		s.dbs[i] = newDB()
+	}
+	s.wg.Go(s.accept)
+	return nil
+}
+
+func (s *Server) Ready() error { return nil }
+
+// Stop closes the listener and all connections.
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	if s.port != nil {
+		err = errors.Join(err, s.port.Close())
+	}
+	return err
+}
+
+// Name returns the name set with WithName or "redis".
+func (s *Server) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "redis"
+}
+
+// Outputs returns the Addr, Host, Port and URL of the server, for example {{.redis.URL}}.
+func (s *Server) Outputs() map[string]string {
+	if s.listener == nil {
+		return nil
+	}
+	host, p, _ := net.SplitHostPort(s.Addr())
+	return map[string]string{"Addr": s.Addr(), "Host": host, "Port": p, "URL": s.URL()}
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// URL returns redis://[:password@]host:port URL of the server.
+func (s *Server) URL() string {
+	if s.password != "" {
+		return "redis://:" + s.password + "@" + s.Addr()
+	}
+	return "redis://" + s.Addr()
+}
+
+// Now returns the current time of the server clock which is used for key expiry.
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+// Advance moves the server clock forward by d, expiring the keys whose TTL elapses.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.offset += d
+}
+
+// Get returns the string value of key in database 0.
+func (s *Server) Get(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok, err := typed[string](s.dbs[0], key, s.now())
+	return v, ok && err == nil
+}
+
+// Set sets key to a string value in database 0.
+func (s *Server) Set(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.dbs[0]
+	d.put(key, value)
+	delete(d.expires, key)
+}
+
+// TTL returns the remaining time to live of key in database 0, or false if it doesn't exist or has no expiry.
+func (s *Server) TTL(key string) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, now := s.dbs[0], s.now()
+	if _, ok := d.get(key, now); !ok {
+		return 0, false
+	}
+	exp, ok := d.expires[key]
+	return exp.Sub(now), ok
+}
+
+// Keys returns the keys of database 0 in lexical order.
+func (s *Server) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dbs[0].keys("*", s.now())
+}
+
+// FlushAll removes all keys from all databases.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.dbs {
+		d.flush()
+	}
+}
+
+// Publish publishes message to channel and returns the number of receiving clients.
+func (s *Server) Publish(channel, message string) int {
+	s.mu.Lock()
+	deliver := s.publish(channel, message)
+	s.mu.Unlock()
+	deliver.run()
+	return len(deliver)
+}
+
+func (s *Server) now() time.Time {
+	return s.clock().Add(s.offset)
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.lastID++
+		c := &client{
+			s:        s,
+			id:       s.lastID,
+			conn:     conn,
+			r:        bufio.NewReader(conn),
+			w:        &writer{Writer: bufio.NewWriter(conn)},
+			proto:    2,
+			channels: map[string]struct{}{},
+			patterns: map[string]struct{}{},
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+			}()
+			c.serve()
+		})
+	}
+}
+
+// client is the state of a single connection.
+type client struct {
+	s    *Server
+	id   int64
+	conn net.Conn
+	r    *bufio.Reader
+
+	// wmu guards w which is also written by publishers.
+	wmu sync.Mutex
+	w   *writer
+
+	// The fields below are guarded by Server.mu.
+	// proto is the protocol version negotiated with HELLO. It's passed to reply so that writing
+	// replies doesn't need Server.mu.
+	proto    int
+	name     string
+	db       int
+	authed   bool
+	multi    bool
+	dirty    bool
+	queue    [][]string
+	watched  map[watchKey]uint64
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	quit     bool
+	// after is run after the reply is written, e.g. to deliver published messages.
+	after deliveries
+}
+
+type watchKey struct {
+	db  int
+	key string
+}
+
+func (c *client) serve() {
+	defer func() { _ = c.conn.Close() }()
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.s.mu.Lock()
+				proto := c.proto
+				c.s.mu.Unlock()
+				c.reply(err, proto)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		c.s.mu.Lock()
+		reply := c.dispatch(args)
+		after, quit, proto := c.after, c.quit, c.proto
+		c.after = nil
+		c.s.mu.Unlock()
+
+		c.reply(reply, proto)
+		after.run()
+		if quit {
+			return
+		}
+	}
+}
+
+// reply writes v encoded with the protocol version proto.
+func (c *client) reply(v any, proto int) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.w.proto = proto
+	c.w.write(v)
+	_ = c.w.Flush()
+}
+
+// dispatch runs or queues a command. It's called with Server.mu held.
+func (c *client) dispatch(args []string) any {
+	name := strings.ToLower(args[0])
+	cmd, err := c.lookup(name, args)
+	if err != nil {
+		c.dirty = c.multi
+		return err
+	}
+	if err := c.allowed(name, cmd); err != nil {
+		return err
+	}
+	if c.multi && !cmd.noQueue {
+		c.queue = append(c.queue, args)
+		return simple("QUEUED")
+	}
+	return cmd.fn(c, args[1:])
+}
+
+// lookup returns the command called name and checks the number of args.
+func (c *client) lookup(name string, args []string) (command, error) {
+	cmd, ok := c.s.commands[name]
+	if !ok {
+		return cmd, fmt.Errorf("ERR unsupported command '%s': not implemented by the tstr redis stand-in", args[0])
+	}
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		return cmd, fmt.Errorf("ERR wrong number of arguments for '%s' command", name)
+	}
+	return cmd, nil
+}
+
+// allowed checks that cmd can be run in the authentication and subscription state of the client.
+func (c *client) allowed(name string, cmd command) error {
+	if c.s.password != "" && !c.authed && !cmd.noAuth {
+		return errors.New("NOAUTH Authentication required.") //nolint:staticcheck // Clients match the exact Redis error text.
+	}
+	if c.proto == 2 && c.subscriptions() > 0 && !cmd.pubsub {
+		return fmt.Errorf("ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", name)
+	}
+	return nil
+}
+
+func (c *client) database() *db {
+	return c.s.dbs[c.db]
+}
+
+func (c *client) subscriptions() int {
+	return len(c.channels) + len(c.patterns)
+}
+
+// publish finds the subscribers of channel. The returned deliveries must be called without Server.mu held.
+func (s *Server) publish(channel, message string) deliveries {
+	var ds deliveries
+	for c := range s.conns {
+		if _, ok := c.channels[channel]; ok {
+			ds = append(ds, delivery{c, c.proto, pushReply{"message", channel, message}})
+		}
+		for p := range c.patterns {
+			if match(p, channel) {
+				ds = append(ds, delivery{c, c.proto, pushReply{"pmessage", p, channel, message}})
+			}
+		}
+	}
+	return ds
+}
+
+type delivery struct {
+	c     *client
+	proto int
+	msg   pushReply
+}
+
+type deliveries []delivery
+
+func (ds deliveries) run() {
+	for _, d := range ds {
+		d.c.reply(d.msg, d.proto)
+	}
+}
+
+// WithName sets the name of the server which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *Server) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithPort sets the port the server listens on.
+func WithPort(p *port.Port) Opt {
+	return func(s *Server) error {
+		s.port = p
+		return nil
+	}
+}
+
+// WithPassword requires clients to authenticate with AUTH or HELLO using password.
+func WithPassword(password string) Opt {
+	return func(s *Server) error {
+		s.password = password
+		return nil
+	}
+}
+
+// WithClock sets the clock used for key expiry, defaults to time.Now. See also Server.Advance.
+func WithClock(now func() time.Time) Opt {
+	return func(s *Server) error {
+		s.clock = now
+		return nil
+	}
+}
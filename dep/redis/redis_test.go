@@ -0,0 +1,280 @@
+package redis_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/redis"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Strings(t *testing.T) {
+	s := redis.New(redis.WithName("cache"))
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, "redis://"+s.Addr(), s.Outputs()["URL"])
+
+		c := dial(t, s)
+		assert.Equal(t, "+PONG\r\n", c.do(t, "PING"))
+		assert.Equal(t, "+OK\r\n", c.do(t, "SET", "k", "v"))
+		assert.Equal(t, "$1\r\nv\r\n", c.do(t, "GET", "k"))
+		assert.Equal(t, "$-1\r\n", c.do(t, "GET", "missing"))
+		assert.Equal(t, "$-1\r\n", c.do(t, "SET", "k", "v2", "NX"))
+		assert.Equal(t, "$1\r\nv\r\n", c.do(t, "SET", "k", "v2", "GET"))
+		assert.Equal(t, ":1\r\n", c.do(t, "INCR", "n"))
+		assert.Equal(t, ":-9\r\n", c.do(t, "DECRBY", "n", "10"))
+		assert.Equal(t, "$3\r\n1.5\r\n", c.do(t, "INCRBYFLOAT", "f", "1.5"))
+		assert.Equal(t, "-ERR value is not an integer or out of range\r\n", c.do(t, "INCR", "k"))
+		assert.Equal(t, "+OK\r\n", c.do(t, "MSET", "a", "1", "b", "2"))
+		assert.Equal(t, "*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n2\r\n", c.do(t, "MGET", "a", "x", "b"))
+		assert.Equal(t, ":3\r\n", c.do(t, "APPEND", "a", "23"))
+		assert.Equal(t, "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nk\r\n", c.do(t, "KEYS", "[^fn]"))
+		assert.Equal(t, "*2\r\n$1\r\n0\r\n*1\r\n$1\r\nf\r\n", c.do(t, "SCAN", "0", "MATCH", "f*"))
+		assert.Equal(t, "+string\r\n", c.do(t, "TYPE", "a"))
+		assert.Equal(t, ":2\r\n", c.do(t, "DEL", "a", "b", "x"))
+
+		assert.Equal(t, "-ERR unsupported command 'BLPOP': not implemented by the tstr redis stand-in\r\n", c.do(t, "BLPOP", "l", "0"))
+		assert.Equal(t, "-ERR wrong number of arguments for 'get' command\r\n", c.do(t, "GET"))
+
+		c.send(t, "PING inline\r\n")
+		assert.Equal(t, "$6\r\ninline\r\n", c.read(t))
+
+		assert.Equal(t, "+OK\r\n", c.do(t, "SELECT", "1"))
+		assert.Equal(t, "$-1\r\n", c.do(t, "GET", "k"))
+
+		v, ok := s.Get("k")
+		assert.True(t, ok)
+		assert.Equal(t, "v2", v)
+		s.Set("direct", "value")
+		assert.Equal(t, []string{"direct", "f", "k", "n"}, s.Keys())
+		s.FlushAll()
+		assert.Empty(t, s.Keys())
+	}, nil)
+}
+
+func TestServer_DataTypes(t *testing.T) {
+	s := redis.New()
+	deptest.ErrorIs(t, s, func() {
+		c := dial(t, s)
+		assert.Equal(t, ":2\r\n", c.do(t, "HSET", "h", "f1", "v1", "f2", "v2"))
+		assert.Equal(t, "$2\r\nv1\r\n", c.do(t, "HGET", "h", "f1"))
+		assert.Equal(t, ":5\r\n", c.do(t, "HINCRBY", "h", "n", "5"))
+		assert.Equal(t, "*6\r\n$2\r\nf1\r\n$2\r\nv1\r\n$2\r\nf2\r\n$2\r\nv2\r\n$1\r\nn\r\n$1\r\n5\r\n", c.do(t, "HGETALL", "h"))
+		assert.Equal(t, ":1\r\n", c.do(t, "HEXISTS", "h", "f1"))
+		assert.Equal(t, ":2\r\n", c.do(t, "HDEL", "h", "f1", "n"))
+		assert.Equal(t, ":1\r\n", c.do(t, "HLEN", "h"))
+		assert.Equal(t, "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", c.do(t, "GET", "h"))
+
+		assert.Equal(t, ":3\r\n", c.do(t, "RPUSH", "l", "a", "b", "c"))
+		assert.Equal(t, ":4\r\n", c.do(t, "LPUSH", "l", "z"))
+		assert.Equal(t, "*4\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", c.do(t, "LRANGE", "l", "0", "-1"))
+		assert.Equal(t, "$1\r\nz\r\n", c.do(t, "LPOP", "l"))
+		assert.Equal(t, "*2\r\n$1\r\nc\r\n$1\r\nb\r\n", c.do(t, "RPOP", "l", "2"))
+		assert.Equal(t, "$1\r\na\r\n", c.do(t, "LINDEX", "l", "-1"))
+		assert.Equal(t, "$1\r\na\r\n", c.do(t, "RPOP", "l"))
+		assert.Equal(t, ":0\r\n", c.do(t, "EXISTS", "l"))
+		assert.Equal(t, "*-1\r\n", c.do(t, "LPOP", "l", "1"))
+
+		assert.Equal(t, ":3\r\n", c.do(t, "SADD", "s1", "a", "b", "c"))
+		assert.Equal(t, ":2\r\n", c.do(t, "SADD", "s2", "b", "c"))
+		assert.Equal(t, ":1\r\n", c.do(t, "SISMEMBER", "s1", "a"))
+		assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", c.do(t, "SINTER", "s1", "s2"))
+		assert.Equal(t, "*1\r\n$1\r\na\r\n", c.do(t, "SDIFF", "s1", "s2"))
+		assert.Equal(t, ":1\r\n", c.do(t, "SREM", "s1", "a"))
+		assert.Equal(t, "*2\r\n$1\r\nb\r\n$1\r\nc\r\n", c.do(t, "SMEMBERS", "s1"))
+	}, nil)
+}
+
+func TestServer_Expiry(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := redis.New(redis.WithClock(func() time.Time { return start }))
+	deptest.ErrorIs(t, s, func() {
+		c := dial(t, s)
+		assert.Equal(t, "+OK\r\n", c.do(t, "SET", "session", "1", "EX", "60"))
+		assert.Equal(t, ":60\r\n", c.do(t, "TTL", "session"))
+		assert.Equal(t, ":-2\r\n", c.do(t, "TTL", "missing"))
+		assert.Equal(t, ":0\r\n", c.do(t, "PEXPIRE", "session", "1500", "GT"))
+
+		s.Advance(30 * time.Second)
+		assert.Equal(t, ":30\r\n", c.do(t, "TTL", "session"))
+		ttl, ok := s.TTL("session")
+		assert.True(t, ok)
+		assert.Equal(t, 30*time.Second, ttl)
+
+		s.Advance(30 * time.Second)
+		assert.Equal(t, "$-1\r\n", c.do(t, "GET", "session"))
+		_, ok = s.Get("session")
+		assert.False(t, ok)
+
+		assert.Equal(t, "+OK\r\n", c.do(t, "SETEX", "k", "10", "v"))
+		assert.Equal(t, ":1\r\n", c.do(t, "PERSIST", "k"))
+		assert.Equal(t, ":-1\r\n", c.do(t, "TTL", "k"))
+		assert.Equal(t, ":1\r\n", c.do(t, "EXPIREAT", "k", strconv.FormatInt(s.Now().Add(5*time.Second).Unix(), 10)))
+		assert.Equal(t, ":5000\r\n", c.do(t, "PTTL", "k"))
+		assert.Equal(t, ":1\r\n", c.do(t, "EXPIRE", "k", "0"))
+		assert.Equal(t, ":0\r\n", c.do(t, "EXISTS", "k"))
+	}, nil)
+}
+
+func TestServer_RESP3(t *testing.T) {
+	s := redis.New()
+	deptest.ErrorIs(t, s, func() {
+		c := dial(t, s)
+		hello := c.do(t, "HELLO", "3", "SETNAME", "app")
+		assert.True(t, strings.HasPrefix(hello, "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n"), hello)
+		assert.Contains(t, hello, "$5\r\nproto\r\n:3\r\n")
+		assert.Equal(t, "$3\r\napp\r\n", c.do(t, "CLIENT", "GETNAME"))
+
+		assert.Equal(t, "_\r\n", c.do(t, "GET", "missing"))
+		assert.Equal(t, ":1\r\n", c.do(t, "HSET", "h", "f", "v"))
+		assert.Equal(t, "%1\r\n$1\r\nf\r\n$1\r\nv\r\n", c.do(t, "HGETALL", "h"))
+		assert.Equal(t, ":1\r\n", c.do(t, "SADD", "s", "m"))
+		assert.Equal(t, "~1\r\n$1\r\nm\r\n", c.do(t, "SMEMBERS", "s"))
+		assert.Equal(t, "-NOPROTO unsupported protocol version\r\n", c.do(t, "HELLO", "4"))
+	}, nil)
+}
+
+func TestServer_PubSub(t *testing.T) {
+	s := redis.New()
+	deptest.ErrorIs(t, s, func() {
+		sub, pub := dial(t, s), dial(t, s)
+		assert.Equal(t, "*3\r\n$9\r\nsubscribe\r\n$6\r\norders\r\n:1\r\n", sub.do(t, "SUBSCRIBE", "orders"))
+		assert.Equal(t, "*3\r\n$10\r\npsubscribe\r\n$3\r\nor*\r\n:2\r\n", sub.do(t, "PSUBSCRIBE", "or*"))
+		assert.True(t, strings.HasPrefix(sub.do(t, "GET", "k"), "-ERR Can't execute 'get'"))
+		assert.Equal(t, "*2\r\n$4\r\npong\r\n$0\r\n\r\n", sub.do(t, "PING"))
+
+		assert.Equal(t, ":2\r\n", pub.do(t, "PUBLISH", "orders", "created"))
+		assert.Equal(t, "*3\r\n$7\r\nmessage\r\n$6\r\norders\r\n$7\r\ncreated\r\n", sub.read(t))
+		assert.Equal(t, "*4\r\n$8\r\npmessage\r\n$3\r\nor*\r\n$6\r\norders\r\n$7\r\ncreated\r\n", sub.read(t))
+
+		assert.Equal(t, 1, s.Publish("orm", "x"))
+		assert.Equal(t, "*4\r\n$8\r\npmessage\r\n$3\r\nor*\r\n$3\r\norm\r\n$1\r\nx\r\n", sub.read(t))
+
+		assert.Equal(t, "*3\r\n$11\r\nunsubscribe\r\n$6\r\norders\r\n:1\r\n", sub.do(t, "UNSUBSCRIBE"))
+		assert.Equal(t, "*3\r\n$12\r\npunsubscribe\r\n$3\r\nor*\r\n:0\r\n", sub.do(t, "PUNSUBSCRIBE"))
+		assert.Equal(t, "$-1\r\n", sub.do(t, "GET", "k"))
+
+		sub3 := dial(t, s)
+		sub3.do(t, "HELLO", "3")
+		assert.Equal(t, ">3\r\n$9\r\nsubscribe\r\n$1\r\nc\r\n:1\r\n", sub3.do(t, "SUBSCRIBE", "c"))
+		assert.Equal(t, "_\r\n", sub3.do(t, "GET", "k"))
+		assert.Equal(t, ":1\r\n", pub.do(t, "PUBLISH", "c", "m"))
+		assert.Equal(t, ">3\r\n$7\r\nmessage\r\n$1\r\nc\r\n$1\r\nm\r\n", sub3.read(t))
+	}, nil)
+}
+
+func TestServer_Transactions(t *testing.T) {
+	s := redis.New()
+	deptest.ErrorIs(t, s, func() {
+		c, other := dial(t, s), dial(t, s)
+		assert.Equal(t, "+OK\r\n", c.do(t, "MULTI"))
+		assert.Equal(t, "+QUEUED\r\n", c.do(t, "SET", "k", "1"))
+		assert.Equal(t, "+QUEUED\r\n", c.do(t, "INCR", "k"))
+		assert.Equal(t, "+QUEUED\r\n", c.do(t, "HSET", "k", "f", "v"))
+		assert.Equal(t, "*3\r\n+OK\r\n:2\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n", c.do(t, "EXEC"))
+
+		assert.Equal(t, "+OK\r\n", c.do(t, "WATCH", "k"))
+		assert.Equal(t, "+OK\r\n", other.do(t, "SET", "k", "changed"))
+		assert.Equal(t, "+OK\r\n", c.do(t, "MULTI"))
+		assert.Equal(t, "+QUEUED\r\n", c.do(t, "SET", "k", "mine"))
+		assert.Equal(t, "*-1\r\n", c.do(t, "EXEC"))
+		v, _ := s.Get("k")
+		assert.Equal(t, "changed", v)
+
+		assert.Equal(t, "+OK\r\n", c.do(t, "MULTI"))
+		assert.True(t, strings.HasPrefix(c.do(t, "NOPE"), "-ERR unsupported command"))
+		assert.Equal(t, "-EXECABORT Transaction discarded because of previous errors.\r\n", c.do(t, "EXEC"))
+		assert.Equal(t, "-ERR EXEC without MULTI\r\n", c.do(t, "EXEC"))
+
+		assert.Equal(t, "+OK\r\n", c.do(t, "MULTI"))
+		assert.Equal(t, "+QUEUED\r\n", c.do(t, "SET", "k", "discarded"))
+		assert.Equal(t, "+OK\r\n", c.do(t, "DISCARD"))
+		v, _ = s.Get("k")
+		assert.Equal(t, "changed", v)
+	}, nil)
+}
+
+func TestServer_Auth(t *testing.T) {
+	p := port.MustReserve(port.TCP, port.WithLockDir(t.TempDir()), port.WithName("redis-auth"))
+	s := redis.New(redis.WithPassword("secret"), redis.WithPort(p))
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, p.Addr(), s.Addr())
+		assert.Equal(t, "redis://:secret@"+s.Addr(), s.Outputs()["URL"])
+
+		c := dial(t, s)
+		assert.Equal(t, "-NOAUTH Authentication required.\r\n", c.do(t, "GET", "k"))
+		assert.Equal(t, "-WRONGPASS invalid username-password pair or user is disabled.\r\n", c.do(t, "AUTH", "wrong"))
+		assert.Equal(t, "+OK\r\n", c.do(t, "AUTH", "default", "secret"))
+		assert.Equal(t, "$-1\r\n", c.do(t, "GET", "k"))
+
+		c = dial(t, s)
+		assert.Contains(t, c.do(t, "HELLO", "3", "AUTH", "default", "secret"), "$5\r\nproto\r\n:3\r\n")
+		assert.Equal(t, "_\r\n", c.do(t, "GET", "k"))
+	}, nil)
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func dial(t *testing.T, s *redis.Server) *conn {
+	t.Helper()
+	c, err := net.Dial("tcp", s.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return &conn{Conn: c, r: bufio.NewReader(c)}
+}
+
+// do sends a command and returns the raw reply.
+func (c *conn) do(t *testing.T, args ...string) string {
+	t.Helper()
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	c.send(t, cmd)
+	return c.read(t)
+}
+
+func (c *conn) send(t *testing.T, s string) {
+	t.Helper()
+	_, err := io.WriteString(c, s)
+	require.NoError(t, err)
+}
+
+// read reads a single raw reply.
+func (c *conn) read(t *testing.T) string {
+	t.Helper()
+	require.NoError(t, c.SetReadDeadline(time.Now().Add(5*time.Second)))
+	line, err := c.r.ReadString('\n')
+	require.NoError(t, err)
+
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	switch line[0] {
+	case '$':
+		if n < 0 {
+			return line
+		}
+		buf := make([]byte, n+2)
+		_, err := io.ReadFull(c.r, buf)
+		require.NoError(t, err)
+		return line + string(buf)
+	case '*', '~', '>', '%':
+		if line[0] == '%' {
+			n *= 2
+		}
+		for range n {
+			line += c.read(t)
+		}
+	}
+	return line
+}
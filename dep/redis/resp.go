@@ -0,0 +1,191 @@
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxArgs    = 1 << 20
+	maxBulkLen = 512 << 20
+)
+
+var errProtocol = errors.New("ERR Protocol error")
+
+// Reply types which are encoded differently in RESP2 and RESP3.
+type (
+	// simple is a simple string reply.
+	simple string
+	// mapReply is a map of alternating keys and values, a flat array in RESP2.
+	mapReply []any
+	// setReply is a set, an array in RESP2.
+	setReply []any
+	// pushReply is an out of band message, an array in RESP2.
+	pushReply []any
+	// nilArray is a null reply which is a null array in RESP2.
+	nilArray struct{}
+	// replies are several replies to a single command, e.g. SUBSCRIBE with several channels.
+	replies []any
+)
+
+// readCommand reads a command sent as an array of bulk strings or as an inline command.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	args := make([]string, 0, max(n, 0))
+	for range n {
+		arg, err := readBulk(r)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+func readBulk(r *bufio.Reader) (string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return "", fmt.Errorf("%w: expected '$', got '%.1s'", errProtocol, line)
+	}
+	size, err := strconv.Atoi(line[1:])
+	if err != nil || size < 0 || size > maxBulkLen {
+		return "", fmt.Errorf("%w: invalid bulk length", errProtocol)
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf[:size]), nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// writer encodes replies with the protocol version negotiated with HELLO.
+type writer struct {
+	*bufio.Writer
+	// proto is set for each reply, see client.reply.
+	proto int
+}
+
+func (w *writer) write(v any) {
+	switch v := v.(type) {
+	case nil:
+		w.null("$-1")
+	case nilArray:
+		w.null("*-1")
+	case simple:
+		w.line("+", string(v))
+	case error:
+		w.line("-", v.Error())
+	case int:
+		w.line(":", strconv.Itoa(v))
+	case int64:
+		w.line(":", strconv.FormatInt(v, 10))
+	case string:
+		w.bulk(v)
+	default:
+		w.writeAggregate(v)
+	}
+}
+
+func (w *writer) writeAggregate(v any) {
+	switch v := v.(type) {
+	case []string:
+		w.line("*", strconv.Itoa(len(v)))
+		for _, s := range v {
+			w.bulk(s)
+		}
+	case []any:
+		w.aggregate("*", v)
+	case mapReply:
+		w.writeMap(v)
+	case setReply:
+		w.aggregate(w.resp3("~"), v)
+	case pushReply:
+		w.aggregate(w.resp3(">"), v)
+	case replies:
+		for _, r := range v {
+			w.write(r)
+		}
+	default:
+		panic(fmt.Sprintf("redis: unsupported reply type %T", v))
+	}
+}
+
+func (w *writer) writeMap(v mapReply) {
+	if w.proto != 3 {
+		w.aggregate("*", v)
+		return
+	}
+	w.line("%", strconv.Itoa(len(v)/2))
+	for _, e := range v {
+		w.write(e)
+	}
+}
+
+func (w *writer) aggregate(prefix string, vs []any) {
+	w.line(prefix, strconv.Itoa(len(vs)))
+	for _, v := range vs {
+		w.write(v)
+	}
+}
+
+// resp3 returns prefix for RESP3 and the array prefix for RESP2.
+func (w *writer) resp3(prefix string) string {
+	if w.proto == 3 {
+		return prefix
+	}
+	return "*"
+}
+
+func (w *writer) null(resp2 string) {
+	if w.proto == 3 {
+		_, _ = w.WriteString("_\r\n")
+		return
+	}
+	_, _ = w.WriteString(resp2 + "\r\n")
+}
+
+func (w *writer) line(prefix, s string) {
+	_, _ = w.WriteString(prefix + s + "\r\n")
+}
+
+func (w *writer) bulk(s string) {
+	_, _ = w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+}
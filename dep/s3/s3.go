@@ -0,0 +1,290 @@
+package s3
+
+import (
+	"crypto/md5" //nolint:gosec // S3 ETag/Content-MD5 are defined as MD5
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply          = strerr.Error("failed to apply Opt")
+	ErrNoSuchBucket      = strerr.Error("bucket does not exist")
+	ErrNoSuchKey         = strerr.Error("object does not exist")
+	ErrBucketExists      = strerr.Error("bucket already exists")
+	ErrInvalidBucketName = strerr.Error("invalid bucket name")
+	ErrNotStarted        = strerr.Error("object store not started")
+)
+
+const (
+	DefaultAccessKeyID     = "tstr"
+	DefaultSecretAccessKey = "tstrsecret"
+	DefaultRegion          = "us-east-1"
+)
+
+// S3 is an in-memory S3 compatible object store. It supports path-style requests for buckets,
+// objects, ListObjectsV2 and multipart uploads.
+// Signed requests and presigned URLs are verified with the configured credentials, unsigned requests are accepted.
+type S3 struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+	creds      credentials
+	region     string
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	uploads map[string]*upload
+}
+
+// Object is a stored object.
+type Object struct {
+	Key          string
+	Data         []byte
+	ContentType  string
+	Metadata     map[string]string
+	ETag         string
+	LastModified time.Time
+}
+
+type bucket struct {
+	created time.Time
+	objects map[string]*Object
+}
+
+type upload struct {
+	bucket, key string
+	contentType string
+	metadata    map[string]string
+	parts       map[int][]byte
+}
+
+type Opt func(*S3) error
+
+// New creates new S3 dependency.
+func New(opts ...Opt) *S3 {
+	return &S3{opts: opts}
+}
+
+func (s *S3) Start() error {
+	s.serverOpts, s.buckets, s.uploads = nil, map[string]*bucket{}, map[string]*upload{}
+	s.creds = credentials{accessKeyID: DefaultAccessKeyID, secretAccessKey: DefaultSecretAccessKey}
+	s.region = DefaultRegion
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	s.server = httpserver.New(append(slices.Clone(s.serverOpts), httpserver.WithHandler(http.HandlerFunc(s.serveHTTP)))...)
+	return s.server.Start()
+}
+
+func (s *S3) Ready() error { return nil }
+
+func (s *S3) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Stop()
+}
+
+// Name returns the name set with WithName or "s3".
+func (s *S3) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "s3"
+}
+
+// Outputs returns the outputs of the underlying server with Endpoint, Region, AccessKeyID and SecretAccessKey,
+// for example {{.s3.Endpoint}}.
+func (s *S3) Outputs() map[string]string {
+	if s.server == nil {
+		return nil
+	}
+	o := s.server.Outputs()
+	o["Endpoint"] = s.server.URL()
+	o["Region"] = s.region
+	o["AccessKeyID"] = s.creds.accessKeyID
+	o["SecretAccessKey"] = s.creds.secretAccessKey
+	return o
+}
+
+// URL returns the endpoint URL or an empty string if the store hasn't been started.
+// Buckets are addressed path-style, e.g. <URL>/bucket/key.
+func (s *S3) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL()
+}
+
+// Client returns a client for calling the store, see httpserver.Server.Client,
+// or a plain client if the store hasn't been started.
+func (s *S3) Client() *http.Client {
+	if s.server == nil {
+		return &http.Client{}
+	}
+	return s.server.Client()
+}
+
+// Presign returns a URL for calling method on the object which is valid for expires.
+// It returns ErrNotStarted if the store hasn't been started.
+func (s *S3) Presign(method, bucket, key string, expires time.Duration) (string, error) {
+	if s.server == nil {
+		return "", ErrNotStarted
+	}
+	u, err := url.Parse(s.server.URL())
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/" + bucket + "/" + key
+	return s.creds.presign(method, u, s.region, time.Now(), expires), nil
+}
+
+// CreateBucket creates a bucket.
+func (s *S3) CreateBucket(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.createBucket(name)
+}
+
+// Buckets returns the names of the buckets in lexical order.
+func (s *S3) Buckets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Sorted(maps.Keys(s.buckets))
+}
+
+// Keys returns the object keys of bucket in lexical order.
+func (s *S3) Keys(bucket string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchBucket, bucket)
+	}
+	return slices.Sorted(maps.Keys(b.objects)), nil
+}
+
+// PutObject stores data into bucket with key.
+func (s *S3) PutObject(bucket, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNoSuchBucket, bucket)
+	}
+	b.objects[key] = newObject(key, data, "", nil, etag(data))
+	return nil
+}
+
+// GetObject returns a copy of the object with key from bucket.
+func (s *S3) GetObject(bucket, key string) (Object, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.object(bucket, key)
+	if err != nil {
+		return Object{}, err
+	}
+	c := *o
+	c.Data, c.Metadata = slices.Clone(o.Data), maps.Clone(o.Metadata)
+	return c, nil
+}
+
+func (s *S3) createBucket(name string) error {
+	if !bucketName.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrInvalidBucketName, name)
+	}
+	if _, ok := s.buckets[name]; ok {
+		return fmt.Errorf("%w: %s", ErrBucketExists, name)
+	}
+	s.buckets[name] = &bucket{created: time.Now().UTC(), objects: map[string]*Object{}}
+	return nil
+}
+
+func (s *S3) object(bucket, key string) (*Object, error) {
+	b, ok := s.buckets[bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchBucket, bucket)
+	}
+	o, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrNoSuchKey, bucket, key)
+	}
+	return o, nil
+}
+
+func newObject(key string, data []byte, contentType string, metadata map[string]string, etag string) *Object {
+	if contentType == "" {
+		contentType = "binary/octet-stream"
+	}
+	return &Object{
+		Key:          key,
+		Data:         data,
+		ContentType:  contentType,
+		Metadata:     metadata,
+		ETag:         etag,
+		LastModified: time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec // S3 ETag/Content-MD5 are defined as MD5
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// WithName sets the name of the store which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *S3) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithBuckets creates the buckets on start.
+func WithBuckets(names ...string) Opt {
+	return func(s *S3) error {
+		for _, n := range names {
+			if err := s.createBucket(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// WithCredentials sets the credentials used for verifying signed requests,
+// defaults to DefaultAccessKeyID and DefaultSecretAccessKey.
+func WithCredentials(accessKeyID, secretAccessKey string) Opt {
+	return func(s *S3) error {
+		s.creds = credentials{accessKeyID: accessKeyID, secretAccessKey: secretAccessKey}
+		return nil
+	}
+}
+
+// WithRegion sets the region returned in outputs and used by Presign, defaults to DefaultRegion.
+func WithRegion(region string) Opt {
+	return func(s *S3) error {
+		s.region = region
+		return nil
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithPort.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(s *S3) error {
+		s.serverOpts = append(s.serverOpts, opts...)
+		return nil
+	}
+}
@@ -0,0 +1,273 @@
+package s3_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestS3_Objects(t *testing.T) {
+	s := s3.New(s3.WithName("store"), s3.WithBuckets("assets"))
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, s.URL(), s.Outputs()["Endpoint"])
+		assert.Equal(t, s3.DefaultRegion, s.Outputs()["Region"])
+		assert.Equal(t, s3.DefaultAccessKeyID, s.Outputs()["AccessKeyID"])
+
+		resp := do(t, http.MethodPut, s.URL()+"/assets/dir/a.txt", "hello world", http.Header{
+			"Content-Type":   {"text/plain"},
+			"X-Amz-Meta-Foo": {"bar"},
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, `"5eb63bbbe01eeed093cb22bb8f5acdc3"`, resp.Header.Get("ETag"))
+
+		resp = do(t, http.MethodGet, s.URL()+"/assets/dir/a.txt", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "hello world", string(resp.Body))
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		assert.Equal(t, "bar", resp.Header.Get("X-Amz-Meta-Foo"))
+
+		resp = do(t, http.MethodGet, s.URL()+"/assets/dir/a.txt", "", http.Header{"Range": {"bytes=0-4"}})
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, "hello", string(resp.Body))
+
+		resp = do(t, http.MethodHead, s.URL()+"/assets/dir/a.txt", "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int64(11), resp.ContentLength)
+
+		resp = do(t, http.MethodPut, s.URL()+"/assets/b.txt", "", http.Header{"X-Amz-Copy-Source": {"/assets/dir/a.txt"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		o, err := s.GetObject("assets", "b.txt")
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(o.Data))
+		assert.Equal(t, map[string]string{"foo": "bar"}, o.Metadata)
+
+		resp = do(t, http.MethodDelete, s.URL()+"/assets/b.txt", "", nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		_, err = s.GetObject("assets", "b.txt")
+		require.ErrorIs(t, err, s3.ErrNoSuchKey)
+
+		resp = do(t, http.MethodGet, s.URL()+"/assets/missing", "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "NoSuchKey", errorCode(t, resp))
+
+		resp = do(t, http.MethodPut, s.URL()+"/missing/key", "data", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Equal(t, "NoSuchBucket", errorCode(t, resp))
+	}, nil)
+}
+
+func TestS3_Buckets(t *testing.T) {
+	s := s3.New()
+	assert.Empty(t, s.URL())
+	_, err := s.Presign(http.MethodGet, "bucket", "key", time.Minute)
+	require.ErrorIs(t, err, s3.ErrNotStarted)
+	deptest.ErrorIs(t, s, func() {
+		require.Equal(t, http.StatusOK, do(t, http.MethodPut, s.URL()+"/bucket-2", "", nil).StatusCode)
+		require.NoError(t, s.CreateBucket("bucket-1"))
+		require.ErrorIs(t, s.CreateBucket("bucket-1"), s3.ErrBucketExists)
+		require.ErrorIs(t, s.CreateBucket("B"), s3.ErrInvalidBucketName)
+		assert.Equal(t, []string{"bucket-1", "bucket-2"}, s.Buckets())
+
+		resp := do(t, http.MethodPut, s.URL()+"/bucket-1", "", nil)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "BucketAlreadyOwnedByYou", errorCode(t, resp))
+
+		var list struct {
+			Buckets []string `xml:"Buckets>Bucket>Name"`
+		}
+		decode(t, do(t, http.MethodGet, s.URL()+"/", "", nil), &list)
+		assert.Equal(t, []string{"bucket-1", "bucket-2"}, list.Buckets)
+
+		assert.Equal(t, http.StatusOK, do(t, http.MethodHead, s.URL()+"/bucket-1", "", nil).StatusCode)
+		assert.Equal(t, http.StatusNotFound, do(t, http.MethodHead, s.URL()+"/bucket-3", "", nil).StatusCode)
+
+		require.NoError(t, s.PutObject("bucket-1", "key", []byte("data")))
+		resp = do(t, http.MethodDelete, s.URL()+"/bucket-1", "", nil)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "BucketNotEmpty", errorCode(t, resp))
+
+		resp = do(t, http.MethodPost, s.URL()+"/bucket-1?delete", "<Delete><Object><Key>key</Key></Object></Delete>", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, http.StatusNoContent, do(t, http.MethodDelete, s.URL()+"/bucket-1", "", nil).StatusCode)
+		assert.Equal(t, []string{"bucket-2"}, s.Buckets())
+	}, nil)
+}
+
+func TestS3_ListObjectsV2(t *testing.T) {
+	s := s3.New(s3.WithBuckets("bucket"))
+	deptest.ErrorIs(t, s, func() {
+		for _, k := range []string{"a.txt", "dir/1", "dir/2", "dir/sub/3", "other/4", "z.txt"} {
+			require.NoError(t, s.PutObject("bucket", k, []byte(k)))
+		}
+
+		type result struct {
+			Keys        []string `xml:"Contents>Key"`
+			Prefixes    []string `xml:"CommonPrefixes>Prefix"`
+			KeyCount    int
+			IsTruncated bool
+			Next        string `xml:"NextContinuationToken"`
+		}
+
+		var res result
+		decode(t, do(t, http.MethodGet, s.URL()+"/bucket?list-type=2&delimiter=/", "", nil), &res)
+		assert.Equal(t, []string{"a.txt", "z.txt"}, res.Keys)
+		assert.Equal(t, []string{"dir/", "other/"}, res.Prefixes)
+		assert.Equal(t, 4, res.KeyCount)
+
+		res = result{}
+		decode(t, do(t, http.MethodGet, s.URL()+"/bucket?list-type=2&prefix=dir/&delimiter=/", "", nil), &res)
+		assert.Equal(t, []string{"dir/1", "dir/2"}, res.Keys)
+		assert.Equal(t, []string{"dir/sub/"}, res.Prefixes)
+
+		var pages [][]string
+		token := ""
+		for {
+			res = result{}
+			decode(t, do(t, http.MethodGet, s.URL()+"/bucket?list-type=2&delimiter=/&max-keys=2&continuation-token="+token, "", nil), &res)
+			pages = append(pages, append(res.Keys, res.Prefixes...))
+			if !res.IsTruncated {
+				break
+			}
+			token = res.Next
+		}
+		assert.Equal(t, [][]string{{"a.txt", "dir/"}, {"z.txt", "other/"}}, pages)
+	}, nil)
+}
+
+func TestS3_MultipartUpload(t *testing.T) {
+	s := s3.New(s3.WithBuckets("bucket"))
+	deptest.ErrorIs(t, s, func() {
+		var initiate struct{ UploadId string }
+		decode(t, do(t, http.MethodPost, s.URL()+"/bucket/big?uploads", "", http.Header{"Content-Type": {"text/plain"}}), &initiate)
+		require.NotEmpty(t, initiate.UploadId)
+
+		part := func(n, data string) string {
+			resp := do(t, http.MethodPut, s.URL()+"/bucket/big?partNumber="+n+"&uploadId="+initiate.UploadId, data, nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			return resp.Header.Get("ETag")
+		}
+		e1, e2 := part("1", strings.Repeat("a", 10)), part("2", "b")
+
+		resp := do(t, http.MethodPost, s.URL()+"/bucket/big?uploadId="+initiate.UploadId,
+			"<CompleteMultipartUpload><Part><PartNumber>2</PartNumber><ETag>"+e2+"</ETag></Part>"+
+				"<Part><PartNumber>1</PartNumber><ETag>"+e1+"</ETag></Part></CompleteMultipartUpload>", nil)
+		assert.Equal(t, "InvalidPartOrder", errorCode(t, resp))
+
+		var complete struct{ ETag string }
+		decode(t, do(t, http.MethodPost, s.URL()+"/bucket/big?uploadId="+initiate.UploadId,
+			"<CompleteMultipartUpload><Part><PartNumber>1</PartNumber><ETag>"+e1+"</ETag></Part>"+
+				"<Part><PartNumber>2</PartNumber><ETag>"+e2+"</ETag></Part></CompleteMultipartUpload>", nil), &complete)
+		assert.True(t, strings.HasSuffix(complete.ETag, `-2"`), complete.ETag)
+
+		o, err := s.GetObject("bucket", "big")
+		require.NoError(t, err)
+		assert.Equal(t, strings.Repeat("a", 10)+"b", string(o.Data))
+		assert.Equal(t, "text/plain", o.ContentType)
+
+		decode(t, do(t, http.MethodPost, s.URL()+"/bucket/other?uploads", "", nil), &initiate)
+		assert.Equal(t, http.StatusNoContent, do(t, http.MethodDelete, s.URL()+"/bucket/other?uploadId="+initiate.UploadId, "", nil).StatusCode)
+		resp = do(t, http.MethodPut, s.URL()+"/bucket/other?partNumber=1&uploadId="+initiate.UploadId, "data", nil)
+		assert.Equal(t, "NoSuchUpload", errorCode(t, resp))
+	}, nil)
+}
+
+func TestS3_Presign(t *testing.T) {
+	s := s3.New(s3.WithBuckets("bucket"), s3.WithCredentials("key", "secret"), s3.WithRegion("eu-north-1"))
+	deptest.ErrorIs(t, s, func() {
+		put, err := s.Presign(http.MethodPut, "bucket", "upload/file name.txt", time.Minute)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, do(t, http.MethodPut, put, "content", nil).StatusCode)
+
+		get, err := s.Presign(http.MethodGet, "bucket", "upload/file name.txt", time.Minute)
+		require.NoError(t, err)
+		resp := do(t, http.MethodGet, get, "", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "content", string(resp.Body))
+
+		resp = do(t, http.MethodDelete, get, "", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "SignatureDoesNotMatch", errorCode(t, resp))
+
+		resp = do(t, http.MethodGet, strings.Replace(get, "X-Amz-Credential=key", "X-Amz-Credential=other", 1), "", nil)
+		assert.Equal(t, "InvalidAccessKeyId", errorCode(t, resp))
+
+		expired, err := s.Presign(http.MethodGet, "bucket", "upload/file name.txt", 0)
+		require.NoError(t, err)
+		time.Sleep(time.Second)
+		resp = do(t, http.MethodGet, expired, "", nil)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, "AccessDenied", errorCode(t, resp))
+	}, nil)
+}
+
+func TestS3_ChunkedUpload(t *testing.T) {
+	s := s3.New(s3.WithBuckets("bucket"))
+	deptest.ErrorIs(t, s, func() {
+		resp := do(t, http.MethodPut, s.URL()+"/bucket/key",
+			"5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\n\r\n",
+			http.Header{"X-Amz-Content-Sha256": {"STREAMING-AWS4-HMAC-SHA256-PAYLOAD"}})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		o, err := s.GetObject("bucket", "key")
+		require.NoError(t, err)
+		assert.Equal(t, "hello world", string(o.Data))
+
+		resp = do(t, http.MethodPut, s.URL()+"/bucket/key", "data",
+			http.Header{"X-Amz-Content-Sha256": {strings.Repeat("0", 64)}})
+		assert.Equal(t, "XAmzContentSHA256Mismatch", errorCode(t, resp))
+	}, nil)
+}
+
+func TestS3_InvalidBucket(t *testing.T) {
+	deptest.ErrorIs(t, s3.New(s3.WithBuckets("dup", "dup")), nil, s3.ErrOptApply)
+}
+
+// response is a response whose body has been read and closed.
+type response struct {
+	StatusCode    int
+	Status        string
+	Header        http.Header
+	ContentLength int64
+	Body          []byte
+}
+
+func do(t *testing.T, method, url, body string, header http.Header) response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return response{
+		StatusCode:    resp.StatusCode,
+		Status:        resp.Status,
+		Header:        resp.Header,
+		ContentLength: resp.ContentLength,
+		Body:          b,
+	}
+}
+
+func decode(t *testing.T, resp response, v any) {
+	t.Helper()
+	require.Less(t, resp.StatusCode, 300, resp.Status)
+	require.NoError(t, xml.Unmarshal(resp.Body, v))
+}
+
+func errorCode(t *testing.T, resp response) string {
+	t.Helper()
+	var e struct{ Code string }
+	require.NoError(t, xml.Unmarshal(resp.Body, &e))
+	return e.Code
+}
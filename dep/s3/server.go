@@ -0,0 +1,678 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5" //nolint:gosec // S3 ETag/Content-MD5 are defined as MD5
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+var bucketName = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// apiError is an S3 error response.
+type apiError struct {
+	XMLName  xml.Name `xml:"Error"`
+	Status   int      `xml:"-"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource,omitempty"`
+}
+
+func (e *apiError) Error() string { return e.Code + ": " + e.Message }
+
+func newError(status int, code, msg string) *apiError {
+	return &apiError{Status: status, Code: code, Message: msg}
+}
+
+func (s *S3) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.handle(w, r); err != nil {
+		var ae *apiError
+		if !errors.As(err, &ae) {
+			ae = newError(http.StatusInternalServerError, "InternalError", err.Error())
+		}
+		ae.Resource = r.URL.Path
+		writeXML(w, ae.Status, ae)
+	}
+}
+
+func (s *S3) handle(w http.ResponseWriter, r *http.Request) error {
+	if signed(r) {
+		if err := s.creds.verify(r, time.Now()); err != nil {
+			return authError(err)
+		}
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		return s.listBuckets(w)
+	case bucket == "":
+		return errMethodNotAllowed()
+	case key == "":
+		return s.handleBucket(w, r, bucket)
+	default:
+		return s.handleObject(w, r, bucket, key)
+	}
+}
+
+func (s *S3) handleBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		return s.putBucket(w, bucket)
+	case http.MethodHead:
+		return s.headBucket(w, bucket)
+	case http.MethodDelete:
+		return s.deleteBucket(w, bucket)
+	case http.MethodGet:
+		if q.Has("location") {
+			return s.bucketLocation(w, bucket)
+		}
+		return s.listObjects(w, bucket, q)
+	case http.MethodPost:
+		if q.Has("delete") {
+			return s.deleteObjects(w, r, bucket)
+		}
+	}
+	return errMethodNotAllowed()
+}
+
+func (s *S3) handleObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	q := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		if q.Has("uploadId") {
+			return s.uploadPart(w, r, bucket, key)
+		}
+		if r.Header.Get("X-Amz-Copy-Source") != "" {
+			return s.copyObject(w, r, bucket, key)
+		}
+		return s.putObject(w, r, bucket, key)
+	case http.MethodGet, http.MethodHead:
+		return s.getObject(w, r, bucket, key)
+	case http.MethodDelete:
+		if q.Has("uploadId") {
+			return s.abortUpload(w, bucket, key, q.Get("uploadId"))
+		}
+		return s.deleteObject(w, bucket, key)
+	case http.MethodPost:
+		if q.Has("uploads") {
+			return s.createUpload(w, r, bucket, key)
+		}
+		if q.Has("uploadId") {
+			return s.completeUpload(w, r, bucket, key, q.Get("uploadId"))
+		}
+	}
+	return errMethodNotAllowed()
+}
+
+func errMethodNotAllowed() *apiError {
+	return newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "the specified method is not allowed against this resource")
+}
+
+func (s *S3) listBuckets(w http.ResponseWriter) error {
+	type entry struct {
+		Name         string
+		CreationDate string
+	}
+	type result struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListAllMyBucketsResult"`
+		Owner   struct{ ID, DisplayName string }
+		Buckets []entry `xml:"Buckets>Bucket"`
+	}
+
+	s.mu.Lock()
+	var res result
+	res.Owner.ID, res.Owner.DisplayName = s.creds.accessKeyID, s.creds.accessKeyID
+	for _, name := range slices.Sorted(maps.Keys(s.buckets)) {
+		res.Buckets = append(res.Buckets, entry{Name: name, CreationDate: s.buckets[name].created.Format(timeFormat)})
+	}
+	s.mu.Unlock()
+
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (s *S3) putBucket(w http.ResponseWriter, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.createBucket(name); err != nil {
+		return toAPIError(err)
+	}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *S3) headBucket(w http.ResponseWriter, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[name]; !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	w.Header().Set("X-Amz-Bucket-Region", s.region)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *S3) deleteBucket(w http.ResponseWriter, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	if len(b.objects) > 0 {
+		return newError(http.StatusConflict, "BucketNotEmpty", "the bucket you tried to delete is not empty")
+	}
+	delete(s.buckets, name)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *S3) bucketLocation(w http.ResponseWriter, name string) error {
+	s.mu.Lock()
+	_, ok := s.buckets[name]
+	s.mu.Unlock()
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	type result struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ LocationConstraint"`
+		Location string   `xml:",chardata"`
+	}
+	writeXML(w, http.StatusOK, result{Location: s.region})
+	return nil
+}
+
+type (
+	listResult struct {
+		XMLName               xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+		Name                  string
+		Prefix                string
+		Delimiter             string `xml:",omitempty"`
+		StartAfter            string `xml:",omitempty"`
+		ContinuationToken     string `xml:",omitempty"`
+		NextContinuationToken string `xml:",omitempty"`
+		KeyCount              int
+		MaxKeys               int
+		IsTruncated           bool
+		Contents              []listContent
+		CommonPrefixes        []listPrefix
+	}
+	listContent struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int
+		StorageClass string
+	}
+	listPrefix struct{ Prefix string }
+)
+
+// listObjects implements ListObjectsV2.
+func (s *S3) listObjects(w http.ResponseWriter, name string, q url.Values) error {
+	res, start, err := parseListQuery(name, q)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	b, ok := s.buckets[name]
+	if !ok {
+		s.mu.Unlock()
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	objects := maps.Clone(b.objects)
+	s.mu.Unlock()
+
+	res.list(objects, start)
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// parseListQuery returns the result with the request parameters and the key after which the listing starts.
+func parseListQuery(name string, q url.Values) (*listResult, string, error) {
+	res := &listResult{
+		Name:              name,
+		Prefix:            q.Get("prefix"),
+		Delimiter:         q.Get("delimiter"),
+		StartAfter:        q.Get("start-after"),
+		ContinuationToken: q.Get("continuation-token"),
+		MaxKeys:           1000,
+	}
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, "", newError(http.StatusBadRequest, "InvalidArgument", "invalid max-keys")
+		}
+		res.MaxKeys = n
+	}
+	start := res.StartAfter
+	if res.ContinuationToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(res.ContinuationToken)
+		if err != nil {
+			return nil, "", newError(http.StatusBadRequest, "InvalidArgument", "invalid continuation token")
+		}
+		start = max(start, string(b))
+	}
+	return res, start, nil
+}
+
+// list adds the objects and common prefixes after start up to MaxKeys.
+func (res *listResult) list(objects map[string]*Object, start string) {
+	last := ""
+	for _, key := range slices.Sorted(maps.Keys(objects)) {
+		if res.skip(key, start) {
+			continue
+		}
+		entry := res.entry(key)
+		if entry == last {
+			continue
+		}
+		if res.KeyCount == res.MaxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			return
+		}
+		res.KeyCount++
+		last = entry
+		if entry != key {
+			res.CommonPrefixes = append(res.CommonPrefixes, listPrefix{Prefix: entry})
+			continue
+		}
+		o := objects[key]
+		res.Contents = append(res.Contents, listContent{
+			Key:          key,
+			LastModified: o.LastModified.Format(timeFormat),
+			ETag:         o.ETag,
+			Size:         len(o.Data),
+			StorageClass: "STANDARD",
+		})
+	}
+}
+
+// skip reports whether key is outside the prefix, not after start
+// or rolled up into the common prefix where the previous page ended.
+func (res *listResult) skip(key, start string) bool {
+	return !strings.HasPrefix(key, res.Prefix) || key <= start ||
+		res.Delimiter != "" && strings.HasSuffix(start, res.Delimiter) && strings.HasPrefix(key, start)
+}
+
+// entry returns the common prefix of key or key itself if it doesn't contain the delimiter after the prefix.
+func (res *listResult) entry(key string) string {
+	if i := strings.Index(key[len(res.Prefix):], res.Delimiter); res.Delimiter != "" && i >= 0 {
+		return key[:len(res.Prefix)+i+len(res.Delimiter)]
+	}
+	return key
+}
+
+func (s *S3) deleteObjects(w http.ResponseWriter, r *http.Request, name string) error {
+	type object struct{ Key string }
+	var req struct {
+		Quiet   bool
+		Objects []object `xml:"Object"`
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return newError(http.StatusBadRequest, "MalformedXML", err.Error())
+	}
+
+	s.mu.Lock()
+	b, ok := s.buckets[name]
+	if !ok {
+		s.mu.Unlock()
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	for _, o := range req.Objects {
+		delete(b.objects, o.Key)
+	}
+	s.mu.Unlock()
+
+	type result struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ DeleteResult"`
+		Deleted []object
+	}
+	res := result{}
+	if !req.Quiet {
+		res.Deleted = req.Objects
+	}
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (s *S3) putObject(w http.ResponseWriter, r *http.Request, name, key string) error {
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	o := newObject(key, body, r.Header.Get("Content-Type"), metadata(r.Header), etag(body))
+	b.objects[key] = o
+	w.Header().Set("ETag", o.ETag)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *S3) copyObject(w http.ResponseWriter, r *http.Request, name, key string) error {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return newError(http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+	}
+	source, _, _ = strings.Cut(source, "?")
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, err := s.object(srcBucket, srcKey)
+	if err != nil {
+		return toAPIError(err)
+	}
+	b, ok := s.buckets[name]
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+
+	contentType, meta := src.ContentType, maps.Clone(src.Metadata)
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		contentType, meta = r.Header.Get("Content-Type"), metadata(r.Header)
+	}
+	o := newObject(key, slices.Clone(src.Data), contentType, meta, src.ETag)
+	b.objects[key] = o
+
+	type result struct {
+		XMLName      xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CopyObjectResult"`
+		LastModified string
+		ETag         string
+	}
+	writeXML(w, http.StatusOK, result{LastModified: o.LastModified.Format(timeFormat), ETag: o.ETag})
+	return nil
+}
+
+func (s *S3) getObject(w http.ResponseWriter, r *http.Request, name, key string) error {
+	s.mu.Lock()
+	o, err := s.object(name, key)
+	s.mu.Unlock()
+	if err != nil {
+		return toAPIError(err)
+	}
+
+	h := w.Header()
+	h.Set("ETag", o.ETag)
+	h.Set("Content-Type", o.ContentType)
+	h.Set("Accept-Ranges", "bytes")
+	for k, v := range o.Metadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+	http.ServeContent(w, r, "", o.LastModified, bytes.NewReader(o.Data))
+	return nil
+}
+
+func (s *S3) deleteObject(w http.ResponseWriter, name, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[name]
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	delete(b.objects, key)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *S3) createUpload(w http.ResponseWriter, r *http.Request, name, key string) error {
+	s.mu.Lock()
+	if _, ok := s.buckets[name]; !ok {
+		s.mu.Unlock()
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+	id := rand.Text()
+	s.uploads[id] = &upload{
+		bucket:      name,
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		metadata:    metadata(r.Header),
+		parts:       map[int][]byte{},
+	}
+	s.mu.Unlock()
+
+	type result struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}
+	writeXML(w, http.StatusOK, result{Bucket: name, Key: key, UploadId: id})
+	return nil
+}
+
+func (s *S3) uploadPart(w http.ResponseWriter, r *http.Request, name, key string) error {
+	n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		return newError(http.StatusBadRequest, "InvalidArgument", "part number must be an integer between 1 and 10000")
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.upload(name, key, r.URL.Query().Get("uploadId"))
+	if err != nil {
+		return err
+	}
+	u.parts[n] = body
+	w.Header().Set("ETag", etag(body))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3) completeUpload(w http.ResponseWriter, r *http.Request, name, key, id string) error {
+	var req struct {
+		Parts []completedPart `xml:"Part"`
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return err
+	}
+	if err := xml.Unmarshal(body, &req); err != nil || len(req.Parts) == 0 {
+		return newError(http.StatusBadRequest, "MalformedXML", "the XML you provided was not well-formed")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, err := s.upload(name, key, id)
+	if err != nil {
+		return err
+	}
+	b, ok := s.buckets[name]
+	if !ok {
+		return toAPIError(fmt.Errorf("%w: %s", ErrNoSuchBucket, name))
+	}
+
+	data, tag, err := u.assemble(req.Parts)
+	if err != nil {
+		return err
+	}
+	o := newObject(key, data, u.contentType, u.metadata, tag)
+	b.objects[key] = o
+	delete(s.uploads, id)
+
+	type result struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}
+	writeXML(w, http.StatusOK, result{Location: s.server.URL() + "/" + name + "/" + key, Bucket: name, Key: key, ETag: o.ETag})
+	return nil
+}
+
+func (s *S3) abortUpload(w http.ResponseWriter, name, key, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.upload(name, key, id); err != nil {
+		return err
+	}
+	delete(s.uploads, id)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// assemble concatenates the parts in the order given and returns the data and the multipart ETag.
+func (u *upload) assemble(parts []completedPart) ([]byte, string, error) {
+	var data, sums []byte
+	for i, p := range parts {
+		if i > 0 && p.PartNumber <= parts[i-1].PartNumber {
+			return nil, "", newError(http.StatusBadRequest, "InvalidPartOrder", "the list of parts was not in ascending order")
+		}
+		part, ok := u.parts[p.PartNumber]
+		if !ok || strings.Trim(p.ETag, `"`) != strings.Trim(etag(part), `"`) {
+			return nil, "", newError(http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d could not be found", p.PartNumber))
+		}
+		data = append(data, part...)
+		sum := md5.Sum(part) //nolint:gosec // S3 ETag/Content-MD5 are defined as MD5
+		sums = append(sums, sum[:]...)
+	}
+	sum := md5.Sum(sums) //nolint:gosec // S3 ETag/Content-MD5 are defined as MD5
+	return data, fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(parts)), nil
+}
+
+func (s *S3) upload(name, key, id string) (*upload, error) {
+	u, ok := s.uploads[id]
+	if !ok || u.bucket != name || u.key != key {
+		return nil, newError(http.StatusNotFound, "NoSuchUpload", "the specified upload does not exist")
+	}
+	return u, nil
+}
+
+// readBody reads the request body, decoding aws-chunked payloads and checking the payload hash if it's set.
+func readBody(r *http.Request) ([]byte, error) {
+	hash := r.Header.Get("X-Amz-Content-Sha256")
+	var (
+		body []byte
+		err  error
+	)
+	if strings.HasPrefix(hash, "STREAMING-") || strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		body, err = readChunked(bufio.NewReader(r.Body))
+	} else {
+		body, err = io.ReadAll(r.Body)
+	}
+	if err != nil {
+		return nil, newError(http.StatusBadRequest, "IncompleteBody", err.Error())
+	}
+
+	if len(hash) == sha256.Size*2 {
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != hash {
+			return nil, newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "the provided x-amz-content-sha256 header does not match what was computed")
+		}
+	}
+	return body, nil
+}
+
+// readChunked decodes aws-chunked encoding: <hex size>[;chunk-signature=...]\r\n<data>\r\n, terminated by a zero sized chunk.
+// Chunk signatures are not verified.
+func readChunked(r *bufio.Reader) ([]byte, error) {
+	var body []byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(size, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", size)
+		}
+		if n == 0 {
+			return body, nil
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		body = append(body, chunk...)
+		if _, err := r.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func metadata(h http.Header) map[string]string {
+	m := map[string]string{}
+	for k := range h {
+		if name, ok := strings.CutPrefix(k, "X-Amz-Meta-"); ok {
+			m[strings.ToLower(name)] = h.Get(k)
+		}
+	}
+	return m
+}
+
+func toAPIError(err error) error {
+	switch {
+	case errors.Is(err, ErrNoSuchBucket):
+		return newError(http.StatusNotFound, "NoSuchBucket", "the specified bucket does not exist")
+	case errors.Is(err, ErrNoSuchKey):
+		return newError(http.StatusNotFound, "NoSuchKey", "the specified key does not exist")
+	case errors.Is(err, ErrBucketExists):
+		return newError(http.StatusConflict, "BucketAlreadyOwnedByYou", "the bucket you tried to create already exists")
+	case errors.Is(err, ErrInvalidBucketName):
+		return newError(http.StatusBadRequest, "InvalidBucketName", "the specified bucket is not valid")
+	default:
+		return err
+	}
+}
+
+func authError(err error) error {
+	switch {
+	case errors.Is(err, errExpired):
+		return newError(http.StatusForbidden, "AccessDenied", "request has expired")
+	case errors.Is(err, errSignatureMismatch):
+		return newError(http.StatusForbidden, "SignatureDoesNotMatch", err.Error())
+	case errors.Is(err, errInvalidAccessKey):
+		return newError(http.StatusForbidden, "InvalidAccessKeyId", err.Error())
+	default:
+		return newError(http.StatusBadRequest, "AuthorizationQueryParametersError", err.Error())
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,201 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	maxPresignTTL   = 7 * 24 * time.Hour
+)
+
+var (
+	errExpired           = errors.New("request has expired")
+	errSignatureMismatch = errors.New("the request signature we calculated does not match the signature you provided")
+	errInvalidAccessKey  = errors.New("the access key ID you provided does not exist")
+)
+
+// credentials are AWS style static credentials.
+type credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+}
+
+// signed reports whether r is signed with a presigned URL or an Authorization header.
+func signed(r *http.Request) bool {
+	return r.URL.Query().Has("X-Amz-Signature") || strings.HasPrefix(r.Header.Get("Authorization"), algorithm)
+}
+
+// verify verifies the signature of r signed with AWS Signature Version 4.
+func (c credentials) verify(r *http.Request, now time.Time) error {
+	if r.URL.Query().Has("X-Amz-Signature") {
+		return c.verifyQuery(r, now)
+	}
+	return c.verifyHeader(r)
+}
+
+func (c credentials) verifyQuery(r *http.Request, now time.Time) error {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != algorithm {
+		return fmt.Errorf("unsupported algorithm %q", q.Get("X-Amz-Algorithm"))
+	}
+
+	date, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("invalid X-Amz-Date: %w", err)
+	}
+	expires, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignTTL {
+		return fmt.Errorf("invalid X-Amz-Expires %q", q.Get("X-Amz-Expires"))
+	}
+	if now.After(date.Add(time.Duration(expires) * time.Second)) {
+		return errExpired
+	}
+
+	scope, err := c.scope(q.Get("X-Amz-Credential"))
+	if err != nil {
+		return err
+	}
+
+	q.Del("X-Amz-Signature")
+	headers := strings.Split(q.Get("X-Amz-SignedHeaders"), ";")
+	sig := c.signature(r, q, headers, unsignedPayload, q.Get("X-Amz-Date"), scope)
+	return compare(sig, r.URL.Query().Get("X-Amz-Signature"))
+}
+
+func (c credentials) verifyHeader(r *http.Request) error {
+	fields := map[string]string{}
+	for f := range strings.SplitSeq(strings.TrimPrefix(r.Header.Get("Authorization"), algorithm), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(f), "=")
+		fields[k] = v
+	}
+
+	scope, err := c.scope(fields["Credential"])
+	if err != nil {
+		return err
+	}
+
+	payload := r.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = unsignedPayload
+	}
+	sig := c.signature(r, r.URL.Query(), strings.Split(fields["SignedHeaders"], ";"), payload, r.Header.Get("X-Amz-Date"), scope)
+	return compare(sig, fields["Signature"])
+}
+
+// scope validates the credential <access key>/<date>/<region>/s3/aws4_request and returns the scope part.
+func (c credentials) scope(credential string) (string, error) {
+	ak, scope, ok := strings.Cut(credential, "/")
+	if !ok || strings.Count(scope, "/") != 3 {
+		return "", fmt.Errorf("invalid credential %q", credential)
+	}
+	if ak != c.accessKeyID {
+		return "", errInvalidAccessKey
+	}
+	return scope, nil
+}
+
+// signature calculates the signature of r. The region is taken from the scope.
+func (c credentials) signature(r *http.Request, query url.Values, signedHeaders []string, payload, amzDate, scope string) string {
+	slices.Sort(signedHeaders)
+	var headers strings.Builder
+	for _, h := range signedHeaders {
+		v := r.Header.Get(h)
+		if h == "host" {
+			v = r.Host
+		}
+		headers.WriteString(h + ":" + strings.Join(strings.Fields(v), " ") + "\n")
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		escape(r.URL.Path, false),
+		canonicalQuery(query),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payload,
+	}, "\n")
+
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	parts := strings.Split(scope, "/")
+	key := []byte("AWS4" + c.secretAccessKey)
+	for _, p := range parts {
+		key = hmacSHA256(key, p)
+	}
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+// presign returns u signed for method with a presigned URL valid for expires.
+func (c credentials) presign(method string, u *url.URL, region string, now time.Time, expires time.Duration) string {
+	amzDate := now.UTC().Format(amzDateFormat)
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", c.accessKeyID+"/"+scope)
+	q.Set("X-Amz-Date", amzDate)
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+
+	r := &http.Request{Method: method, URL: u, Host: u.Host, Header: http.Header{}}
+	q.Set("X-Amz-Signature", c.signature(r, q, []string{"host"}, unsignedPayload, amzDate, scope))
+	signed := *u
+	signed.RawQuery = canonicalQuery(q)
+	return signed.String()
+}
+
+func canonicalQuery(q url.Values) string {
+	params := make([]string, 0, len(q))
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, escape(k, true)+"="+escape(v, true))
+		}
+	}
+	slices.Sort(params)
+	return strings.Join(params, "&")
+}
+
+// escape encodes s as specified by AWS: everything except unreserved characters is percent encoded,
+// and slashes are kept unless encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func compare(expected, got string) error {
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(got)) != 1 {
+		return errSignatureMismatch
+	}
+	return nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
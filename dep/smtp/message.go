@@ -0,0 +1,159 @@
+package smtp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Message is a received message.
+type Message struct {
+	// From is the envelope sender given with MAIL FROM.
+	From string
+	// To are the envelope recipients given with RCPT TO.
+	To       []string
+	Received time.Time
+	Header   mail.Header
+	// Subject is the decoded Subject header.
+	Subject string
+	// Text and HTML are the decoded text/plain and text/html bodies.
+	Text        string
+	HTML        string
+	Attachments []Attachment
+	// Raw is the message as it was received.
+	Raw []byte
+	// Err is set if the message couldn't be parsed.
+	Err error
+}
+
+// Attachment is a MIME part with a file name or a non-text content type.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Filter selects messages, see Server.WaitForMessage.
+type Filter func(Message) bool
+
+// To selects messages with addr as an envelope recipient.
+func To(addr string) Filter {
+	return func(m Message) bool {
+		return slices.ContainsFunc(m.To, func(to string) bool { return strings.EqualFold(to, addr) })
+	}
+}
+
+// From selects messages with addr as the envelope sender.
+func From(addr string) Filter {
+	return func(m Message) bool { return strings.EqualFold(m.From, addr) }
+}
+
+// Subject selects messages with the given subject.
+func Subject(subject string) Filter {
+	return func(m Message) bool { return m.Subject == subject }
+}
+
+// SubjectContains selects messages with subject containing s.
+func SubjectContains(s string) Filter {
+	return func(m Message) bool { return strings.Contains(m.Subject, s) }
+}
+
+func (m Message) match(filters []Filter) bool {
+	for _, f := range filters {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
+
+func parse(from string, to []string, raw []byte) Message {
+	m := Message{From: from, To: to, Received: time.Now(), Raw: raw}
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		m.Err = err
+		return m
+	}
+
+	m.Header = msg.Header
+	dec := &mime.WordDecoder{}
+	if m.Subject, err = dec.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		m.Subject = msg.Header.Get("Subject")
+	}
+	m.Err = m.parsePart(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), "", msg.Body)
+	return m
+}
+
+func (m *Message) parsePart(contentType, encoding, disposition string, body io.Reader) error {
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return m.parseMultipart(body, params["boundary"])
+	}
+
+	data, err := io.ReadAll(decode(body, encoding))
+	if err != nil {
+		return err
+	}
+	m.addPart(mediaType, params["name"], disposition, data)
+	return nil
+}
+
+func (m *Message) parseMultipart(body io.Reader, boundary string) error {
+	r := multipart.NewReader(body, boundary)
+	for {
+		p, err := r.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = m.parsePart(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p.Header.Get("Content-Disposition"), p)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// addPart sets the first inline text/plain and text/html parts as Text and HTML, other parts are attachments.
+func (m *Message) addPart(mediaType, name, disposition string, data []byte) {
+	_, dparams, _ := mime.ParseMediaType(disposition)
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = name
+	}
+
+	switch {
+	case filename == "" && mediaType == "text/plain" && m.Text == "":
+		m.Text = string(data)
+	case filename == "" && mediaType == "text/html" && m.HTML == "":
+		m.HTML = string(data)
+	default:
+		m.Attachments = append(m.Attachments, Attachment{Filename: filename, ContentType: mediaType, Data: data})
+	}
+}
+
+func decode(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
@@ -0,0 +1,526 @@
+package smtp
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/port"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply  = strerr.Error("failed to apply Opt")
+	ErrListen    = strerr.Error("failed to listen")
+	ErrCert      = strerr.Error("failed to generate certificate")
+	ErrNoMessage = strerr.Error("no matching message received")
+)
+
+const maxMessageSize = 32 << 20
+
+// Server is a fake SMTP server which accepts all messages and keeps them in memory.
+type Server struct {
+	opts      []Opt
+	name      string
+	hostname  string
+	port      *port.Port
+	startTLS  bool
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	certPool  *x509.CertPool
+	listener  net.Listener
+	wg        sync.WaitGroup
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	messages []Message
+	notify   chan struct{}
+}
+
+type Opt func(*Server) error
+
+// New creates new Server dependency.
+func New(opts ...Opt) *Server {
+	return &Server{
+		opts:     opts,
+		hostname: "localhost",
+	}
+}
+
+func (s *Server) Start() error {
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if s.startTLS {
+		if err := s.generateCert(); err != nil {
+			return fmt.Errorf("%w: %w", ErrCert, err)
+		}
+	}
+
+	addr := "127.0.0.1:0"
+	if s.port != nil {
+		if err := s.port.Release(); err != nil {
+			return fmt.Errorf("%w: %w", ErrListen, err)
+		}
+		addr = s.port.Addr()
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrListen, err)
+	}
+	s.listener = l
+	s.conns, s.closed = map[net.Conn]struct{}{}, false
+	s.notify = make(chan struct{})
+	s.wg.Go(s.accept)
+	return nil
+}
+
+func (s *Server) Ready() error { return nil }
+
+// Stop closes the listener and all connections.
+func (s *Server) Stop() error {
+	if s.listener == nil {
+		return nil
+	}
+	err := s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	if s.port != nil {
+		err = errors.Join(err, s.port.Close())
+	}
+	return err
+}
+
+// Name returns the name set with WithName or "smtp".
+func (s *Server) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "smtp"
+}
+
+// Outputs returns the Addr, Host and Port of the server, for example {{.smtp.Addr}}.
+func (s *Server) Outputs() map[string]string {
+	if s.listener == nil {
+		return nil
+	}
+	host, p, _ := net.SplitHostPort(s.Addr())
+	return map[string]string{"Addr": s.Addr(), "Host": host, "Port": p}
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// ClientTLSConfig returns TLS config which trusts the certificate generated for STARTTLS.
+func (s *Server) ClientTLSConfig() *tls.Config {
+	return &tls.Config{RootCAs: s.certPool, ServerName: s.hostname, MinVersion: tls.VersionTLS12}
+}
+
+// Messages returns the received messages in the order they were received.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.messages)
+}
+
+// Reset removes the received messages.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+}
+
+// WaitForMessage waits until a message matching all filters is received and returns it.
+// Messages received before the call are also considered.
+func (s *Server) WaitForMessage(ctx context.Context, filters ...Filter) (Message, error) {
+	for {
+		s.mu.Lock()
+		notify := s.notify
+		for _, m := range s.messages {
+			if m.match(filters) {
+				s.mu.Unlock()
+				return m, nil
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return Message{}, fmt.Errorf("%w: %w", ErrNoMessage, ctx.Err())
+		}
+	}
+}
+
+// CollectArtifacts writes each received message into <n>.eml.
+func (s *Server) CollectArtifacts(dir string) error {
+	for i, m := range s.Messages() {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%03d.eml", i+1)), m.Raw, 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) accept() {
+	for {
+		c, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Go(func() {
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, c)
+				s.mu.Unlock()
+			}()
+			s.serve(c)
+		})
+	}
+}
+
+func (s *Server) deliver(m Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, m)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+// session is the state of a single SMTP connection.
+type session struct {
+	s      *Server
+	conn   net.Conn
+	r      *bufio.Reader
+	tls    bool
+	authed bool
+	from   string
+	to     []string
+}
+
+func (s *Server) serve(c net.Conn) {
+	ss := &session{s: s, conn: c, r: bufio.NewReader(c)}
+	defer func() { _ = ss.conn.Close() }()
+
+	ss.reply(220, s.hostname+" ESMTP tstr")
+	for {
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !ss.handle(strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+// sessionCommands maps the supported commands to their handlers,
+// which report whether the session continues.
+var sessionCommands = map[string]func(*session, string) bool{
+	"HELO":     (*session).helo,
+	"EHLO":     (*session).ehlo,
+	"STARTTLS": (*session).startTLS,
+	"AUTH":     (*session).auth,
+	"MAIL":     (*session).mail,
+	"RCPT":     (*session).rcpt,
+	"DATA":     (*session).data,
+	"RSET":     (*session).rset,
+	"NOOP":     (*session).noop,
+	"VRFY":     (*session).vrfy,
+	"QUIT":     (*session).quit,
+}
+
+// handle handles a single command and reports whether the session continues.
+func (ss *session) handle(cmd, arg string) bool {
+	h, ok := sessionCommands[cmd]
+	if !ok {
+		ss.reply(502, "Command not implemented")
+		return true
+	}
+	return h(ss, arg)
+}
+
+func (ss *session) helo(string) bool {
+	ss.reply(250, ss.s.hostname)
+	return true
+}
+
+func (ss *session) ehlo(string) bool {
+	s := ss.s
+	ext := []string{s.hostname, "8BITMIME", "PIPELINING", fmt.Sprintf("SIZE %d", maxMessageSize)}
+	if s.startTLS && !ss.tls {
+		ext = append(ext, "STARTTLS")
+	}
+	if s.username != "" {
+		ext = append(ext, "AUTH PLAIN")
+	}
+	ss.reply(250, ext...)
+	return true
+}
+
+func (ss *session) startTLS(string) bool {
+	s := ss.s
+	if !s.startTLS || ss.tls {
+		ss.reply(502, "STARTTLS not available")
+		return true
+	}
+	ss.reply(220, "Ready to start TLS")
+	tc := tls.Server(ss.conn, s.tlsConfig)
+	if err := tc.Handshake(); err != nil {
+		return false
+	}
+	ss.conn, ss.r, ss.tls = tc, bufio.NewReader(tc), true
+	ss.from, ss.to = "", nil
+	return true
+}
+
+func (ss *session) auth(arg string) bool {
+	s := ss.s
+	mech, initial, _ := strings.Cut(arg, " ")
+	if s.username == "" || !strings.EqualFold(mech, "PLAIN") {
+		ss.reply(504, "Unrecognized authentication type")
+		return true
+	}
+	if initial == "" {
+		ss.reply(334, "")
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return false
+		}
+		initial = strings.TrimRight(line, "\r\n")
+	}
+
+	b, err := base64.StdEncoding.DecodeString(initial)
+	parts := strings.Split(string(b), "\x00")
+	if err != nil || len(parts) != 3 || parts[1] != s.username || parts[2] != s.password {
+		ss.reply(535, "Authentication credentials invalid")
+		return true
+	}
+	ss.authed = true
+	ss.reply(235, "Authentication successful")
+	return true
+}
+
+func (ss *session) mail(arg string) bool {
+	if ss.s.username != "" && !ss.authed {
+		ss.reply(530, "Authentication required")
+		return true
+	}
+	from, ok := address(arg, "FROM:")
+	if !ok {
+		ss.reply(501, "Syntax: MAIL FROM:<address>")
+		return true
+	}
+	ss.from, ss.to = from, nil
+	ss.reply(250, "OK")
+	return true
+}
+
+func (ss *session) rcpt(arg string) bool {
+	to, ok := address(arg, "TO:")
+	if !ok {
+		ss.reply(501, "Syntax: RCPT TO:<address>")
+		return true
+	}
+	ss.to = append(ss.to, to)
+	ss.reply(250, "OK")
+	return true
+}
+
+func (ss *session) data(string) bool {
+	if len(ss.to) == 0 {
+		ss.reply(503, "RCPT first")
+		return true
+	}
+	ss.reply(354, "End data with <CR><LF>.<CR><LF>")
+	raw, err := ss.readData()
+	if err != nil {
+		ss.reply(552, err.Error())
+		return false
+	}
+	ss.s.deliver(parse(ss.from, ss.to, raw))
+	ss.from, ss.to = "", nil
+	ss.reply(250, "OK: queued")
+	return true
+}
+
+func (ss *session) rset(string) bool {
+	ss.from, ss.to = "", nil
+	ss.reply(250, "OK")
+	return true
+}
+
+func (ss *session) noop(string) bool {
+	ss.reply(250, "OK")
+	return true
+}
+
+func (ss *session) vrfy(string) bool {
+	ss.reply(252, "Cannot VRFY user")
+	return true
+}
+
+func (ss *session) quit(string) bool {
+	ss.reply(221, "Bye")
+	return false
+}
+
+var errTooLarge = errors.New("message too large")
+
+func (ss *session) readData() ([]byte, error) {
+	var b []byte
+	for {
+		line, err := ss.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			return b, nil
+		}
+		line = strings.TrimPrefix(line, ".")
+		if len(b)+len(line) > maxMessageSize {
+			return nil, errTooLarge
+		}
+		b = append(b, line...)
+	}
+}
+
+func (ss *session) reply(code int, lines ...string) {
+	var sb strings.Builder
+	for i, l := range lines {
+		sep := " "
+		if i < len(lines)-1 {
+			sep = "-"
+		}
+		fmt.Fprintf(&sb, "%d%s%s\r\n", code, sep, l)
+	}
+	_, _ = ss.conn.Write([]byte(sb.String()))
+}
+
+// address parses the address from MAIL FROM:<address> and RCPT TO:<address> arguments.
+func address(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	if !strings.HasPrefix(addr, "<") || !strings.HasSuffix(addr, ">") {
+		return "", false
+	}
+	return addr[1 : len(addr)-1], true
+}
+
+func (s *Server) generateCert() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: s.hostname},
+		DNSNames:              []string{s.hostname},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	s.certPool = x509.NewCertPool()
+	s.certPool.AddCert(cert)
+	s.tlsConfig = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return nil
+}
+
+// WithName sets the name of the server which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *Server) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithHostname sets the hostname used in greetings and the STARTTLS certificate, defaults to localhost.
+func WithHostname(hostname string) Opt {
+	return func(s *Server) error {
+		s.hostname = hostname
+		return nil
+	}
+}
+
+// WithPort makes the server listen on a port reserved with the port package.
+// The port is closed when the server is stopped.
+func WithPort(p *port.Port) Opt {
+	return func(s *Server) error {
+		s.port = p
+		return nil
+	}
+}
+
+// WithSTARTTLS enables STARTTLS with a generated self-signed certificate, see ClientTLSConfig.
+func WithSTARTTLS() Opt {
+	return func(s *Server) error {
+		s.startTLS = true
+		return nil
+	}
+}
+
+// WithAuth requires AUTH PLAIN with the given credentials before MAIL.
+func WithAuth(username, password string) Opt {
+	return func(s *Server) error {
+		s.username, s.password = username, password
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package smtp_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	gosmtp "net/smtp"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/smtp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const multipartMessage = "From: Sender <sender@example.com>\r\n" +
+	"To: user@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Tervetuloa_=C3=A4?=\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=outer\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=inner\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Hello =C3=A4\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Hello</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf\r\n" +
+	"Content-Disposition: attachment; filename=\"invoice.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBE\r\n" +
+	"Rg==\r\n" +
+	"--outer--\r\n" +
+	".leading dot\r\n"
+
+func TestServer(t *testing.T) {
+	s := smtp.New()
+	deptest.ErrorIs(t, s, func() {
+		require.NoError(t, gosmtp.SendMail(s.Addr(), nil, "sender@example.com", []string{"user@example.com", "other@example.com"}, []byte(multipartMessage)))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		m, err := s.WaitForMessage(ctx, smtp.To("USER@example.com"), smtp.Subject("Tervetuloa ä"), smtp.From("sender@example.com"))
+		require.NoError(t, err)
+		require.NoError(t, m.Err)
+
+		assert.Equal(t, []string{"user@example.com", "other@example.com"}, m.To)
+		assert.Equal(t, "Sender <sender@example.com>", m.Header.Get("From"))
+		assert.Equal(t, "Hello ä", m.Text)
+		assert.Equal(t, "<p>Hello</p>", m.HTML)
+		require.Len(t, m.Attachments, 1)
+		assert.Equal(t, smtp.Attachment{Filename: "invoice.pdf", ContentType: "application/pdf", Data: []byte("%PDF")}, m.Attachments[0])
+		assert.Contains(t, string(m.Raw), "\r\n.leading dot\r\n")
+
+		ctx, cancel = context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err = s.WaitForMessage(ctx, smtp.SubjectContains("missing"))
+		require.ErrorIs(t, err, smtp.ErrNoMessage)
+
+		dir := t.TempDir()
+		require.NoError(t, s.CollectArtifacts(dir))
+		assert.FileExists(t, filepath.Join(dir, "001.eml"))
+
+		s.Reset()
+		assert.Empty(t, s.Messages())
+	}, nil)
+}
+
+func TestServer_WaitForMessage(t *testing.T) {
+	s := smtp.New()
+	deptest.ErrorIs(t, s, func() {
+		errCh := make(chan error, 1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			errCh <- gosmtp.SendMail(s.Addr(), nil, "a@example.com", []string{"b@example.com"}, []byte("Subject: later\r\n\r\nbody\r\n"))
+		}()
+		defer func() { assert.NoError(t, <-errCh) }()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		m, err := s.WaitForMessage(ctx, smtp.SubjectContains("late"))
+		require.NoError(t, err)
+		assert.Equal(t, "body\r\n", m.Text)
+	}, nil)
+}
+
+func TestServer_STARTTLSAuth(t *testing.T) {
+	s := smtp.New(smtp.WithSTARTTLS(), smtp.WithAuth("user", "secret"))
+	deptest.ErrorIs(t, s, func() {
+		send := func(password string) error {
+			c, err := gosmtp.Dial(s.Addr())
+			require.NoError(t, err)
+
+			ok, _ := c.Extension("STARTTLS")
+			require.True(t, ok)
+			require.NoError(t, c.StartTLS(s.ClientTLSConfig()))
+			host, _, _ := net.SplitHostPort(s.Addr())
+			if err := c.Auth(gosmtp.PlainAuth("", "user", password, host)); err != nil {
+				return errors.Join(err, c.Close())
+			}
+			require.NoError(t, c.Mail("a@example.com"))
+			require.NoError(t, c.Rcpt("b@example.com"))
+			w, err := c.Data()
+			require.NoError(t, err)
+			_, err = w.Write([]byte("Subject: tls\r\n\r\nsecure\r\n"))
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+			return c.Quit()
+		}
+
+		require.Error(t, send("wrong"))
+		require.NoError(t, send("secret"))
+		require.Len(t, s.Messages(), 1)
+		assert.Equal(t, "tls", s.Messages()[0].Subject)
+	}, nil)
+}
+
+func TestServer_AuthRequired(t *testing.T) {
+	s := smtp.New(smtp.WithAuth("user", "secret"))
+	deptest.ErrorIs(t, s, func() {
+		err := gosmtp.SendMail(s.Addr(), nil, "a@example.com", []string{"b@example.com"}, []byte("Subject: x\r\n\r\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "530")
+	}, nil)
+}
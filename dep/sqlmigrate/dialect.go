@@ -0,0 +1,79 @@
+package sqlmigrate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the SQL syntax for placeholders and truncating tables.
+type Dialect string
+
+const (
+	Postgres  Dialect = "postgres"
+	MySQL     Dialect = "mysql"
+	SQLite    Dialect = "sqlite"
+	SQLServer Dialect = "sqlserver"
+)
+
+// dialectOf detects the dialect from the driver name, for example pgx or sqlite3.
+func dialectOf(driver string) Dialect {
+	d := strings.ToLower(driver)
+	switch {
+	case strings.Contains(d, "postgres"), strings.HasPrefix(d, "pgx"):
+		return Postgres
+	case strings.Contains(d, "mysql"):
+		return MySQL
+	case strings.Contains(d, "sqlite"):
+		return SQLite
+	case d == "sqlserver", d == "mssql":
+		return SQLServer
+	}
+	return ""
+}
+
+// identifier matches the table and column names which can be inserted into statements unquoted,
+// optionally qualified with a schema.
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// checkIdentifiers returns ErrIdentifier if any of the names isn't a plain identifier.
+func checkIdentifiers(names []string) error {
+	for _, n := range names {
+		if !identifier.MatchString(n) {
+			return fmt.Errorf("%w: '%s'", ErrIdentifier, n)
+		}
+	}
+	return nil
+}
+
+func (d Dialect) placeholder(n int) string {
+	switch d {
+	case Postgres:
+		return "$" + strconv.Itoa(n)
+	case SQLServer:
+		return "@p" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// createTable returns the statement which creates the migrations table unless it exists.
+func (d Dialect) createTable(table string) string {
+	const columns = "(version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL)"
+	if d == SQLServer {
+		return "IF OBJECT_ID('" + table + "', 'U') IS NULL CREATE TABLE " + table + " " + columns
+	}
+	return "CREATE TABLE IF NOT EXISTS " + table + " " + columns
+}
+
+// truncate returns the statements which remove all rows of the tables, children first.
+func (d Dialect) truncate(tables []string) []string {
+	if d == Postgres {
+		return []string{"TRUNCATE TABLE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE"}
+	}
+	stmts := make([]string, 0, len(tables))
+	for _, t := range tables {
+		stmts = append(stmts, "DELETE FROM "+t)
+	}
+	return stmts
+}
@@ -0,0 +1,170 @@
+package sqlmigrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// LoadFixtures loads the fixtures in the directories set with WithFixtures in the order of their file names.
+// Files ending with .sql are executed as is. Files ending with .yaml or .yml map table names to lists of rows,
+// the tables are filled in the order they appear in the file:
+//
+//	users:
+//	  - id: 1
+//	    name: alice
+//	    settings: {theme: dark}
+//
+// Nested mappings and sequences are inserted as JSON. Each file is loaded in its own transaction.
+func (m *Migrator) LoadFixtures() error {
+	if err := m.loadFixtures(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFixture, err)
+	}
+	return nil
+}
+
+func (m *Migrator) loadFixtures() error {
+	if m.db == nil {
+		return ErrNotStarted
+	}
+	ctx := context.Background()
+	for _, src := range m.fixtures {
+		entries, err := fs.ReadDir(src.fsys, src.dir)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			file := path.Join(src.dir, e.Name())
+			var load func(context.Context, *sql.Tx, []byte) error
+			switch path.Ext(e.Name()) {
+			case ".sql":
+				load = execSQL
+			case ".yaml", ".yml":
+				load = m.insertYAML
+			default:
+				continue
+			}
+			b, err := fs.ReadFile(src.fsys, file)
+			if err != nil {
+				return err
+			}
+			if err := m.inTx(ctx, func(tx *sql.Tx) error { return load(ctx, tx, b) }); err != nil {
+				return fmt.Errorf("%s: %w", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+func execSQL(ctx context.Context, tx *sql.Tx, b []byte) error {
+	_, err := tx.ExecContext(ctx, string(b))
+	return err
+}
+
+func (m *Migrator) insertYAML(ctx context.Context, tx *sql.Tx, b []byte) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return err
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("fixture must be a mapping of table names to rows")
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		table := root.Content[i].Value
+		var rows []map[string]any
+		if err := root.Content[i+1].Decode(&rows); err != nil {
+			return fmt.Errorf("table %s: %w", table, err)
+		}
+		if !slices.Contains(m.fixtureTables, table) {
+			m.fixtureTables = append(m.fixtureTables, table)
+		}
+		for _, row := range rows {
+			if err := m.insert(ctx, tx, table, row); err != nil {
+				return fmt.Errorf("table %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) insert(ctx context.Context, tx *sql.Tx, table string, row map[string]any) error {
+	cols := slices.Sorted(maps.Keys(row))
+	if err := checkIdentifiers(append([]string{table}, cols...)); err != nil {
+		return err
+	}
+	placeholders := make([]string, len(cols))
+	args := make([]any, len(cols))
+	for i, c := range cols {
+		placeholders[i] = m.dialect.placeholder(i + 1)
+		v := row[c]
+		switch v.(type) {
+		case map[string]any, []any:
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			v = string(b)
+		}
+		args[i] = v
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(cols, ", "), strings.Join(placeholders, ", ")) //nolint:gosec // The names are checked with checkIdentifiers.
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// Truncate removes all rows from the tables. Tables referenced by foreign keys have to be listed after
+// the tables referencing them, except with Postgres which truncates them together.
+func (m *Migrator) Truncate(tables ...string) error {
+	if m.db == nil {
+		return fmt.Errorf("%w: %w", ErrTruncate, ErrNotStarted)
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+	if err := checkIdentifiers(tables); err != nil {
+		return fmt.Errorf("%w: %w", ErrTruncate, err)
+	}
+	ctx := context.Background()
+	err := m.inTx(ctx, func(tx *sql.Tx) error {
+		for _, stmt := range m.dialect.truncate(tables) {
+			if _, err := tx.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTruncate, err)
+	}
+	return nil
+}
+
+// Reset truncates the tables set with WithResetTables and the tables of the YAML fixtures,
+// in the reverse order they were loaded, and loads the fixtures again.
+// Call it between tests to give each test the same data.
+func (m *Migrator) Reset() error {
+	tables := slices.Clone(m.resetTables)
+	for _, t := range slices.Backward(m.fixtureTables) {
+		if !slices.Contains(tables, t) {
+			tables = append(tables, t)
+		}
+	}
+	if err := m.Truncate(tables...); err != nil {
+		return err
+	}
+	return m.LoadFixtures()
+}
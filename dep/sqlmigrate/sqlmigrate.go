@@ -0,0 +1,387 @@
+package sqlmigrate
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply       = strerr.Error("failed to apply Opt")
+	ErrMissingDriver  = strerr.Error("missing driver name")
+	ErrMissingDSN     = strerr.Error("missing DSN")
+	ErrUnknownDialect = strerr.Error("unknown SQL dialect, set it with WithDialect")
+	ErrOpen           = strerr.Error("failed to open database")
+	ErrMigrate        = strerr.Error("failed to apply migrations")
+	ErrFixture        = strerr.Error("failed to load fixtures")
+	ErrTruncate       = strerr.Error("failed to truncate tables")
+	ErrIdentifier     = strerr.Error("invalid SQL identifier")
+	ErrNotStarted     = strerr.Error("migrator not started")
+)
+
+// DefaultMigrationsTable is the table which keeps track of the applied migrations.
+const DefaultMigrationsTable = "tstr_migrations"
+
+// Migrator applies migrations and loads fixtures into a database opened with database/sql.
+// The driver has to be registered by importing it, for example github.com/jackc/pgx/v5/stdlib.
+type Migrator struct {
+	opts          []Opt
+	name          string
+	driver        string
+	dsn           string
+	dialect       Dialect
+	table         string
+	migrations    []source
+	fixtures      []source
+	resetTables   []string
+	fixtureTables []string
+	openTimeout   time.Duration
+	outputs       expand.Values
+	db            *sql.DB
+}
+
+// Migration is an up-migration read from a file named <version>_<name>.up.sql or <version>_<name>.sql.
+type Migration struct {
+	Version uint64
+	Name    string
+	File    string
+
+	fsys fs.FS
+}
+
+type source struct {
+	fsys fs.FS
+	dir  string
+}
+
+type Opt func(*Migrator) error
+
+// New creates new Migrator dependency.
+func New(opts ...Opt) *Migrator {
+	return &Migrator{opts: opts}
+}
+
+func (m *Migrator) Start() error {
+	if err := m.apply(); err != nil {
+		return err
+	}
+	if err := m.open(); err != nil {
+		return fmt.Errorf("%w: %w", ErrOpen, err)
+	}
+	if _, err := m.Migrate(); err != nil {
+		return errors.Join(err, m.Stop())
+	}
+	if err := m.LoadFixtures(); err != nil {
+		return errors.Join(err, m.Stop())
+	}
+	return nil
+}
+
+func (m *Migrator) Ready() error { return nil }
+
+// Stop closes the database handle.
+func (m *Migrator) Stop() error {
+	if m.db == nil {
+		return nil
+	}
+	err := m.db.Close()
+	m.db = nil
+	return err
+}
+
+// Name returns the name set with WithName or "sqlmigrate".
+func (m *Migrator) Name() string {
+	if m.name != "" {
+		return m.name
+	}
+	return "sqlmigrate"
+}
+
+// Outputs returns the Driver and the resolved DSN, for example {{.sqlmigrate.DSN}}.
+func (m *Migrator) Outputs() map[string]string {
+	if m.db == nil {
+		return nil
+	}
+	return map[string]string{"Driver": m.driver, "DSN": m.dsn}
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders in the DSN.
+func (m *Migrator) SetOutputs(outputs map[string]map[string]string) {
+	if m.outputs == nil {
+		m.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(m.outputs, outputs)
+}
+
+// DB returns the database handle, which is closed when the dependency stops.
+func (m *Migrator) DB() *sql.DB {
+	return m.db
+}
+
+// Migrations returns the migrations found in the directories set with WithMigrations, ordered by version.
+func (m *Migrator) Migrations() ([]Migration, error) {
+	var migrations []Migration
+	seen := map[uint64]string{}
+	for _, src := range m.migrations {
+		entries, err := fs.ReadDir(src.fsys, src.dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			mig, ok := parseMigration(e.Name())
+			if !ok || e.IsDir() {
+				continue
+			}
+			mig.File, mig.fsys = path.Join(src.dir, e.Name()), src.fsys
+			if prev, ok := seen[mig.Version]; ok {
+				return nil, fmt.Errorf("duplicate migration version %d: %s and %s", mig.Version, prev, mig.File)
+			}
+			seen[mig.Version] = mig.File
+			migrations = append(migrations, mig)
+		}
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	return migrations, nil
+}
+
+// Migrate applies the migrations which haven't been applied yet and returns them.
+// Each migration is applied in its own transaction together with its record in the migrations table.
+func (m *Migrator) Migrate() ([]Migration, error) {
+	if m.db == nil {
+		return nil, fmt.Errorf("%w: %w", ErrMigrate, ErrNotStarted)
+	}
+	applied, err := m.migrate()
+	if err != nil {
+		return applied, fmt.Errorf("%w: %w", ErrMigrate, err)
+	}
+	return applied, nil
+}
+
+// apply resets the Migrator to the defaults, applies the options and resolves the DSN.
+func (m *Migrator) apply() error {
+	m.driver, m.dsn, m.dialect, m.table = "", "", "", DefaultMigrationsTable
+	m.migrations, m.fixtures, m.resetTables, m.fixtureTables = nil, nil, nil, nil
+	m.openTimeout = 10 * time.Second
+	for _, opt := range m.opts {
+		if err := opt(m); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if m.driver == "" {
+		return ErrMissingDriver
+	}
+	if m.dsn == "" {
+		return ErrMissingDSN
+	}
+	if err := checkIdentifiers(append([]string{m.table}, m.resetTables...)); err != nil {
+		return err
+	}
+	if m.dialect == "" {
+		m.dialect = dialectOf(m.driver)
+		if m.dialect == "" {
+			return fmt.Errorf("%w: driver '%s'", ErrUnknownDialect, m.driver)
+		}
+	}
+	dsn, err := expand.String(m.dsn, m.outputs)
+	if err != nil {
+		return err
+	}
+	m.dsn = dsn
+	return nil
+}
+
+func (m *Migrator) migrate() ([]Migration, error) {
+	migrations, err := m.Migrations()
+	if err != nil || len(migrations) == 0 {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if _, err := m.db.ExecContext(ctx, m.dialect.createTable(m.table)); err != nil {
+		return nil, err
+	}
+	done, err := m.appliedVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s (version, name) VALUES (%s, %s)", m.table, m.dialect.placeholder(1), m.dialect.placeholder(2)) //nolint:gosec // The table name is checked with checkIdentifiers.
+	applied := make([]Migration, 0, len(migrations))
+	for _, mig := range migrations {
+		if done[mig.Version] {
+			continue
+		}
+		b, err := fs.ReadFile(mig.fsys, mig.File)
+		if err != nil {
+			return applied, err
+		}
+		err = m.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, string(b)); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, insert, int64(mig.Version), mig.Name)
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("%s: %w", mig.File, err)
+		}
+		applied = append(applied, mig)
+	}
+	return applied, nil
+}
+
+func (m *Migrator) appliedVersions(ctx context.Context) (_ map[uint64]bool, err error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version FROM "+m.table) //nolint:gosec // The table name is checked with checkIdentifiers.
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, rows.Close()) }()
+	done := map[uint64]bool{}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		done[uint64(v)] = true
+	}
+	return done, rows.Err()
+}
+
+func (m *Migrator) open() error {
+	db, err := sql.Open(m.driver, m.dsn)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.openTimeout)
+	defer cancel()
+	for {
+		err = db.PingContext(ctx)
+		if err == nil {
+			m.db = db
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, db.Close())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (m *Migrator) inTx(ctx context.Context, fn func(*sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(.+?)(\.up)?\.sql$`)
+
+func parseMigration(file string) (Migration, bool) {
+	if strings.HasSuffix(file, ".down.sql") {
+		return Migration{}, false
+	}
+	match := migrationName.FindStringSubmatch(file)
+	if match == nil {
+		return Migration{}, false
+	}
+	v, err := strconv.ParseUint(match[1], 10, 64)
+	if err != nil {
+		return Migration{}, false
+	}
+	return Migration{Version: v, Name: match[2]}, true
+}
+
+// WithName sets the name of the migrator which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(m *Migrator) error {
+		m.name = name
+		return nil
+	}
+}
+
+// WithDriver sets the name of the database/sql driver, which is required.
+func WithDriver(driver string) Opt {
+	return func(m *Migrator) error {
+		m.driver = driver
+		return nil
+	}
+}
+
+// WithDSN sets the data source name, which is required.
+// The DSN can contain placeholders, for example postgres://test:test@{{.db.Addr}}/test.
+func WithDSN(dsn string) Opt {
+	return func(m *Migrator) error {
+		m.dsn = dsn
+		return nil
+	}
+}
+
+// WithDialect sets the SQL dialect, which is detected from the driver name by default.
+func WithDialect(d Dialect) Opt {
+	return func(m *Migrator) error {
+		m.dialect = d
+		return nil
+	}
+}
+
+// WithMigrations adds the up-migrations in dir of fsys. The files are named <version>_<name>.up.sql
+// or <version>_<name>.sql and applied in the order of their versions. Down-migrations and other files are ignored.
+// A file can contain several statements if the driver supports it.
+func WithMigrations(fsys fs.FS, dir string) Opt {
+	return func(m *Migrator) error {
+		m.migrations = append(m.migrations, source{fsys: fsys, dir: dir})
+		return nil
+	}
+}
+
+// WithMigrationsTable sets the table which keeps track of the applied migrations, defaults to DefaultMigrationsTable.
+// Like all table and column names it's inserted into the statements unquoted and must match [A-Za-z_][A-Za-z0-9_.]*.
+func WithMigrationsTable(table string) Opt {
+	return func(m *Migrator) error {
+		m.table = table
+		return nil
+	}
+}
+
+// WithFixtures adds the fixtures in dir of fsys, which are loaded after the migrations and by Reset, see LoadFixtures.
+func WithFixtures(fsys fs.FS, dir string) Opt {
+	return func(m *Migrator) error {
+		m.fixtures = append(m.fixtures, source{fsys: fsys, dir: dir})
+		return nil
+	}
+}
+
+// WithResetTables adds tables which are truncated by Reset in addition to the tables of the YAML fixtures.
+func WithResetTables(tables ...string) Opt {
+	return func(m *Migrator) error {
+		m.resetTables = append(m.resetTables, tables...)
+		return nil
+	}
+}
+
+// WithOpenTimeout sets how long opening the database is retried, defaults to 10 seconds.
+func WithOpenTimeout(d time.Duration) Opt {
+	return func(m *Migrator) error {
+		m.openTimeout = d
+		return nil
+	}
+}
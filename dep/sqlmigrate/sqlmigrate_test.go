@@ -0,0 +1,355 @@
+package sqlmigrate_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/sqlmigrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator_Migrate(t *testing.T) {
+	db := newFakeDB(t)
+	fsys := fstest.MapFS{
+		"migrations/1_users.sql":       {Data: []byte("CREATE TABLE users")},
+		"migrations/1_users.down.sql":  {Data: []byte("DROP TABLE users")},
+		"migrations/10_index.up.sql":   {Data: []byte("CREATE INDEX users_name")},
+		"migrations/2_orders.up.sql":   {Data: []byte("CREATE TABLE orders")},
+		"migrations/README.md":         {Data: []byte("docs")},
+		"migrations/sub/3_skip.up.sql": {Data: []byte("skipped")},
+	}
+	m := sqlmigrate.New(
+		sqlmigrate.WithName("db"),
+		sqlmigrate.WithDriver(fakeDriver),
+		sqlmigrate.WithDialect(sqlmigrate.Postgres),
+		sqlmigrate.WithDSN("{{.pg.Host}}"),
+		sqlmigrate.WithMigrations(fsys, "migrations"),
+	)
+	m.SetOutputs(map[string]map[string]string{"pg": {"Host": db.dsn}})
+	deptest.ErrorIs(t, m, func() {
+		assert.Equal(t, map[string]string{"Driver": fakeDriver, "DSN": db.dsn}, m.Outputs())
+		assert.Equal(t, []string{
+			"CREATE TABLE IF NOT EXISTS tstr_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL)",
+			"CREATE TABLE users",
+			"INSERT INTO tstr_migrations (version, name) VALUES ($1, $2) [1 users]",
+			"CREATE TABLE orders",
+			"INSERT INTO tstr_migrations (version, name) VALUES ($1, $2) [2 orders]",
+			"CREATE INDEX users_name",
+			"INSERT INTO tstr_migrations (version, name) VALUES ($1, $2) [10 index]",
+		}, db.statements())
+
+		migrations, err := m.Migrations()
+		require.NoError(t, err)
+		require.Len(t, migrations, 3)
+		assert.Equal(t, "migrations/10_index.up.sql", migrations[2].File)
+
+		db.reset()
+		fsys["migrations/11_more.up.sql"] = &fstest.MapFile{Data: []byte("ALTER TABLE users")}
+		applied, err := m.Migrate()
+		require.NoError(t, err)
+		require.Len(t, applied, 1)
+		assert.Equal(t, "more", applied[0].Name)
+		assert.Contains(t, db.statements(), "ALTER TABLE users")
+	}, nil)
+}
+
+func TestMigrator_SQLServer(t *testing.T) {
+	db := newFakeDB(t)
+	fsys := fstest.MapFS{"1_users.sql": {Data: []byte("CREATE TABLE users")}}
+	m := sqlmigrate.New(
+		sqlmigrate.WithDriver(fakeDriver),
+		sqlmigrate.WithDialect(sqlmigrate.SQLServer),
+		sqlmigrate.WithDSN(db.dsn),
+		sqlmigrate.WithMigrations(fsys, "."),
+	)
+	deptest.ErrorIs(t, m, func() {
+		assert.Equal(t, []string{
+			"IF OBJECT_ID('tstr_migrations', 'U') IS NULL CREATE TABLE tstr_migrations (version BIGINT PRIMARY KEY, name VARCHAR(255) NOT NULL)",
+			"CREATE TABLE users",
+			"INSERT INTO tstr_migrations (version, name) VALUES (@p1, @p2) [1 users]",
+		}, db.statements())
+	}, nil)
+}
+
+func TestMigrator_Stopped(t *testing.T) {
+	db := newFakeDB(t)
+	m := sqlmigrate.New(sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDialect(sqlmigrate.MySQL), sqlmigrate.WithDSN(db.dsn))
+	deptest.ErrorIs(t, m, nil, nil)
+
+	err := m.Reset()
+	require.ErrorIs(t, err, sqlmigrate.ErrTruncate)
+	require.ErrorIs(t, err, sqlmigrate.ErrNotStarted)
+	require.ErrorIs(t, m.Truncate(), sqlmigrate.ErrNotStarted)
+	require.ErrorIs(t, m.LoadFixtures(), sqlmigrate.ErrNotStarted)
+	_, err = m.Migrate()
+	require.ErrorIs(t, err, sqlmigrate.ErrNotStarted)
+}
+
+func TestMigrator_FailingMigration(t *testing.T) {
+	db := newFakeDB(t)
+	fsys := fstest.MapFS{
+		"1_ok.sql":   {Data: []byte("CREATE TABLE ok")},
+		"2_fail.sql": {Data: []byte("FAIL")},
+	}
+	m := sqlmigrate.New(
+		sqlmigrate.WithDriver(fakeDriver),
+		sqlmigrate.WithDialect(sqlmigrate.SQLite),
+		sqlmigrate.WithDSN(db.dsn),
+		sqlmigrate.WithMigrations(fsys, "."),
+		sqlmigrate.WithMigrationsTable("schema_versions"),
+	)
+	deptest.ErrorIs(t, m, nil, sqlmigrate.ErrMigrate)
+	assert.Equal(t, []int64{1}, db.versions())
+	assert.Nil(t, m.DB())
+}
+
+func TestMigrator_Fixtures(t *testing.T) {
+	db := newFakeDB(t)
+	fsys := fstest.MapFS{
+		"fixtures/01_users.yaml": {Data: []byte(`
+users:
+  - id: 1
+    name: alice
+    settings: {theme: dark}
+orders:
+  - id: 10
+    user_id: 1
+`)},
+		"fixtures/02_raw.sql": {Data: []byte("UPDATE users SET active = true")},
+		"fixtures/notes.txt":  {Data: []byte("ignored")},
+	}
+	m := sqlmigrate.New(
+		sqlmigrate.WithDriver(fakeDriver),
+		sqlmigrate.WithDialect(sqlmigrate.Postgres),
+		sqlmigrate.WithDSN(db.dsn),
+		sqlmigrate.WithFixtures(fsys, "fixtures"),
+		sqlmigrate.WithResetTables("audit_log"),
+	)
+	deptest.ErrorIs(t, m, func() {
+		seed := []string{
+			`INSERT INTO users (id, name, settings) VALUES ($1, $2, $3) [1 alice {"theme":"dark"}]`,
+			"INSERT INTO orders (id, user_id) VALUES ($1, $2) [10 1]",
+			"UPDATE users SET active = true",
+		}
+		assert.Equal(t, seed, db.statements())
+
+		db.reset()
+		require.NoError(t, m.Reset())
+		assert.Equal(t, append([]string{"TRUNCATE TABLE audit_log, orders, users RESTART IDENTITY CASCADE"}, seed...), db.statements())
+
+		db.reset()
+		require.NoError(t, m.Truncate("users"))
+		assert.Equal(t, []string{"TRUNCATE TABLE users RESTART IDENTITY CASCADE"}, db.statements())
+	}, nil)
+}
+
+func TestMigrator_TruncateDelete(t *testing.T) {
+	db := newFakeDB(t)
+	m := sqlmigrate.New(sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDialect(sqlmigrate.MySQL), sqlmigrate.WithDSN(db.dsn))
+	deptest.ErrorIs(t, m, func() {
+		require.NoError(t, m.Truncate("orders", "users"))
+		assert.Equal(t, []string{"DELETE FROM orders", "DELETE FROM users"}, db.statements())
+
+		require.ErrorIs(t, m.Truncate("FAIL"), sqlmigrate.ErrTruncate)
+
+		err := m.Truncate("users; DROP TABLE users")
+		require.ErrorIs(t, err, sqlmigrate.ErrTruncate)
+		require.ErrorIs(t, err, sqlmigrate.ErrIdentifier)
+		assert.Equal(t, []string{"DELETE FROM orders", "DELETE FROM users"}, db.statements())
+	}, nil)
+}
+
+func TestMigrator_Errors(t *testing.T) {
+	db := newFakeDB(t)
+	badYAML := fstest.MapFS{"f.yaml": {Data: []byte("- not a mapping")}}
+	badColumn := fstest.MapFS{"f.yaml": {Data: []byte("users:\n  - \"id) VALUES (1); --\": 1\n")}}
+	tests := []struct {
+		name string
+		m    *sqlmigrate.Migrator
+		err  error
+	}{
+		{"missing driver", sqlmigrate.New(sqlmigrate.WithDSN(db.dsn)), sqlmigrate.ErrMissingDriver},
+		{"missing DSN", sqlmigrate.New(sqlmigrate.WithDriver(fakeDriver)), sqlmigrate.ErrMissingDSN},
+		{"unknown dialect", sqlmigrate.New(sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDSN(db.dsn)), sqlmigrate.ErrUnknownDialect},
+		{"unregistered driver", sqlmigrate.New(sqlmigrate.WithDriver("pgx"), sqlmigrate.WithDSN(db.dsn)), sqlmigrate.ErrOpen},
+		{"bad fixture", sqlmigrate.New(
+			sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDialect(sqlmigrate.SQLite),
+			sqlmigrate.WithDSN(db.dsn), sqlmigrate.WithFixtures(badYAML, "."),
+		), sqlmigrate.ErrFixture},
+		{"bad fixture column", sqlmigrate.New(
+			sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDialect(sqlmigrate.SQLite),
+			sqlmigrate.WithDSN(db.dsn), sqlmigrate.WithFixtures(badColumn, "."),
+		), sqlmigrate.ErrIdentifier},
+		{"bad migrations table", sqlmigrate.New(
+			sqlmigrate.WithDriver(fakeDriver), sqlmigrate.WithDialect(sqlmigrate.SQLite),
+			sqlmigrate.WithDSN(db.dsn), sqlmigrate.WithMigrationsTable("versions v"),
+		), sqlmigrate.ErrIdentifier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deptest.ErrorIs(t, tt.m, nil, tt.err)
+		})
+	}
+}
+
+const fakeDriver = "tstr-fake"
+
+var (
+	registerOnce sync.Once
+	fakeDBs      sync.Map
+)
+
+// fakeDB records the statements executed through the fake driver.
+// Statements containing FAIL return an error and the versions inserted into the migrations table are kept.
+type fakeDB struct {
+	dsn   string
+	mu    sync.Mutex
+	execs []string
+	vers  []int64
+}
+
+func newFakeDB(t *testing.T) *fakeDB {
+	registerOnce.Do(func() { sql.Register(fakeDriver, fakeDriverImpl{}) })
+	db := &fakeDB{dsn: t.Name()}
+	fakeDBs.Store(db.dsn, db)
+	t.Cleanup(func() { fakeDBs.Delete(db.dsn) })
+	return db
+}
+
+func (db *fakeDB) statements() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.execs...)
+}
+
+func (db *fakeDB) versions() []int64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]int64(nil), db.vers...)
+}
+
+func (db *fakeDB) reset() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = nil
+}
+
+type fakeDriverImpl struct{}
+
+func (fakeDriverImpl) Open(dsn string) (driver.Conn, error) {
+	db, ok := fakeDBs.Load(dsn)
+	if !ok {
+		return nil, fmt.Errorf("unknown database %s", dsn)
+	}
+	fake, ok := db.(*fakeDB)
+	if !ok {
+		return nil, fmt.Errorf("unexpected database %T", db)
+	}
+	return &fakeConn{db: fake}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+	tx *fakeTx
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	c.tx = &fakeTx{conn: c}
+	return c.tx, nil
+}
+
+type fakeTx struct {
+	conn  *fakeConn
+	execs []string
+	vers  []int64
+}
+
+func (tx *fakeTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = append(db.execs, tx.execs...)
+	db.vers = append(db.vers, tx.vers...)
+	tx.conn.tx = nil
+	return nil
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.Contains(s.query, "FAIL") {
+		return nil, errors.New("statement failed")
+	}
+	stmt := s.query
+	if len(args) > 0 {
+		stmt += fmt.Sprint(" ", args)
+	}
+	var vers []int64
+	if strings.Contains(s.query, "(version, name)") {
+		v, ok := args[0].(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected version %T", args[0])
+		}
+		vers = append(vers, v)
+	}
+
+	if tx := s.conn.tx; tx != nil {
+		tx.execs = append(tx.execs, stmt)
+		tx.vers = append(tx.vers, vers...)
+		return driver.RowsAffected(1), nil
+	}
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.execs = append(db.execs, stmt)
+	db.vers = append(db.vers, vers...)
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, "SELECT version FROM") {
+		return nil, fmt.Errorf("unexpected query %s", s.query)
+	}
+	return &fakeRows{vers: s.conn.db.versions()}, nil
+}
+
+type fakeRows struct {
+	vers []int64
+}
+
+func (r *fakeRows) Columns() []string { return []string{"version"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.vers) == 0 {
+		return io.EOF
+	}
+	dest[0], r.vers = r.vers[0], r.vers[1:]
+	return nil
+}
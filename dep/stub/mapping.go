@@ -0,0 +1,307 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+)
+
+// StateStarted is the initial state of every scenario.
+const StateStarted = "Started"
+
+// Mapping defines the response for requests matching Request.
+// Mappings are loaded from JSON files, see WithDir.
+type Mapping struct {
+	// Name is used in error messages and the artifacts.
+	Name string `json:"name,omitempty"`
+	// Priority orders the mappings, lower priority is matched first.
+	// Mappings with the same priority are matched in the order they were added.
+	Priority int            `json:"priority,omitempty"`
+	Request  RequestMatcher `json:"request"`
+	Response Response       `json:"response"`
+	// Scenario, RequiredState and NewState define a state machine.
+	// The mapping matches only when the scenario is in RequiredState and moves the scenario to NewState.
+	// Every scenario starts in StateStarted.
+	Scenario      string `json:"scenario,omitempty"`
+	RequiredState string `json:"requiredState,omitempty"`
+	NewState      string `json:"newState,omitempty"`
+}
+
+// RequestMatcher matches requests. Empty fields match any request.
+type RequestMatcher struct {
+	// Method matches the request method case insensitively.
+	Method string `json:"method,omitempty"`
+	// Path matches the request path exactly.
+	Path string `json:"path,omitempty"`
+	// PathPattern is a regular expression which must match the whole request path.
+	// Named groups are available as .Request.PathParams in response templates.
+	PathPattern string `json:"pathPattern,omitempty"`
+	// Query matches the first value of each query parameter exactly.
+	Query map[string]string `json:"query,omitempty"`
+	// Headers matches the first value of each header exactly.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body matches the request body exactly.
+	Body string `json:"body,omitempty"`
+	// BodyPattern is a regular expression which must match the request body.
+	BodyPattern string `json:"bodyPattern,omitempty"`
+	// JSONBody matches when the request body is JSON containing JSONBody.
+	// Objects may contain additional fields, arrays and other values must be equal.
+	JSONBody any `json:"jsonBody,omitempty"`
+}
+
+// Response is the response of a mapping.
+type Response struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	// JSONBody is encoded as the body with application/json content type.
+	JSONBody any `json:"jsonBody,omitempty"`
+	// BodyFile is read as the body. In mapping files it's relative to the mapping file.
+	BodyFile string `json:"bodyFile,omitempty"`
+	// Template executes the body and header values as Go templates with Request and Outputs fields.
+	Template bool `json:"template,omitempty"`
+	// Delay delays the response, for example "100ms".
+	Delay Duration `json:"delay,omitempty"`
+}
+
+// Duration is time.Duration which is encoded in JSON as a duration string such as "1.5s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = Duration(v)
+	return err
+}
+
+type mapping struct {
+	Mapping
+	path  *regexp.Regexp
+	body  *regexp.Regexp
+	json  any
+	reply []byte
+}
+
+func compile(m Mapping) (*mapping, error) {
+	c, err := compileMatcher(m.Request)
+	if err != nil {
+		return nil, err
+	}
+	c.Mapping = m
+
+	switch {
+	case m.Response.JSONBody != nil:
+		if c.reply, err = json.Marshal(m.Response.JSONBody); err != nil {
+			return nil, err
+		}
+	case m.Response.Body != "":
+		c.reply = []byte(m.Response.Body)
+	}
+	return c, nil
+}
+
+func compileMatcher(m RequestMatcher) (*mapping, error) {
+	c := &mapping{Mapping: Mapping{Request: m}}
+	var err error
+	if m.PathPattern != "" {
+		if c.path, err = regexp.Compile("^(?:" + m.PathPattern + ")$"); err != nil {
+			return nil, err
+		}
+	}
+	if m.BodyPattern != "" {
+		if c.body, err = regexp.Compile(m.BodyPattern); err != nil {
+			return nil, err
+		}
+	}
+	if m.JSONBody != nil {
+		if c.json, err = normalize(m.JSONBody); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// match reports whether r matches and returns the named groups of the path pattern.
+func (m *mapping) match(r httpserver.Request) (map[string]string, bool) {
+	req := m.Request
+	ok := (req.Method == "" || strings.EqualFold(req.Method, r.Method)) &&
+		matchExact(req.Path, r.URL.Path) &&
+		matchValues(req.Query, r.URL.Query().Get) &&
+		matchValues(req.Headers, r.Header.Get) &&
+		matchExact(req.Body, string(r.Body)) &&
+		m.matchBody(r.Body)
+	if !ok {
+		return nil, false
+	}
+	return m.matchPath(r.URL.Path)
+}
+
+// matchExact reports whether got equals want or want is empty.
+func matchExact(want, got string) bool {
+	return want == "" || want == got
+}
+
+// matchValues reports whether get returns the wanted value for each key.
+func matchValues(want map[string]string, get func(string) string) bool {
+	for k, v := range want {
+		if get(k) != v {
+			return false
+		}
+	}
+	return true
+}
+
+// matchBody matches the body against BodyPattern and JSONBody.
+func (m *mapping) matchBody(body []byte) bool {
+	if m.body != nil && !m.body.Match(body) {
+		return false
+	}
+	if m.json == nil {
+		return true
+	}
+	var got any
+	return json.Unmarshal(body, &got) == nil && contains(got, m.json)
+}
+
+// matchPath matches p against PathPattern and returns its named groups.
+func (m *mapping) matchPath(p string) (map[string]string, bool) {
+	params := map[string]string{}
+	if m.path == nil {
+		return params, true
+	}
+	match := m.path.FindStringSubmatch(p)
+	if match == nil {
+		return nil, false
+	}
+	for i, name := range m.path.SubexpNames() {
+		if name != "" {
+			params[name] = match[i]
+		}
+	}
+	return params, true
+}
+
+func (m RequestMatcher) String() string {
+	method, p := m.Method, m.Path
+	if method == "" {
+		method = "ANY"
+	}
+	if p == "" {
+		p = m.PathPattern
+	}
+	if p == "" {
+		p = "*"
+	}
+	return method + " " + p
+}
+
+// contains reports whether got contains want, see RequestMatcher.JSONBody.
+func contains(got, want any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		return ok && containsObject(g, w)
+	case []any:
+		g, ok := got.([]any)
+		return ok && containsArray(g, w)
+	default:
+		return got == want
+	}
+}
+
+func containsObject(got, want map[string]any) bool {
+	for k, v := range want {
+		gv, ok := got[k]
+		if !ok || !contains(gv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsArray(got, want []any) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range want {
+		if !contains(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize converts v into the types produced by json.Unmarshal.
+func normalize(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n any
+	return n, json.Unmarshal(b, &n)
+}
+
+// load reads the mappings from the JSON files in dir.
+// A file contains either a single mapping or an array of mappings.
+func load(fsys fs.FS, dir string) ([]Mapping, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings []Mapping
+	for _, f := range files {
+		b, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+
+		var ms []Mapping
+		if b = bytes.TrimSpace(b); bytes.HasPrefix(b, []byte("[")) {
+			err = json.Unmarshal(b, &ms)
+		} else {
+			ms = make([]Mapping, 1)
+			err = json.Unmarshal(b, &ms[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+
+		for i, m := range ms {
+			if m.Name == "" {
+				ms[i].Name = path.Base(f)
+			}
+			if m.Response.BodyFile != "" {
+				body, err := fs.ReadFile(fsys, path.Join(path.Dir(f), m.Response.BodyFile))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", f, err)
+				}
+				ms[i].Response.Body, ms[i].Response.BodyFile = string(body), ""
+			}
+		}
+		mappings = append(mappings, ms...)
+	}
+	return mappings, nil
+}
+
+func (r Response) status() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
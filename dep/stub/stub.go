@@ -0,0 +1,386 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply    = strerr.Error("failed to apply Opt")
+	ErrLoadMapping = strerr.Error("failed to load mapping")
+	ErrVerify      = strerr.Error("verification failed")
+)
+
+// Stub is an HTTP server which responds to requests based on mappings, similar to WireMock.
+// Requests which don't match any mapping get 404 response and are recorded, see Unmatched.
+type Stub struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+	outputs    expand.Values
+
+	mu        sync.Mutex
+	mappings  []*mapping
+	states    map[string]string
+	unmatched []httpserver.Request
+}
+
+type Opt func(*Stub) error
+
+// New creates new Stub dependency.
+func New(opts ...Opt) *Stub {
+	return &Stub{opts: opts}
+}
+
+func (s *Stub) Start() error {
+	s.mappings, s.serverOpts, s.states, s.unmatched = nil, nil, map[string]string{}, nil
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+	slices.SortStableFunc(s.mappings, func(a, b *mapping) int { return a.Priority - b.Priority })
+
+	s.server = httpserver.New(append(slices.Clone(s.serverOpts), httpserver.WithHandler(http.HandlerFunc(s.serveHTTP)))...)
+	return s.server.Start()
+}
+
+func (s *Stub) Ready() error { return nil }
+
+func (s *Stub) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Stop()
+}
+
+// Name returns the name set with WithName or "stub".
+func (s *Stub) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "stub"
+}
+
+// Outputs returns the outputs of the underlying server, see httpserver.Server.Outputs.
+func (s *Stub) Outputs() map[string]string {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Outputs()
+}
+
+// SetOutputs sets the outputs of other dependencies which are available as .Outputs in response templates.
+func (s *Stub) SetOutputs(outputs map[string]map[string]string) {
+	if s.outputs == nil {
+		s.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(s.outputs, outputs)
+}
+
+// CollectArtifacts writes the recorded requests into requests.json and the unmatched requests into unmatched.json.
+func (s *Stub) CollectArtifacts(dir string) error {
+	if s.server == nil {
+		return nil
+	}
+	if err := s.server.CollectArtifacts(dir); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(s.Unmatched(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "unmatched.json"), b, 0o600)
+}
+
+// URL returns the base URL of the stub or an empty string if the stub hasn't been started.
+func (s *Stub) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL()
+}
+
+// Client returns a client for calling the stub, see httpserver.Server.Client,
+// or a plain client if the stub hasn't been started.
+func (s *Stub) Client() *http.Client {
+	if s.server == nil {
+		return &http.Client{}
+	}
+	return s.server.Client()
+}
+
+// Requests returns all recorded requests.
+func (s *Stub) Requests() []httpserver.Request {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Requests()
+}
+
+// Unmatched returns the requests which didn't match any mapping.
+func (s *Stub) Unmatched() []httpserver.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.unmatched)
+}
+
+// Count returns the number of recorded requests matching m.
+func (s *Stub) Count(m RequestMatcher) (int, error) {
+	c, err := compileMatcher(m)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, r := range s.Requests() {
+		if _, ok := c.match(r); ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Verify returns an error wrapping ErrVerify unless exactly times recorded requests match m.
+func (s *Stub) Verify(m RequestMatcher, times int) error {
+	n, err := s.Count(m)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrVerify, err)
+	}
+	if n != times {
+		return fmt.Errorf("%w: expected %d requests matching %s, got %d", ErrVerify, times, m, n)
+	}
+	return nil
+}
+
+// State returns the current state of scenario.
+func (s *Stub) State(scenario string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state(scenario)
+}
+
+// SetState moves scenario to state.
+func (s *Stub) SetState(scenario, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[scenario] = state
+}
+
+// Reset clears the recorded requests and moves all scenarios to StateStarted.
+func (s *Stub) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.server != nil {
+		s.server.Reset()
+	}
+	s.unmatched = nil
+	clear(s.states)
+}
+
+func (s *Stub) state(scenario string) string {
+	if state, ok := s.states[scenario]; ok {
+		return state
+	}
+	return StateStarted
+}
+
+func (s *Stub) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := httpserver.Request{Method: r.Method, URL: r.URL, Header: r.Header, Body: body}
+
+	m, params := s.find(req)
+	if m == nil {
+		http.Error(w, "no stub mapping for "+r.Method+" "+r.URL.Path, http.StatusNotFound)
+		return
+	}
+
+	if d := time.Duration(m.Response.Delay); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if err := s.respond(w, m, req, params); err != nil {
+		http.Error(w, fmt.Sprintf("mapping %s: %s", m.Name, err), http.StatusInternalServerError)
+	}
+}
+
+// find returns the first mapping matching r and moves its scenario to the new state.
+func (s *Stub) find(r httpserver.Request) (*mapping, map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.mappings {
+		if m.Scenario != "" && m.RequiredState != "" && s.state(m.Scenario) != m.RequiredState {
+			continue
+		}
+		params, ok := m.match(r)
+		if !ok {
+			continue
+		}
+		if m.Scenario != "" && m.NewState != "" {
+			s.states[m.Scenario] = m.NewState
+		}
+		return m, params
+	}
+	s.unmatched = append(s.unmatched, r)
+	return nil, nil
+}
+
+func (s *Stub) respond(w http.ResponseWriter, m *mapping, r httpserver.Request, params map[string]string) error {
+	headers := maps.Clone(m.Response.Headers)
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if _, ok := headers["Content-Type"]; !ok && m.Response.JSONBody != nil {
+		headers["Content-Type"] = "application/json"
+	}
+	body := m.reply
+
+	if m.Response.Template {
+		data := templateData{Request: newTemplateRequest(r, params), Outputs: s.outputs}
+		for k, v := range headers {
+			b, err := render(k, []byte(v), data)
+			if err != nil {
+				return err
+			}
+			headers[k] = string(b)
+		}
+		b, err := render(m.Name, body, data)
+		if err != nil {
+			return err
+		}
+		body = b
+	}
+
+	for k, v := range headers {
+		w.Header().Set(k, v)
+	}
+	w.WriteHeader(m.Response.status())
+	_, err := w.Write(body)
+	return err
+}
+
+type templateData struct {
+	Request templateRequest
+	Outputs expand.Values
+}
+
+type templateRequest struct {
+	Method     string
+	Path       string
+	PathParams map[string]string
+	Query      url.Values
+	Header     http.Header
+	Body       string
+	JSON       any
+}
+
+func newTemplateRequest(r httpserver.Request, params map[string]string) templateRequest {
+	var body any
+	_ = json.Unmarshal(r.Body, &body)
+	return templateRequest{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		PathParams: params,
+		Query:      r.URL.Query(),
+		Header:     r.Header,
+		Body:       string(r.Body),
+		JSON:       body,
+	}
+}
+
+func render(name string, text []byte, data templateData) ([]byte, error) {
+	tmpl, err := template.New(name).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = tmpl.Execute(buf, data)
+	return buf.Bytes(), err
+}
+
+func (s *Stub) add(ms ...Mapping) error {
+	for _, m := range ms {
+		c, err := compile(m)
+		if err != nil {
+			return fmt.Errorf("%w %s: %w", ErrLoadMapping, m.Name, err)
+		}
+		s.mappings = append(s.mappings, c)
+	}
+	return nil
+}
+
+// WithName sets the name of the stub which is used for its outputs.
+func WithName(name string) Opt {
+	return func(s *Stub) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithDir loads the mappings from the JSON files in dir, see Mapping.
+// Body files must be inside dir, use WithFS for body files in other directories.
+func WithDir(dir string) Opt {
+	return WithFS(os.DirFS(dir), ".")
+}
+
+// WithFS loads the mappings from the JSON files in dir of fsys, see Mapping.
+func WithFS(fsys fs.FS, dir string) Opt {
+	return func(s *Stub) error {
+		ms, err := load(fsys, dir)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrLoadMapping, err)
+		}
+		return s.add(ms...)
+	}
+}
+
+// WithMapping adds mappings. Response.BodyFile is relative to the working directory.
+func WithMapping(mappings ...Mapping) Opt {
+	return func(s *Stub) error {
+		mappings := slices.Clone(mappings)
+		for i, m := range mappings {
+			if m.Response.BodyFile == "" {
+				continue
+			}
+			b, err := os.ReadFile(m.Response.BodyFile)
+			if err != nil {
+				return fmt.Errorf("%w %s: %w", ErrLoadMapping, m.Name, err)
+			}
+			mappings[i].Response.Body, mappings[i].Response.BodyFile = string(b), ""
+		}
+		return s.add(mappings...)
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithTLS.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(s *Stub) error {
+		s.serverOpts = append(s.serverOpts, opts...)
+		return nil
+	}
+}
@@ -0,0 +1,145 @@
+package stub_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/dep/stub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStub(t *testing.T) {
+	api := httpserver.New(httpserver.WithName("api"))
+	s := stub.New(stub.WithFS(os.DirFS("testdata"), "mappings"))
+	assert.Empty(t, s.URL())
+	assert.Empty(t, s.Requests())
+
+	err := tstr.Run(
+		tstr.WithDeps(api, s),
+		tstr.WithFn(func() {
+			resp := call(t, s, http.MethodGet, "/users/42", "", nil)
+			assert.Equal(t, http.StatusOK, resp.status)
+			assert.Equal(t, "42", resp.header.Get("X-User-Id"))
+			assert.Equal(t, "application/json", resp.header.Get("Content-Type"))
+			assert.JSONEq(t, `{"id":"42","api":"`+api.URL()+`"}`, resp.body)
+
+			json := http.Header{"Content-Type": {"application/json"}}
+			resp = call(t, s, http.MethodPost, "/users", `{"name":"admin","role":"admin"}`, json)
+			assert.Equal(t, http.StatusForbidden, resp.status)
+
+			start := time.Now()
+			resp = call(t, s, http.MethodPost, "/users", `{"name":"test","role":"user"}`, json)
+			assert.Equal(t, http.StatusCreated, resp.status)
+			assert.JSONEq(t, `{"created":true}`, resp.body)
+			assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+
+			resp = call(t, s, http.MethodPost, "/users", `{"name":"other"}`, json)
+			assert.Equal(t, http.StatusNotFound, resp.status)
+			assert.Len(t, s.Unmatched(), 1)
+
+			require.NoError(t, s.Verify(stub.RequestMatcher{Method: "POST", Path: "/users"}, 3))
+			require.NoError(t, s.Verify(stub.RequestMatcher{Path: "/users", JSONBody: map[string]string{"name": "test"}}, 1))
+			err := s.Verify(stub.RequestMatcher{PathPattern: "/users/.*"}, 2)
+			require.ErrorIs(t, err, stub.ErrVerify)
+			assert.EqualError(t, err, "verification failed: expected 2 requests matching ANY /users/.*, got 1")
+		}),
+	)
+	require.NoError(t, err)
+}
+
+func TestStub_Scenario(t *testing.T) {
+	s := stub.New(
+		stub.WithFS(os.DirFS("testdata"), "mappings"),
+		stub.WithMapping(stub.Mapping{
+			Request:       stub.RequestMatcher{Method: "GET", Path: "/order"},
+			Response:      stub.Response{Body: "shipped"},
+			Scenario:      "order",
+			RequiredState: "shipped",
+		}),
+	)
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, stub.StateStarted, s.State("order"))
+		assert.Equal(t, "pending", call(t, s, http.MethodGet, "/order?id=1", "", nil).body)
+		assert.Equal(t, "shipped", s.State("order"))
+		assert.Equal(t, "shipped", call(t, s, http.MethodGet, "/order?id=1", "", nil).body)
+
+		s.Reset()
+		assert.Empty(t, s.Requests())
+		assert.Equal(t, stub.StateStarted, s.State("order"))
+		s.SetState("order", "shipped")
+		assert.Equal(t, "shipped", call(t, s, http.MethodGet, "/order?id=1", "", nil).body)
+	}, nil)
+}
+
+func TestStub_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  stub.Opt
+		err  error
+	}{
+		{
+			name: "missing_body_file",
+			opt:  stub.WithMapping(stub.Mapping{Response: stub.Response{BodyFile: "missing.json"}}),
+			err:  stub.ErrLoadMapping,
+		},
+		{
+			name: "bad_pattern",
+			opt:  stub.WithMapping(stub.Mapping{Request: stub.RequestMatcher{PathPattern: "("}}),
+			err:  stub.ErrLoadMapping,
+		},
+		{
+			name: "missing_dir_body_file",
+			opt:  stub.WithDir("testdata/mappings"),
+			err:  stub.ErrLoadMapping,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deptest.ErrorIs(t, stub.New(tt.opt), nil, tt.err)
+		})
+	}
+}
+
+func TestStub_CollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	s := stub.New(stub.WithServerOpts(httpserver.WithTLS()))
+	deptest.ErrorIs(t, s, func() {
+		assert.True(t, strings.HasPrefix(s.URL(), "https://"))
+		assert.Equal(t, http.StatusNotFound, call(t, s, http.MethodGet, "/", "", nil).status)
+		require.NoError(t, s.CollectArtifacts(dir))
+	}, nil)
+	assert.FileExists(t, filepath.Join(dir, "requests.json"))
+	assert.FileExists(t, filepath.Join(dir, "unmatched.json"))
+}
+
+type response struct {
+	status int
+	header http.Header
+	body   string
+}
+
+func call(t *testing.T, s *stub.Stub, method, path, body string, header http.Header) response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), method, s.URL()+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header = header
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	resp, err := s.Client().Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return response{status: resp.StatusCode, header: resp.Header, body: string(b)}
+}
@@ -0,0 +1,229 @@
+package vcr
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Redacted replaces the values removed with the redaction options.
+const Redacted = "REDACTED"
+
+// Cassette holds the recorded interactions.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Recorded time.Time `json:"recorded"`
+	Request  Request   `json:"request"`
+	Response Response  `json:"response"`
+}
+
+// Request is a recorded request. URL is the absolute URL of the upstream request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Body is encoded as a JSON string if it's valid UTF-8 and as {"base64": "..."} otherwise,
+// which keeps text bodies readable in the cassette files.
+type Body []byte
+
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string][]byte{"base64": b})
+}
+
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*b = Body(s)
+		return nil
+	}
+	var v struct {
+		Base64 []byte `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*b = v.Base64
+	return nil
+}
+
+func loadCassette(path string) (*Cassette, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (c *Cassette) save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o600)
+}
+
+// Matcher reports whether an incoming request matches a recorded request.
+// The incoming request is redacted the same way as the recorded ones before matching.
+type Matcher func(r, recorded Request) bool
+
+// MatchMethod matches the HTTP method.
+func MatchMethod(r, recorded Request) bool {
+	return r.Method == recorded.Method
+}
+
+// MatchURL matches the scheme, host, path and query, ignoring the order of the query parameters.
+func MatchURL(r, recorded Request) bool {
+	u1, err1 := url.Parse(r.URL)
+	u2, err2 := url.Parse(recorded.URL)
+	if err1 != nil || err2 != nil {
+		return r.URL == recorded.URL
+	}
+	return u1.Scheme == u2.Scheme && u1.Host == u2.Host && u1.Path == u2.Path && queryEqual(u1, u2)
+}
+
+// MatchPath matches the URL path.
+func MatchPath(r, recorded Request) bool {
+	u1, err1 := url.Parse(r.URL)
+	u2, err2 := url.Parse(recorded.URL)
+	return err1 == nil && err2 == nil && u1.Path == u2.Path
+}
+
+// MatchQuery matches the query parameters, ignoring their order.
+func MatchQuery(r, recorded Request) bool {
+	u1, err1 := url.Parse(r.URL)
+	u2, err2 := url.Parse(recorded.URL)
+	return err1 == nil && err2 == nil && queryEqual(u1, u2)
+}
+
+// MatchBody matches the body byte by byte.
+func MatchBody(r, recorded Request) bool {
+	return bytes.Equal(r.Body, recorded.Body)
+}
+
+// MatchJSONBody matches bodies which are equal JSON values, falling back to MatchBody for other bodies.
+func MatchJSONBody(r, recorded Request) bool {
+	var v1, v2 any
+	if json.Unmarshal(r.Body, &v1) != nil || json.Unmarshal(recorded.Body, &v2) != nil {
+		return MatchBody(r, recorded)
+	}
+	b1, _ := json.Marshal(v1)
+	b2, _ := json.Marshal(v2)
+	return bytes.Equal(b1, b2)
+}
+
+// MatchHeader returns a matcher which matches the values of the given headers.
+func MatchHeader(names ...string) Matcher {
+	return func(r, recorded Request) bool {
+		for _, name := range names {
+			if !slices.Equal(r.Header.Values(name), recorded.Header.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func queryEqual(u1, u2 *url.URL) bool {
+	q1, q2 := u1.Query(), u2.Query()
+	return maps.EqualFunc(q1, q2, func(v1, v2 []string) bool {
+		return slices.Equal(slices.Sorted(slices.Values(v1)), slices.Sorted(slices.Values(v2)))
+	})
+}
+
+type bodyRedaction struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// redaction removes secrets from interactions before they are saved or matched.
+type redaction struct {
+	headers []string
+	query   []string
+	bodies  []bodyRedaction
+	funcs   []func(*Interaction)
+}
+
+func (rd *redaction) apply(i *Interaction) {
+	i.Request.Header = rd.header(i.Request.Header)
+	i.Response.Header = rd.header(i.Response.Header)
+	i.Request.URL = rd.url(i.Request.URL)
+	i.Request.Body = rd.body(i.Request.Body)
+	i.Response.Body = rd.body(i.Response.Body)
+	for _, fn := range rd.funcs {
+		fn(i)
+	}
+}
+
+func (rd *redaction) header(h http.Header) http.Header {
+	for _, name := range rd.headers {
+		if vs := h.Values(name); len(vs) > 0 {
+			h.Del(name)
+			for range vs {
+				h.Add(name, Redacted)
+			}
+		}
+	}
+	return h
+}
+
+func (rd *redaction) url(s string) string {
+	if len(rd.query) == 0 {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	q := u.Query()
+	changed := false
+	for _, name := range rd.query {
+		if vs, ok := q[name]; ok {
+			q[name] = slices.Repeat([]string{Redacted}, len(vs))
+			changed = true
+		}
+	}
+	if !changed {
+		return s
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (rd *redaction) body(b Body) Body {
+	for _, r := range rd.bodies {
+		b = r.re.ReplaceAll(b, []byte(r.replacement))
+	}
+	return b
+}
@@ -0,0 +1,489 @@
+package vcr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply        = strerr.Error("failed to apply Opt")
+	ErrMissingCassette = strerr.Error("missing cassette path")
+	ErrInvalidMode     = strerr.Error("invalid mode")
+	ErrBadUpstream     = strerr.Error("bad upstream URL")
+	ErrLoadCassette    = strerr.Error("failed to load cassette")
+	ErrSaveCassette    = strerr.Error("failed to save cassette")
+	ErrNoMatch         = strerr.Error("no matching interaction")
+)
+
+// ModeEnv is the environment variable which can be used to set the default mode, for example TSTR_VCR_MODE=record.
+const ModeEnv = "TSTR_VCR_MODE"
+
+// Mode controls whether the interactions are recorded or replayed.
+type Mode string
+
+const (
+	// ModeReplay serves the responses from the cassette and never contacts the upstream.
+	ModeReplay Mode = "replay"
+	// ModeRecord forwards all requests to the upstream and overwrites the cassette on Stop.
+	ModeRecord Mode = "record"
+	// ModeAuto records if the cassette file doesn't exist and replays otherwise.
+	ModeAuto Mode = "auto"
+)
+
+// Recorder is an HTTP proxy which records interactions into a cassette file and replays them.
+// With WithUpstream it's a reverse proxy for a single upstream, otherwise it's a forward proxy
+// which can be used with HTTP_PROXY. Forward proxying supports plain HTTP only,
+// use WithUpstream for HTTPS upstreams.
+type Recorder struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+	path       string
+	mode       Mode
+	upstream   string
+	target     *url.URL
+	outputs    expand.Values
+	matchers   []Matcher
+	redaction  redaction
+	transport  http.RoundTripper
+	recording  bool
+
+	mu        sync.Mutex
+	cassette  *Cassette
+	used      []bool
+	unmatched []Request
+}
+
+type Opt func(*Recorder) error
+
+// New creates new Recorder dependency.
+// The mode defaults to the value of ModeEnv or ModeReplay, and requests are matched with MatchMethod and MatchURL.
+func New(opts ...Opt) *Recorder {
+	return &Recorder{opts: opts}
+}
+
+func (v *Recorder) Start() error {
+	if err := v.apply(); err != nil {
+		return err
+	}
+	if err := v.load(); err != nil {
+		return err
+	}
+	if err := v.resolveUpstream(); err != nil {
+		return err
+	}
+
+	v.server = httpserver.New(append(slices.Clone(v.serverOpts), httpserver.WithHandler(http.HandlerFunc(v.serveHTTP)))...)
+	return v.server.Start()
+}
+
+func (v *Recorder) Ready() error { return nil }
+
+// Stop stops the proxy and saves the cassette if the interactions were recorded.
+func (v *Recorder) Stop() error {
+	if v.server == nil {
+		return nil
+	}
+	err := v.server.Stop()
+	if v.recording {
+		v.mu.Lock()
+		saveErr := v.cassette.save(v.path)
+		v.mu.Unlock()
+		if saveErr != nil {
+			err = errors.Join(err, fmt.Errorf("%w: %w", ErrSaveCassette, saveErr))
+		}
+	}
+	return err
+}
+
+// Name returns the name set with WithName or "vcr".
+func (v *Recorder) Name() string {
+	if v.name != "" {
+		return v.name
+	}
+	return "vcr"
+}
+
+// Outputs returns the outputs of the underlying server, for example {{.vcr.URL}}.
+func (v *Recorder) Outputs() map[string]string {
+	if v.server == nil {
+		return nil
+	}
+	return v.server.Outputs()
+}
+
+// SetOutputs sets the outputs of other dependencies used to resolve placeholders in the upstream URL.
+func (v *Recorder) SetOutputs(outputs map[string]map[string]string) {
+	if v.outputs == nil {
+		v.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(v.outputs, outputs)
+}
+
+// URL returns the base URL of the proxy or an empty string if the proxy hasn't been started.
+func (v *Recorder) URL() string {
+	if v.server == nil {
+		return ""
+	}
+	return v.server.URL()
+}
+
+// Recording reports whether the interactions are recorded instead of replayed.
+func (v *Recorder) Recording() bool {
+	return v.recording
+}
+
+// Interactions returns the interactions in the cassette, including the ones recorded so far.
+func (v *Recorder) Interactions() []Interaction {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return slices.Clone(v.cassette.Interactions)
+}
+
+// Unmatched returns the requests which didn't match any interaction in replay mode.
+func (v *Recorder) Unmatched() []Request {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return slices.Clone(v.unmatched)
+}
+
+// apply resets the Recorder to the defaults and applies the options.
+func (v *Recorder) apply() error {
+	v.serverOpts, v.path, v.upstream, v.target, v.transport = nil, "", "", nil, nil
+	v.mode = Mode(os.Getenv(ModeEnv))
+	if v.mode == "" {
+		v.mode = ModeReplay
+	}
+	v.matchers = []Matcher{MatchMethod, MatchURL}
+	v.redaction = redaction{}
+	for _, opt := range v.opts {
+		if err := opt(v); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	if v.path == "" {
+		return ErrMissingCassette
+	}
+	if v.transport == nil {
+		v.transport = defaultTransport()
+	}
+	return nil
+}
+
+// resolveUpstream expands the upstream URL set with WithUpstream.
+func (v *Recorder) resolveUpstream() error {
+	if v.upstream == "" {
+		return nil
+	}
+	upstream, err := expand.String(v.upstream, v.outputs)
+	if err != nil {
+		return err
+	}
+	v.target, err = url.Parse(upstream)
+	if err != nil || v.target.Scheme == "" || v.target.Host == "" {
+		return fmt.Errorf("%w: '%s'", ErrBadUpstream, upstream)
+	}
+	return nil
+}
+
+func (v *Recorder) load() error {
+	switch v.mode {
+	case ModeRecord:
+		v.recording = true
+	case ModeReplay:
+		v.recording = false
+	case ModeAuto:
+		_, err := os.Stat(v.path)
+		v.recording = errors.Is(err, fs.ErrNotExist)
+	default:
+		return fmt.Errorf("%w: '%s'", ErrInvalidMode, v.mode)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.unmatched = nil
+	if v.recording {
+		v.cassette, v.used = &Cassette{}, nil
+		return nil
+	}
+	c, err := loadCassette(v.path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLoadCassette, err)
+	}
+	v.cassette, v.used = c, make([]bool, len(c.Interactions))
+	return nil
+}
+
+func (v *Recorder) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		http.Error(w, "CONNECT is not supported, use WithUpstream for HTTPS upstreams", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, err := v.targetURL(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := Request{Method: r.Method, URL: u.String(), Header: cleanHeader(r.Header), Body: body}
+	if v.recording {
+		v.record(w, r, req)
+		return
+	}
+	v.replay(w, req)
+}
+
+// targetURL returns the upstream URL of the request.
+func (v *Recorder) targetURL(r *http.Request) (*url.URL, error) {
+	if v.target == nil {
+		if !r.URL.IsAbs() {
+			return nil, errors.New("request is not a proxy request and no upstream is set")
+		}
+		return r.URL, nil
+	}
+	u := *v.target
+	u.Path = strings.TrimSuffix(u.Path, "/") + r.URL.Path
+	u.RawPath = ""
+	u.RawQuery = r.URL.RawQuery
+	return &u, nil
+}
+
+func (v *Recorder) record(w http.ResponseWriter, r *http.Request, req Request) {
+	out, err := http.NewRequestWithContext(r.Context(), req.Method, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	out.Header = req.Header.Clone()
+
+	resp, err := v.transport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err := errors.Join(err, resp.Body.Close()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	i := Interaction{
+		Recorded: time.Now().UTC(),
+		Request:  req,
+		Response: Response{Status: resp.StatusCode, Header: cleanHeader(resp.Header), Body: body},
+	}
+	writeResponse(w, i.Response)
+
+	v.redaction.apply(&i)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.cassette.Interactions = append(v.cassette.Interactions, i)
+}
+
+// replay responds with the first unused matching interaction,
+// or with the last matching one if all of them have been used already.
+func (v *Recorder) replay(w http.ResponseWriter, req Request) {
+	i := Interaction{Request: req}
+	v.redaction.apply(&i)
+
+	v.mu.Lock()
+	match := -1
+	for n, recorded := range v.cassette.Interactions {
+		if !v.matches(i.Request, recorded.Request) {
+			continue
+		}
+		match = n
+		if !v.used[n] {
+			break
+		}
+	}
+	if match < 0 {
+		v.unmatched = append(v.unmatched, i.Request)
+		v.mu.Unlock()
+		http.Error(w, fmt.Sprintf("%s: %s %s", ErrNoMatch, req.Method, req.URL), http.StatusBadGateway)
+		return
+	}
+	v.used[match] = true
+	resp := v.cassette.Interactions[match].Response
+	v.mu.Unlock()
+
+	writeResponse(w, resp)
+}
+
+func (v *Recorder) matches(r, recorded Request) bool {
+	for _, m := range v.matchers {
+		if !m(r, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeResponse(w http.ResponseWriter, resp Response) {
+	for k, vs := range resp.Header {
+		// Redaction can change the length of the body.
+		if k == "Content-Length" {
+			continue
+		}
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// hopHeaders are removed from the forwarded requests and responses.
+// Accept-Encoding is removed so that the bodies are decompressed and stay readable in the cassette.
+var hopHeaders = []string{
+	"Accept-Encoding",
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// defaultTransport returns a clone of http.DefaultTransport, or a plain transport if it has been replaced.
+// The proxy is cleared so that the recorded traffic isn't sent through HTTP_PROXY, which could point back to the recorder.
+func defaultTransport() *http.Transport {
+	t, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return &http.Transport{}
+	}
+	t = t.Clone()
+	t.Proxy = nil
+	return t
+}
+
+func cleanHeader(h http.Header) http.Header {
+	h = h.Clone()
+	for _, k := range hopHeaders {
+		h.Del(k)
+	}
+	return h
+}
+
+// WithName sets the name of the recorder which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(v *Recorder) error {
+		v.name = name
+		return nil
+	}
+}
+
+// WithCassette sets the path of the cassette file, which is required.
+func WithCassette(path string) Opt {
+	return func(v *Recorder) error {
+		v.path = path
+		return nil
+	}
+}
+
+// WithMode sets the mode, overriding ModeEnv.
+func WithMode(m Mode) Opt {
+	return func(v *Recorder) error {
+		v.mode = m
+		return nil
+	}
+}
+
+// WithUpstream makes the recorder a reverse proxy for the upstream URL.
+// The URL can contain placeholders, for example {{.api.URL}}.
+func WithUpstream(url string) Opt {
+	return func(v *Recorder) error {
+		v.upstream = url
+		return nil
+	}
+}
+
+// WithMatchers replaces the matchers used to find the recorded interaction for a request in replay mode.
+// A request matches if all matchers match.
+func WithMatchers(m ...Matcher) Opt {
+	return func(v *Recorder) error {
+		v.matchers = m
+		return nil
+	}
+}
+
+// WithRedactHeaders replaces the values of the request and response headers with Redacted.
+func WithRedactHeaders(names ...string) Opt {
+	return func(v *Recorder) error {
+		v.redaction.headers = append(v.redaction.headers, names...)
+		return nil
+	}
+}
+
+// WithRedactQuery replaces the values of the query parameters with Redacted.
+func WithRedactQuery(params ...string) Opt {
+	return func(v *Recorder) error {
+		v.redaction.query = append(v.redaction.query, params...)
+		return nil
+	}
+}
+
+// WithRedactBody replaces the matches of pattern in the request and response bodies with replacement,
+// see regexp.Regexp.ReplaceAll.
+func WithRedactBody(pattern, replacement string) Opt {
+	return func(v *Recorder) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		v.redaction.bodies = append(v.redaction.bodies, bodyRedaction{re: re, replacement: replacement})
+		return nil
+	}
+}
+
+// WithRedactFunc adds a function which modifies the interactions before they are saved.
+// In replay mode the function gets the incoming requests, with an empty response, before they are matched.
+func WithRedactFunc(fn func(*Interaction)) Opt {
+	return func(v *Recorder) error {
+		v.redaction.funcs = append(v.redaction.funcs, fn)
+		return nil
+	}
+}
+
+// WithTransport sets the transport used for the upstream requests, for example to trust a test CA.
+func WithTransport(rt http.RoundTripper) Opt {
+	return func(v *Recorder) error {
+		v.transport = rt
+		return nil
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithPort.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(v *Recorder) error {
+		v.serverOpts = append(v.serverOpts, opts...)
+		return nil
+	}
+}
@@ -0,0 +1,201 @@
+package vcr_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/dep/vcr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecorder_RecordReplay(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "testdata", "api.json")
+	upstream := httpserver.New(
+		httpserver.WithName("api"),
+		httpserver.WithRoute("GET /v1/users", httpserver.Response{Status: http.StatusOK, Body: `[{"name":"alice"}]`}),
+		httpserver.WithRoute("POST /v1/login", httpserver.Response{
+			Status: http.StatusCreated,
+			Header: http.Header{"Set-Cookie": {"session=secret"}},
+			Body:   `{"token":"abc123"}`,
+		}),
+	)
+	deptest.ErrorIs(t, upstream, func() {
+		rec := vcr.New(
+			vcr.WithCassette(cassette),
+			vcr.WithMode(vcr.ModeRecord),
+			vcr.WithUpstream("{{.api.URL}}/v1"),
+			vcr.WithRedactHeaders("Authorization", "Set-Cookie"),
+			vcr.WithRedactQuery("api_key"),
+			vcr.WithRedactBody(`"token":"[^"]*"`, `"token":"`+vcr.Redacted+`"`),
+		)
+		rec.SetOutputs(map[string]map[string]string{"api": upstream.Outputs()})
+		deptest.ErrorIs(t, rec, func() {
+			assert.True(t, rec.Recording())
+			body := get(t, rec.URL()+"/users?api_key=k&page=1", http.StatusOK)
+			assert.JSONEq(t, `[{"name":"alice"}]`, body)
+
+			resp, err := http.Post(rec.URL()+"/login", "application/json", strings.NewReader(`{"user":"alice"}`))
+			require.NoError(t, err)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			assert.Equal(t, `{"token":"abc123"}`, string(b))
+			assert.Equal(t, "session=secret", resp.Header.Get("Set-Cookie"))
+
+			require.Len(t, upstream.Requests(), 2)
+			assert.Equal(t, "/v1/users", upstream.Requests()[0].URL.Path)
+		}, nil)
+
+		b, err := os.ReadFile(cassette)
+		require.NoError(t, err)
+		assert.NotContains(t, string(b), "abc123")
+		assert.NotContains(t, string(b), "session=secret")
+		assert.NotContains(t, string(b), "api_key=k")
+
+		rec = vcr.New(vcr.WithCassette(cassette), vcr.WithUpstream(upstream.URL()+"/v1"), vcr.WithRedactQuery("api_key"))
+		deptest.ErrorIs(t, rec, func() {
+			assert.False(t, rec.Recording())
+			assert.Len(t, rec.Interactions(), 2)
+			assert.JSONEq(t, `[{"name":"alice"}]`, get(t, rec.URL()+"/users?page=1&api_key=other", http.StatusOK))
+			assert.JSONEq(t, `[{"name":"alice"}]`, get(t, rec.URL()+"/users?page=1&api_key=other", http.StatusOK))
+
+			resp, err := http.Post(rec.URL()+"/login", "application/json", nil)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			assert.Equal(t, vcr.Redacted, resp.Header.Get("Set-Cookie"))
+
+			assert.Contains(t, get(t, rec.URL()+"/users?page=2", http.StatusBadGateway), vcr.ErrNoMatch.Error())
+			unmatched := rec.Unmatched()
+			require.Len(t, unmatched, 1)
+			assert.Equal(t, upstream.URL()+"/v1/users?page=2", unmatched[0].URL)
+			assert.Len(t, upstream.Requests(), 2)
+		}, nil)
+	}, nil)
+}
+
+func TestRecorder_Sequence(t *testing.T) {
+	cassette := writeCassette(t, vcr.Cassette{Interactions: []vcr.Interaction{
+		interaction("POST", "http://api.test/jobs", `{"a":1,"b":2}`, "first"),
+		interaction("POST", "http://api.test/jobs", `{"a":1,"b":2}`, "second"),
+		interaction("POST", "http://api.test/jobs", `{"a":2}`, "other"),
+	}})
+	rec := vcr.New(
+		vcr.WithCassette(cassette),
+		vcr.WithMatchers(vcr.MatchMethod, vcr.MatchURL, vcr.MatchJSONBody),
+	)
+	deptest.ErrorIs(t, rec, func() {
+		client := proxyClient(t, rec.URL())
+		for _, tc := range []struct{ body, want string }{
+			{`{"b":2,"a":1}`, "first"},
+			{`{"a":2}`, "other"},
+			{`{"a":1,"b":2}`, "second"},
+			{`{"a":1,"b":2}`, "second"},
+		} {
+			resp, err := client.Post("http://api.test/jobs", "application/json", strings.NewReader(tc.body))
+			require.NoError(t, err)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tc.want, string(b))
+		}
+	}, nil)
+}
+
+func TestRecorder_ForwardProxy(t *testing.T) {
+	cassette := filepath.Join(t.TempDir(), "forward.json")
+	upstream := httpserver.New(httpserver.WithRoute("GET /bin", httpserver.Response{Status: http.StatusOK, Body: "\xff\x00\x01"}))
+	deptest.ErrorIs(t, upstream, func() {
+		rec := vcr.New(vcr.WithCassette(cassette), vcr.WithMode(vcr.ModeAuto))
+		deptest.ErrorIs(t, rec, func() {
+			assert.True(t, rec.Recording())
+			resp, err := proxyClient(t, rec.URL()).Get(upstream.URL() + "/bin")
+			require.NoError(t, err)
+			b, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, []byte("\xff\x00\x01"), b)
+
+			assert.Contains(t, get(t, rec.URL()+"/bin", http.StatusBadRequest), "not a proxy request")
+		}, nil)
+
+		rec = vcr.New(vcr.WithCassette(cassette), vcr.WithMode(vcr.ModeAuto))
+		deptest.ErrorIs(t, rec, func() {
+			assert.False(t, rec.Recording())
+			require.Len(t, rec.Interactions(), 1)
+			assert.Equal(t, vcr.Body("\xff\x00\x01"), rec.Interactions()[0].Response.Body)
+		}, nil)
+	}, nil)
+}
+
+func TestRecorder_Errors(t *testing.T) {
+	missing := vcr.New()
+	deptest.ErrorIs(t, missing, nil, vcr.ErrMissingCassette)
+	assert.Empty(t, missing.URL())
+	deptest.ErrorIs(t, vcr.New(vcr.WithCassette(filepath.Join(t.TempDir(), "missing.json"))), nil, vcr.ErrLoadCassette)
+	deptest.ErrorIs(t, vcr.New(vcr.WithCassette("c.json"), vcr.WithMode("rewind")), nil, vcr.ErrInvalidMode)
+	deptest.ErrorIs(t, vcr.New(vcr.WithCassette("c.json"), vcr.WithRedactBody("(", "")), nil, vcr.ErrOptApply)
+	deptest.ErrorIs(t, vcr.New(vcr.WithCassette("c.json"), vcr.WithMode(vcr.ModeRecord), vcr.WithUpstream("localhost")), nil, vcr.ErrBadUpstream)
+
+	t.Setenv(vcr.ModeEnv, "record")
+	rec := vcr.New(vcr.WithCassette(filepath.Join(t.TempDir(), "env.json")))
+	deptest.ErrorIs(t, rec, func() {
+		assert.True(t, rec.Recording())
+	}, nil)
+}
+
+func TestBody_JSON(t *testing.T) {
+	for _, b := range []vcr.Body{vcr.Body("text"), vcr.Body("\xff\xfe")} {
+		data, err := json.Marshal(b)
+		require.NoError(t, err)
+		var got vcr.Body
+		require.NoError(t, json.Unmarshal(data, &got))
+		assert.Equal(t, b, got)
+	}
+}
+
+func interaction(method, u, reqBody, respBody string) vcr.Interaction {
+	return vcr.Interaction{
+		Request:  vcr.Request{Method: method, URL: u, Body: vcr.Body(reqBody)},
+		Response: vcr.Response{Status: http.StatusOK, Body: vcr.Body(respBody)},
+	}
+}
+
+func writeCassette(t *testing.T, c vcr.Cassette) string {
+	t.Helper()
+	b, err := json.Marshal(c)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	require.NoError(t, os.WriteFile(path, b, 0o600))
+	return path
+}
+
+func proxyClient(t *testing.T, proxy string) *http.Client {
+	t.Helper()
+	u, err := url.Parse(proxy)
+	require.NoError(t, err)
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(u)}}
+}
+
+func get(t *testing.T, u string, status int) string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, u, nil)
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, status, resp.StatusCode)
+	return string(b)
+}
@@ -0,0 +1,327 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/httpserver"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply = strerr.Error("failed to apply Opt")
+	ErrTimeout  = strerr.Error("no matching delivery received")
+)
+
+// Sink receives webhooks on any path and stores the deliveries.
+// It responds with 200 OK unless told to fail or delay the responses.
+type Sink struct {
+	opts       []Opt
+	name       string
+	serverOpts []httpserver.Opt
+	server     *httpserver.Server
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	notify     chan struct{}
+	status     int
+	delay      time.Duration
+	failNext   []int
+}
+
+// Delivery is a received webhook.
+type Delivery struct {
+	Received time.Time   `json:"received"`
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Query    string      `json:"query,omitempty"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	// Status is the status code the sink responded with, or 0 if the delivery was canceled.
+	Status int `json:"status"`
+	// Canceled is set if the sender gave up, for example timed out, before the delayed response was written.
+	// A canceled delivery doesn't use up a failure set with FailNext.
+	Canceled bool `json:"canceled,omitempty"`
+}
+
+// Predicate selects deliveries, see Sink.WaitFor.
+type Predicate func(Delivery) bool
+
+type Opt func(*Sink) error
+
+// New creates new Sink dependency.
+func New(opts ...Opt) *Sink {
+	return &Sink{opts: opts}
+}
+
+func (s *Sink) Start() error {
+	s.serverOpts, s.deliveries, s.notify = nil, nil, make(chan struct{})
+	s.status, s.delay, s.failNext = http.StatusOK, 0, nil
+	for _, opt := range s.opts {
+		if err := opt(s); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	s.server = httpserver.New(append(slices.Clone(s.serverOpts), httpserver.WithHandler(http.HandlerFunc(s.serveHTTP)))...)
+	return s.server.Start()
+}
+
+func (s *Sink) Ready() error { return nil }
+
+func (s *Sink) Stop() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Stop()
+}
+
+// Name returns the name set with WithName or "webhook".
+func (s *Sink) Name() string {
+	if s.name != "" {
+		return s.name
+	}
+	return "webhook"
+}
+
+// Outputs returns the outputs of the underlying server, for example {{.webhook.URL}}.
+func (s *Sink) Outputs() map[string]string {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Outputs()
+}
+
+// URL returns the base URL of the sink or an empty string if the sink hasn't been started.
+// Webhooks can be sent to any path under it.
+func (s *Sink) URL() string {
+	if s.server == nil {
+		return ""
+	}
+	return s.server.URL()
+}
+
+// Deliveries returns the received deliveries in the order they were received.
+func (s *Sink) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.deliveries)
+}
+
+// Reset removes the received deliveries and the faults.
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = nil
+	s.status, s.delay, s.failNext = http.StatusOK, 0, nil
+}
+
+// SetStatus sets the status code of all following responses.
+func (s *Sink) SetStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// FailNext responds to the next n deliveries with status, after which the normal status is used again.
+func (s *Sink) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for range n {
+		s.failNext = append(s.failNext, status)
+	}
+}
+
+// SetDelay delays all following responses by d.
+func (s *Sink) SetDelay(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delay = d
+}
+
+// WaitFor waits until a delivery matching all predicates is received and returns it.
+// Deliveries received before the call are also considered.
+func (s *Sink) WaitFor(ctx context.Context, predicates ...Predicate) (Delivery, error) {
+	ds, err := s.WaitForN(ctx, 1, predicates...)
+	if err != nil {
+		return Delivery{}, err
+	}
+	return ds[0], nil
+}
+
+// WaitForN waits until n deliveries matching all predicates are received and returns them.
+// On timeout the error lists the received deliveries.
+func (s *Sink) WaitForN(ctx context.Context, n int, predicates ...Predicate) ([]Delivery, error) {
+	for {
+		s.mu.Lock()
+		notify := s.notify
+		var matched []Delivery
+		for _, d := range s.deliveries {
+			if d.match(predicates) {
+				matched = append(matched, d)
+			}
+		}
+		all := slices.Clone(s.deliveries)
+		s.mu.Unlock()
+
+		if len(matched) >= n {
+			return matched[:n], nil
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, timeoutErr(ctx, n, len(matched), all)
+		}
+	}
+}
+
+// CollectArtifacts writes the deliveries into deliveries.json.
+func (s *Sink) CollectArtifacts(dir string) error {
+	b, err := json.MarshalIndent(s.Deliveries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "deliveries.json"), b, 0o600)
+}
+
+func (s *Sink) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d := Delivery{
+		Received: time.Now(),
+		Method:   r.Method,
+		Path:     r.URL.Path,
+		Query:    r.URL.RawQuery,
+		Header:   r.Header.Clone(),
+		Body:     body,
+	}
+
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			d.Canceled = true
+			s.add(d)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	d.Status = s.status
+	if len(s.failNext) > 0 {
+		d.Status, s.failNext = s.failNext[0], s.failNext[1:]
+	}
+	s.mu.Unlock()
+	s.add(d)
+	w.WriteHeader(d.Status)
+}
+
+func (s *Sink) add(d Delivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = append(s.deliveries, d)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (d Delivery) String() string {
+	if d.Canceled {
+		return fmt.Sprintf("%s %s (canceled, %d bytes)", d.Method, d.Path, len(d.Body))
+	}
+	return fmt.Sprintf("%s %s (%d, %d bytes)", d.Method, d.Path, d.Status, len(d.Body))
+}
+
+func (d Delivery) match(predicates []Predicate) bool {
+	for _, p := range predicates {
+		if !p(d) {
+			return false
+		}
+	}
+	return true
+}
+
+func timeoutErr(ctx context.Context, n, matched int, all []Delivery) error {
+	received := "none"
+	if len(all) > 0 {
+		ss := make([]string, 0, len(all))
+		for _, d := range all {
+			ss = append(ss, d.String())
+		}
+		received = strings.Join(ss, ", ")
+	}
+	return fmt.Errorf("%w: %w: expected %d, matched %d, received: %s", ErrTimeout, context.Cause(ctx), n, matched, received)
+}
+
+// Path selects deliveries to path.
+func Path(path string) Predicate {
+	return func(d Delivery) bool { return d.Path == path }
+}
+
+// Method selects deliveries with method.
+func Method(method string) Predicate {
+	return func(d Delivery) bool { return strings.EqualFold(d.Method, method) }
+}
+
+// Header selects deliveries with header key set to value.
+func Header(key, value string) Predicate {
+	return func(d Delivery) bool { return d.Header.Get(key) == value }
+}
+
+// BodyContains selects deliveries with body containing s.
+func BodyContains(s string) Predicate {
+	return func(d Delivery) bool { return strings.Contains(string(d.Body), s) }
+}
+
+// Succeeded selects deliveries which were responded with 2xx status.
+func Succeeded() Predicate {
+	return func(d Delivery) bool { return d.Status >= 200 && d.Status < 300 }
+}
+
+// WithName sets the name of the sink which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(s *Sink) error {
+		s.name = name
+		return nil
+	}
+}
+
+// WithStatus sets the initial status code of the responses, see SetStatus.
+func WithStatus(status int) Opt {
+	return func(s *Sink) error {
+		s.status = status
+		return nil
+	}
+}
+
+// WithDelay sets the initial delay of the responses, see SetDelay.
+func WithDelay(d time.Duration) Opt {
+	return func(s *Sink) error {
+		s.delay = d
+		return nil
+	}
+}
+
+// WithServerOpts sets the options of the underlying httpserver.Server, for example httpserver.WithTLS.
+func WithServerOpts(opts ...httpserver.Opt) Opt {
+	return func(s *Sink) error {
+		s.serverOpts = append(s.serverOpts, opts...)
+		return nil
+	}
+}
@@ -0,0 +1,139 @@
+package webhook_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSink(t *testing.T) {
+	s := webhook.New(webhook.WithName("hooks"))
+	assert.Empty(t, s.URL())
+	deptest.ErrorIs(t, s, func() {
+		type result struct {
+			status int
+			err    error
+		}
+		done := make(chan result)
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			status, err := post(t.Context(), s.URL()+"/orders?id=1", `{"event":"created"}`)
+			done <- result{status: status, err: err}
+		}()
+		defer func() {
+			r := <-done
+			require.NoError(t, r.err)
+			assert.Equal(t, http.StatusOK, r.status)
+		}()
+
+		ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+		defer cancel()
+		d, err := s.WaitFor(ctx, webhook.Path("/orders"), webhook.Method("POST"), webhook.Header("X-Signature", "sig"), webhook.BodyContains("created"))
+		require.NoError(t, err)
+		assert.Equal(t, "id=1", d.Query)
+		assert.Equal(t, `{"event":"created"}`, string(d.Body))
+		assert.Equal(t, http.StatusOK, d.Status)
+		assert.Equal(t, s.URL(), s.Outputs()["URL"])
+
+		dir := t.TempDir()
+		require.NoError(t, s.CollectArtifacts(dir))
+		assert.FileExists(t, filepath.Join(dir, "deliveries.json"))
+	}, nil)
+}
+
+func TestSink_Retries(t *testing.T) {
+	s := webhook.New()
+	deptest.ErrorIs(t, s, func() {
+		s.FailNext(2, http.StatusServiceUnavailable)
+		assert.Equal(t, http.StatusServiceUnavailable, send(t, s.URL()+"/a", "1"))
+		assert.Equal(t, http.StatusServiceUnavailable, send(t, s.URL()+"/a", "2"))
+		assert.Equal(t, http.StatusOK, send(t, s.URL()+"/a", "3"))
+
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		ds, err := s.WaitForN(ctx, 3, webhook.Path("/a"))
+		require.NoError(t, err)
+		assert.Len(t, ds, 3)
+		d, err := s.WaitFor(ctx, webhook.Succeeded())
+		require.NoError(t, err)
+		assert.Equal(t, "3", string(d.Body))
+
+		s.SetStatus(http.StatusInternalServerError)
+		assert.Equal(t, http.StatusInternalServerError, send(t, s.URL()+"/a", "4"))
+
+		s.Reset()
+		s.SetDelay(100 * time.Millisecond)
+		start := time.Now()
+		assert.Equal(t, http.StatusOK, send(t, s.URL()+"/a", "5"))
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		assert.Len(t, s.Deliveries(), 1)
+	}, nil)
+}
+
+func TestSink_SenderTimeout(t *testing.T) {
+	s := webhook.New()
+	deptest.ErrorIs(t, s, func() {
+		s.FailNext(1, http.StatusServiceUnavailable)
+		s.SetDelay(time.Second)
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err := post(ctx, s.URL()+"/a", "1")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		ctx, cancel = context.WithTimeout(t.Context(), time.Second)
+		defer cancel()
+		d, err := s.WaitFor(ctx, webhook.Path("/a"))
+		require.NoError(t, err)
+		assert.True(t, d.Canceled)
+		assert.Equal(t, 0, d.Status)
+		assert.Equal(t, "POST /a (canceled, 1 bytes)", d.String())
+
+		s.SetDelay(0)
+		assert.Equal(t, http.StatusServiceUnavailable, send(t, s.URL()+"/a", "2"))
+		assert.Equal(t, http.StatusOK, send(t, s.URL()+"/a", "3"))
+		assert.Len(t, s.Deliveries(), 3)
+	}, nil)
+}
+
+func TestSink_Timeout(t *testing.T) {
+	s := webhook.New(webhook.WithStatus(http.StatusAccepted))
+	deptest.ErrorIs(t, s, func() {
+		assert.Equal(t, http.StatusAccepted, send(t, s.URL()+"/other", "body"))
+
+		ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+		defer cancel()
+		_, err := s.WaitFor(ctx, webhook.Path("/orders"))
+		require.ErrorIs(t, err, webhook.ErrTimeout)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.EqualError(t, err, "no matching delivery received: context deadline exceeded: expected 1, matched 0, received: POST /other (202, 4 bytes)")
+	}, nil)
+}
+
+func send(t *testing.T, url, body string) int {
+	t.Helper()
+	status, err := post(t.Context(), url, body)
+	require.NoError(t, err)
+	return status
+}
+
+// post delivers a signed webhook and returns the response status, it's safe to call from other goroutines.
+func post(ctx context.Context, url, body string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("X-Signature", "sig")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	return resp.StatusCode, resp.Body.Close()
+}
@@ -0,0 +1,57 @@
+package workspace
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Compare compares the regular files in dir against the golden directory.
+// The returned error wraps ErrMismatch and lists the missing, unexpected and differing files.
+// File permissions are not compared.
+func Compare(golden, dir string) error {
+	want, err := readTree(golden)
+	if err != nil {
+		return err
+	}
+	got, err := readTree(dir)
+	if err != nil {
+		return err
+	}
+
+	var diffs []string
+	for _, name := range slices.Sorted(maps.Keys(want)) {
+		b, ok := got[name]
+		switch {
+		case !ok:
+			diffs = append(diffs, "missing "+name)
+		case !bytes.Equal(want[name], b):
+			diffs = append(diffs, "differs "+name)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(got)) {
+		if _, ok := want[name]; !ok {
+			diffs = append(diffs, "unexpected "+name)
+		}
+	}
+
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %s", ErrMismatch, strings.Join(diffs, ", "))
+	}
+	return nil
+}
+
+func readTree(dir string) (map[string][]byte, error) {
+	fsys := os.DirFS(dir)
+	files := map[string][]byte{}
+	err := walkFiles(fsys, ".", func(p, name string, _ fs.FileInfo) error {
+		b, err := fs.ReadFile(fsys, p)
+		files[name] = b
+		return err
+	})
+	return files, err
+}
@@ -0,0 +1,389 @@
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/go-tstr/tstr/expand"
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrOptApply = strerr.Error("failed to apply Opt")
+	ErrCreate   = strerr.Error("failed to create workspace")
+	ErrFixture  = strerr.Error("failed to populate workspace")
+	ErrRender   = strerr.Error("failed to render template")
+	ErrSnapshot = strerr.Error("failed to snapshot workspace")
+	ErrRemove   = strerr.Error("failed to remove workspace")
+	ErrMismatch = strerr.Error("directory trees differ")
+)
+
+// TemplateSuffix is removed from the names of rendered template files.
+const TemplateSuffix = ".tmpl"
+
+// Workspace is a temporary directory populated from fixtures before the dependencies after it are started.
+type Workspace struct {
+	opts     []Opt
+	name     string
+	dir      string
+	fixtures []fixture
+	modes    []mode
+	data     any
+	funcs    template.FuncMap
+	snapshot string
+	outputs  expand.Values
+}
+
+type fixture struct {
+	fsys   fs.FS
+	root   string
+	dst    string
+	render bool
+	file   *file
+}
+
+type file struct {
+	content []byte
+	mode    fs.FileMode
+}
+
+type mode struct {
+	pattern string
+	mode    fs.FileMode
+}
+
+type Opt func(*Workspace) error
+
+// New creates new Workspace dependency.
+func New(opts ...Opt) *Workspace {
+	return &Workspace{opts: opts}
+}
+
+// Start creates the temporary directory and populates it with the fixtures in the order they were given.
+func (w *Workspace) Start() error {
+	for _, opt := range w.opts {
+		if err := opt(w); err != nil {
+			return fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "tstr-workspace-*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrCreate, err)
+	}
+	w.dir = dir
+
+	if err := w.populate(); err != nil {
+		w.dir = ""
+		return errors.Join(fmt.Errorf("%w: %w", ErrFixture, err), os.RemoveAll(dir))
+	}
+	return nil
+}
+
+func (w *Workspace) Ready() error { return nil }
+
+// Stop snapshots the workspace if WithSnapshot was used and removes it.
+func (w *Workspace) Stop() error {
+	if w.dir == "" {
+		return nil
+	}
+
+	var err error
+	if w.snapshot != "" {
+		e := os.RemoveAll(w.snapshot)
+		if e == nil {
+			e = copyTree(os.DirFS(w.dir), ".", w.snapshot)
+		}
+		if e != nil {
+			err = fmt.Errorf("%w: %w", ErrSnapshot, e)
+		}
+	}
+
+	if e := os.RemoveAll(w.dir); e != nil {
+		err = errors.Join(err, fmt.Errorf("%w: %w", ErrRemove, e))
+	}
+	w.dir = ""
+	return err
+}
+
+// Dir returns the path of the workspace or an empty string if it's not started.
+func (w *Workspace) Dir() string {
+	return w.dir
+}
+
+// Path returns the path of elem inside the workspace.
+func (w *Workspace) Path(elem ...string) string {
+	return filepath.Join(append([]string{w.dir}, elem...)...)
+}
+
+// Name returns the name set with WithName or "workspace".
+func (w *Workspace) Name() string {
+	if w.name != "" {
+		return w.name
+	}
+	return "workspace"
+}
+
+// Outputs returns the path of the workspace as Dir, for example {{.workspace.Dir}}.
+func (w *Workspace) Outputs() map[string]string {
+	if w.dir == "" {
+		return nil
+	}
+	return map[string]string{"Dir": w.dir}
+}
+
+// SetOutputs sets the outputs of other dependencies which are used as template data unless WithData is used.
+func (w *Workspace) SetOutputs(outputs map[string]map[string]string) {
+	if w.outputs == nil {
+		w.outputs = make(expand.Values, len(outputs))
+	}
+	maps.Copy(w.outputs, outputs)
+}
+
+// CollectArtifacts copies the contents of the workspace into dir.
+func (w *Workspace) CollectArtifacts(dir string) error {
+	if w.dir == "" {
+		return nil
+	}
+	return copyTree(os.DirFS(w.dir), ".", dir)
+}
+
+func (w *Workspace) populate() error {
+	for _, f := range w.fixtures {
+		if err := w.add(f); err != nil {
+			return err
+		}
+	}
+	return w.chmod()
+}
+
+func (w *Workspace) add(f fixture) error {
+	dst := filepath.Join(w.dir, filepath.FromSlash(f.dst))
+	if f.file != nil {
+		if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+			return err
+		}
+		return os.WriteFile(dst, f.file.content, f.file.mode)
+	}
+
+	if !f.render {
+		return copyTree(f.fsys, f.root, dst)
+	}
+
+	return walkFiles(f.fsys, f.root, func(p, name string, info fs.FileInfo) error {
+		b, err := fs.ReadFile(f.fsys, p)
+		if err != nil {
+			return err
+		}
+
+		b, err = w.render(name, b)
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(strings.TrimSuffix(name, TemplateSuffix)))
+		if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return err
+		}
+		return os.WriteFile(target, b, info.Mode().Perm())
+	})
+}
+
+func (w *Workspace) render(name string, b []byte) ([]byte, error) {
+	tmpl, err := template.New(name).Funcs(w.funcs).Option("missingkey=error").Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+
+	var data any = w.outputs
+	if w.data != nil {
+		data = w.data
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrRender, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (w *Workspace) chmod() error {
+	if len(w.modes) == 0 {
+		return nil
+	}
+
+	return filepath.WalkDir(w.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == w.dir {
+			return err
+		}
+
+		rel, err := filepath.Rel(w.dir, p)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range w.modes {
+			if ok, _ := path.Match(m.pattern, filepath.ToSlash(rel)); ok {
+				if err := os.Chmod(p, m.mode); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// walkFiles calls fn for each regular file under root with its path in fsys and its name relative to root.
+// If root is a file fn is called once with its base name.
+func walkFiles(fsys fs.FS, root string, fn func(p, name string, info fs.FileInfo) error) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		name := path.Base(p)
+		switch {
+		case root == ".":
+			name = p
+		case p != root:
+			name = strings.TrimPrefix(p, root+"/")
+		}
+		return fn(p, name, info)
+	})
+}
+
+// copyTree copies the regular files under root in fsys into dst preserving their permissions.
+func copyTree(fsys fs.FS, root, dst string) error {
+	if err := os.MkdirAll(dst, 0o750); err != nil {
+		return err
+	}
+
+	return walkFiles(fsys, root, func(p, name string, info fs.FileInfo) error {
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return err
+		}
+
+		src, err := fsys.Open(p)
+		if err != nil {
+			return err
+		}
+
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return errors.Join(err, src.Close())
+		}
+		_, err = io.Copy(out, src)
+		return errors.Join(err, out.Close(), src.Close())
+	})
+}
+
+// WithName sets the name of the workspace which is used for its outputs, see Outputs.
+func WithName(name string) Opt {
+	return func(w *Workspace) error {
+		w.name = name
+		return nil
+	}
+}
+
+// WithCopy copies src into dst directory inside the workspace.
+// If src is a directory its contents are copied, otherwise the file is copied keeping its base name.
+// File permissions are preserved.
+func WithCopy(src, dst string) Opt {
+	return func(w *Workspace) error {
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			w.fixtures = append(w.fixtures, fixture{fsys: os.DirFS(src), root: ".", dst: dst})
+			return nil
+		}
+		w.fixtures = append(w.fixtures, fixture{fsys: os.DirFS(filepath.Dir(src)), root: filepath.Base(src), dst: dst})
+		return nil
+	}
+}
+
+// WithCopyFS copies root from fsys into dst directory inside the workspace, see WithCopy.
+func WithCopyFS(fsys fs.FS, root, dst string) Opt {
+	return func(w *Workspace) error {
+		w.fixtures = append(w.fixtures, fixture{fsys: fsys, root: root, dst: dst})
+		return nil
+	}
+}
+
+// WithTemplates renders the files under root in fsys as Go templates into dst directory inside the workspace.
+// The TemplateSuffix is removed from the file names and file permissions are preserved.
+// Templates are executed with the data set with WithData or with the outputs of other dependencies,
+// for example {{.postgres.Port}}. Missing keys are reported as errors.
+func WithTemplates(fsys fs.FS, root, dst string) Opt {
+	return func(w *Workspace) error {
+		w.fixtures = append(w.fixtures, fixture{fsys: fsys, root: root, dst: dst, render: true})
+		return nil
+	}
+}
+
+// WithFile writes content into name inside the workspace with the given permissions.
+func WithFile(name, content string, perm fs.FileMode) Opt {
+	return func(w *Workspace) error {
+		w.fixtures = append(w.fixtures, fixture{dst: name, file: &file{content: []byte(content), mode: perm}})
+		return nil
+	}
+}
+
+// WithMode sets the permissions of the files and directories matching pattern after the fixtures are in place.
+// The pattern is matched with path.Match against slash separated paths relative to the workspace.
+func WithMode(pattern string, perm fs.FileMode) Opt {
+	return func(w *Workspace) error {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		w.modes = append(w.modes, mode{pattern: pattern, mode: perm})
+		return nil
+	}
+}
+
+// WithData sets the data used for executing templates, see WithTemplates.
+func WithData(data any) Opt {
+	return func(w *Workspace) error {
+		w.data = data
+		return nil
+	}
+}
+
+// WithFuncs adds functions which can be used in templates, see WithTemplates.
+func WithFuncs(funcs template.FuncMap) Opt {
+	return func(w *Workspace) error {
+		if w.funcs == nil {
+			w.funcs = template.FuncMap{}
+		}
+		maps.Copy(w.funcs, funcs)
+		return nil
+	}
+}
+
+// WithSnapshot copies the contents of the workspace into dir when the workspace is stopped,
+// so that it can be compared against a golden directory with Compare. The previous contents of dir are removed.
+func WithSnapshot(dir string) Opt {
+	return func(w *Workspace) error {
+		w.snapshot = dir
+		return nil
+	}
+}
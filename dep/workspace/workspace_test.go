@@ -0,0 +1,173 @@
+package workspace_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/cmd"
+	"github.com/go-tstr/tstr/dep/deptest"
+	"github.com/go-tstr/tstr/dep/workspace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fixtures = fstest.MapFS{
+	"testdata/config.yaml.tmpl": {Data: []byte("port: {{.api.Port}}\nname: {{upper .api.Name}}\n"), Mode: 0o600},
+	"testdata/data/input.txt":   {Data: []byte("input\n"), Mode: 0o644},
+	"testdata/run.sh":           {Data: []byte("#!/bin/sh\n"), Mode: 0o755},
+}
+
+func TestWorkspace(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "b.txt"), []byte("b"), 0o600))
+
+	w := workspace.New(
+		workspace.WithCopy(src, "copy"),
+		workspace.WithCopy(filepath.Join(src, "a.txt"), "single"),
+		workspace.WithCopyFS(fixtures, "testdata/data", "."),
+		workspace.WithCopyFS(fixtures, "testdata/run.sh", "bin"),
+		workspace.WithTemplates(fixtures, "testdata/config.yaml.tmpl", "etc"),
+		workspace.WithFile("nested/empty.txt", "", 0o600),
+		workspace.WithMode("bin/*", 0o700),
+		workspace.WithFuncs(template.FuncMap{"upper": strings.ToUpper}),
+	)
+	w.SetOutputs(map[string]map[string]string{"api": {"Port": "8080", "Name": "api"}})
+
+	var dir string
+	deptest.ErrorIs(t, w, func() {
+		dir = w.Dir()
+		assert.Equal(t, map[string]string{"Dir": dir}, w.Outputs())
+		assertFile(t, w.Path("copy", "a.txt"), "a", 0o600)
+		assertFile(t, w.Path("copy", "sub", "b.txt"), "b", 0o600)
+		assertFile(t, w.Path("single", "a.txt"), "a", 0o600)
+		assertFile(t, w.Path("input.txt"), "input\n", 0o644)
+		assertFile(t, w.Path("bin", "run.sh"), "#!/bin/sh\n", 0o700)
+		assertFile(t, w.Path("etc", "config.yaml"), "port: 8080\nname: API\n", 0o600)
+		assertFile(t, w.Path("nested", "empty.txt"), "", 0o600)
+	}, nil)
+
+	assert.NotEmpty(t, dir)
+	assert.NoDirExists(t, dir)
+	assert.Empty(t, w.Dir())
+}
+
+func TestWorkspace_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []workspace.Opt
+		err  error
+	}{
+		{
+			name: "missing_source",
+			opts: []workspace.Opt{workspace.WithCopy(filepath.Join(t.TempDir(), "missing"), ".")},
+			err:  workspace.ErrOptApply,
+		},
+		{
+			name: "bad_pattern",
+			opts: []workspace.Opt{workspace.WithMode("[", 0o600)},
+			err:  workspace.ErrOptApply,
+		},
+		{
+			name: "missing_key",
+			opts: []workspace.Opt{workspace.WithTemplates(fixtures, "testdata/config.yaml.tmpl", ".")},
+			err:  workspace.ErrRender,
+		},
+		{
+			name: "missing_fixture",
+			opts: []workspace.Opt{workspace.WithCopyFS(fixtures, "testdata/missing", ".")},
+			err:  workspace.ErrFixture,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deptest.ErrorIs(t, workspace.New(tt.opts...), nil, tt.err)
+		})
+	}
+}
+
+func TestWorkspace_WithData(t *testing.T) {
+	w := workspace.New(
+		workspace.WithTemplates(fstest.MapFS{"a.tmpl": {Data: []byte("{{.Value}}")}}, ".", "."),
+		workspace.WithData(struct{ Value string }{Value: "data"}),
+	)
+	deptest.ErrorIs(t, w, func() {
+		assertFile(t, w.Path("a"), "data", 0)
+	}, nil)
+}
+
+func TestWorkspace_Cmd(t *testing.T) {
+	err := tstr.Run(
+		tstr.WithDeps(
+			workspace.New(
+				workspace.WithName("ws"),
+				workspace.WithFile("go.mod", "module example.com/ws\n", 0o600),
+			),
+			cmd.New(
+				cmd.WithCommand("go", "list", "-m"),
+				cmd.WithDir("{{.ws.Dir}}"),
+				cmd.WithWaitMatchingLine("^example.com/ws$"),
+				cmd.WithStopFn(func(c *exec.Cmd) error { return c.Wait() }),
+			),
+		),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+}
+
+func TestWorkspace_Snapshot(t *testing.T) {
+	snapshot := filepath.Join(t.TempDir(), "snapshot")
+	w := workspace.New(
+		workspace.WithFile("a.txt", "a", 0o600),
+		workspace.WithSnapshot(snapshot),
+	)
+	deptest.ErrorIs(t, w, func() {
+		require.NoError(t, os.WriteFile(w.Path("out.txt"), []byte("out"), 0o600))
+	}, nil)
+
+	golden := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(golden, "a.txt"), []byte("a"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(golden, "out.txt"), []byte("out"), 0o600))
+	require.NoError(t, workspace.Compare(golden, snapshot))
+
+	require.NoError(t, os.WriteFile(filepath.Join(golden, "a.txt"), []byte("b"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(golden, "missing.txt"), nil, 0o600))
+	require.NoError(t, os.Remove(filepath.Join(golden, "out.txt")))
+	err := workspace.Compare(golden, snapshot)
+	require.ErrorIs(t, err, workspace.ErrMismatch)
+	assert.EqualError(t, err, "directory trees differ: differs a.txt, missing missing.txt, unexpected out.txt")
+
+	// The second run doesn't write out.txt, which mustn't be left over in the snapshot.
+	deptest.ErrorIs(t, w, func() {}, nil)
+	assert.NoFileExists(t, filepath.Join(snapshot, "out.txt"))
+	assert.FileExists(t, filepath.Join(snapshot, "a.txt"))
+}
+
+func TestWorkspace_CollectArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	w := workspace.New(workspace.WithFile("logs/app.log", "log", 0o600))
+	deptest.ErrorIs(t, w, func() {
+		require.NoError(t, w.CollectArtifacts(dir))
+	}, nil)
+	assertFile(t, filepath.Join(dir, "logs", "app.log"), "log", 0o600)
+}
+
+func assertFile(t *testing.T, name, content string, perm os.FileMode) {
+	t.Helper()
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(b))
+	if perm != 0 {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, perm, info.Mode().Perm())
+	}
+}
@@ -0,0 +1,76 @@
+// Package expand resolves placeholders that refer to the outputs published by other dependencies.
+//
+// Both {{.name.Key}} and ${name.Key} syntaxes are supported, where name is the name of the dependency
+// and Key is the name of the output, for example {{.postgres.Port}} or ${api.URL}.
+package expand
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const ErrUnresolved = strerr.Error("unresolved placeholders")
+
+// Values contains the outputs of dependencies by dependency name and output key.
+type Values map[string]map[string]string
+
+var placeholder = regexp.MustCompile(`\{\{\s*\.([^\s{}]+)\.(\w+)\s*\}\}|\$\{([^\s{}]+)\.(\w+)\}`)
+
+// String replaces the placeholders in s with values.
+// All unresolved placeholders are listed in the returned error.
+func String(s string, values Values) (string, error) {
+	var unresolved []string
+	out := values.replace(s, &unresolved)
+	if len(unresolved) > 0 {
+		return "", unresolvedErr(unresolved)
+	}
+	return out, nil
+}
+
+// Strings replaces the placeholders in each of ss with values.
+// All unresolved placeholders are listed in the returned error.
+func Strings(ss []string, values Values) ([]string, error) {
+	if ss == nil {
+		return nil, nil
+	}
+
+	var unresolved []string
+	out := make([]string, 0, len(ss))
+	for _, s := range ss {
+		out = append(out, values.replace(s, &unresolved))
+	}
+	if len(unresolved) > 0 {
+		return nil, unresolvedErr(unresolved)
+	}
+	return out, nil
+}
+
+// Has reports whether s contains any placeholders.
+func Has(s string) bool {
+	return placeholder.MatchString(s)
+}
+
+func (v Values) replace(s string, unresolved *[]string) string {
+	return placeholder.ReplaceAllStringFunc(s, func(m string) string {
+		sub := placeholder.FindStringSubmatch(m)
+		name, key := sub[1], sub[2]
+		if name == "" {
+			name, key = sub[3], sub[4]
+		}
+		val, ok := v[name][key]
+		if !ok {
+			*unresolved = append(*unresolved, m)
+			return m
+		}
+		return val
+	})
+}
+
+func unresolvedErr(unresolved []string) error {
+	slices.Sort(unresolved)
+	return fmt.Errorf("%w: %s", ErrUnresolved, strings.Join(slices.Compact(unresolved), ", "))
+}
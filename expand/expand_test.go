@@ -0,0 +1,87 @@
+package expand_test
+
+import (
+	"testing"
+
+	"github.com/go-tstr/tstr/expand"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var values = expand.Values{
+	"postgres":           {"Port": "5432", "Host": "localhost"},
+	"api":                {"URL": "http://localhost:8080"},
+	"postgres:16-alpine": {"Port": "15432"},
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		err      string
+	}{
+		{
+			name:     "NoPlaceholders",
+			input:    "--listen=:8080",
+			expected: "--listen=:8080",
+		},
+		{
+			name:     "GoTemplate",
+			input:    "--db={{.postgres.Host}}:{{ .postgres.Port }}",
+			expected: "--db=localhost:5432",
+		},
+		{
+			name:     "Dollar",
+			input:    "API_URL=${api.URL}/v1",
+			expected: "API_URL=http://localhost:8080/v1",
+		},
+		{
+			name:     "NameWithDots",
+			input:    "${postgres:16-alpine.Port}",
+			expected: "15432",
+		},
+		{
+			name:     "EnvVariableIsKept",
+			input:    "${HOME}/{{.Name}}",
+			expected: "${HOME}/{{.Name}}",
+		},
+		{
+			name:  "Unresolved",
+			input: "{{.redis.Port}} ${api.Token} ${api.URL} {{.redis.Port}}",
+			err:   "unresolved placeholders: ${api.Token}, {{.redis.Port}}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expand.String(tt.input, values)
+			if tt.err != "" {
+				require.ErrorIs(t, err, expand.ErrUnresolved)
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestStrings(t *testing.T) {
+	got, err := expand.Strings([]string{"{{.postgres.Port}}", "${api.URL}"}, values)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5432", "http://localhost:8080"}, got)
+
+	got, err = expand.Strings(nil, values)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	_, err = expand.Strings([]string{"{{.a.B}}", "${c.D}"}, nil)
+	assert.EqualError(t, err, "unresolved placeholders: ${c.D}, {{.a.B}}")
+}
+
+func TestHas(t *testing.T) {
+	assert.True(t, expand.Has("{{.a.B}}"))
+	assert.True(t, expand.Has("${a.B}"))
+	assert.False(t, expand.Has("${HOME}"))
+}
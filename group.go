@@ -0,0 +1,168 @@
+package tstr
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Group returns a named dependency composed of the given dependencies.
+// The dependencies are started and stopped like with Sequence.
+func Group(name string, deps ...Dependency) Dependency {
+	return &composite{name: name, deps: deps}
+}
+
+// Sequence returns a dependency composed of the given dependencies.
+// Start starts the dependencies in the given order and waits each of them to be ready before starting the next one.
+// If any of them fails to start or become ready, the rest of the dependencies are not started.
+// Stop stops the started dependencies in reverse order, including the one that failed.
+// Errors from the dependencies are returned as *DependencyError identifying the failed child.
+func Sequence(deps ...Dependency) Dependency {
+	return &composite{deps: deps}
+}
+
+// Parallel returns a dependency composed of the given dependencies.
+// Start starts all the dependencies concurrently and Ready waits concurrently for all of them to be ready.
+// Stop stops all the started dependencies concurrently.
+// Errors from the dependencies are joined and returned as *DependencyError identifying the failed children.
+func Parallel(deps ...Dependency) Dependency {
+	return &composite{deps: deps, parallel: true}
+}
+
+type composite struct {
+	name     string
+	deps     []Dependency
+	parallel bool
+	started  int
+	outputs  map[string]map[string]string
+}
+
+// Name returns the name given to Group or a name listing the names of the children.
+func (c *composite) Name() string {
+	if c.name != "" {
+		return c.name
+	}
+	names := make([]string, 0, len(c.deps))
+	for _, d := range c.deps {
+		names = append(names, dependencyName(d))
+	}
+	kind := "sequence"
+	if c.parallel {
+		kind = "parallel"
+	}
+	return kind + "(" + strings.Join(names, ", ") + ")"
+}
+
+// Dependencies returns the children of the composite.
+func (c *composite) Dependencies() []Dependency {
+	return c.deps
+}
+
+func (c *composite) Start() error {
+	if c.parallel {
+		c.started = len(c.deps)
+		for _, d := range c.deps {
+			propagateOutputs(d, c.outputs)
+		}
+		return all(c.deps, PhaseStart, Dependency.Start)
+	}
+
+	for i, d := range c.deps {
+		c.started = i + 1
+		propagateOutputs(d, c.outputs, c.deps[:i]...)
+		if err := step(i, d, PhaseStart, d.Start); err != nil {
+			return err
+		}
+		if err := step(i, d, PhaseReady, d.Ready); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *composite) Ready() error {
+	if c.parallel {
+		return all(c.deps, PhaseReady, Dependency.Ready)
+	}
+	return nil
+}
+
+func (c *composite) Stop() error {
+	started := c.deps[:c.started]
+	c.started = 0
+	if c.parallel {
+		return all(started, PhaseStop, Dependency.Stop)
+	}
+
+	var err error
+	for i := len(started) - 1; i >= 0; i-- {
+		err = errors.Join(err, step(i, started[i], PhaseStop, started[i].Stop))
+	}
+	return err
+}
+
+// SetOutputs stores the outputs which are passed to the children implementing OutputsReceiver.
+// In addition, children of Sequence and Group receive the outputs of the children started before them.
+func (c *composite) SetOutputs(outputs map[string]map[string]string) {
+	c.outputs = outputs
+}
+
+// SetTraceContext passes the trace context to the children implementing TraceContextReceiver.
+func (c *composite) SetTraceContext(carrier map[string]string) {
+	for _, d := range c.deps {
+		if r, ok := d.(TraceContextReceiver); ok {
+			r.SetTraceContext(carrier)
+		}
+	}
+}
+
+// CollectArtifacts collects the artifacts of the started children implementing ArtifactCollector
+// into <index>-<dependency> sub directories.
+func (c *composite) CollectArtifacts(dir string) error {
+	var err error
+	for i, d := range c.deps[:c.started] {
+		ac, ok := d.(ArtifactCollector)
+		if !ok {
+			continue
+		}
+		sub := filepath.Join(dir, fmt.Sprintf("%02d-%s", i, sanitizeName(dependencyName(d))))
+		if dErr := os.MkdirAll(sub, 0o750); dErr != nil {
+			err = errors.Join(err, dErr)
+			continue
+		}
+		err = errors.Join(err, ac.CollectArtifacts(sub))
+	}
+	return err
+}
+
+// all runs fn concurrently for all deps and joins the errors.
+func all(deps []Dependency, phase Phase, fn func(Dependency) error) error {
+	errs := make([]error, len(deps))
+	var wg sync.WaitGroup
+	for i, d := range deps {
+		wg.Go(func() {
+			errs[i] = step(i, d, phase, func() error { return fn(d) })
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// step runs fn and wraps the returned error into DependencyError.
+func step(i int, d Dependency, phase Phase, fn func() error) error {
+	start := time.Now()
+	if err := fn(); err != nil {
+		return &DependencyError{
+			Name:    dependencyName(d),
+			Index:   i,
+			Phase:   phase,
+			Elapsed: time.Since(start),
+			Err:     err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package tstr_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSequence(t *testing.T) {
+	rec := &recorder{}
+	d := tstr.Sequence(rec.dep("a", nil), rec.dep("b", nil), rec.dep("c", nil))
+
+	require.NoError(t, d.Start())
+	require.NoError(t, d.Ready())
+	require.NoError(t, d.Stop())
+	assert.Equal(t, []string{
+		"start a", "ready a",
+		"start b", "ready b",
+		"start c", "ready c",
+		"stop c", "stop b", "stop a",
+	}, rec.calls)
+}
+
+func TestSequence_PartialStop(t *testing.T) {
+	failErr := errors.New("ready failed")
+	rec := &recorder{}
+	d := tstr.Sequence(rec.dep("a", nil), rec.dep("b", failErr), rec.dep("c", nil))
+
+	err := d.Start()
+	require.ErrorIs(t, err, failErr)
+
+	var depErr *tstr.DependencyError
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "b", depErr.Name)
+	assert.Equal(t, 1, depErr.Index)
+	assert.Equal(t, tstr.PhaseReady, depErr.Phase)
+
+	require.NoError(t, d.Stop())
+	assert.Equal(t, []string{
+		"start a", "ready a",
+		"start b", "ready b",
+		"stop b", "stop a",
+	}, rec.calls)
+}
+
+func TestParallel(t *testing.T) {
+	const n = 3
+	var wg sync.WaitGroup
+	wg.Add(n)
+	started := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(started)
+	}()
+
+	deps := make([]tstr.Dependency, 0, n)
+	for range n {
+		deps = append(deps, depfn.New(
+			func() error {
+				// Each dependency blocks until all of them have been started.
+				wg.Done()
+				select {
+				case <-started:
+					return nil
+				case <-time.After(5 * time.Second):
+					return errors.New("dependencies were not started concurrently")
+				}
+			},
+			nil,
+			nil,
+		))
+	}
+
+	d := tstr.Parallel(deps...)
+	require.NoError(t, d.Start())
+	require.NoError(t, d.Ready())
+	require.NoError(t, d.Stop())
+}
+
+func TestParallel_Errors(t *testing.T) {
+	var (
+		errA = errors.New("a failed")
+		errC = errors.New("c failed")
+	)
+	rec := &recorder{}
+	d := tstr.Parallel(rec.dep("a", errA), rec.dep("b", nil), rec.dep("c", errC))
+
+	require.NoError(t, d.Start())
+	err := d.Ready()
+	require.ErrorIs(t, err, errA)
+	require.ErrorIs(t, err, errC)
+	assert.Contains(t, err.Error(), "dependency 0 (a) failed in ready phase")
+	assert.Contains(t, err.Error(), "dependency 2 (c) failed in ready phase")
+
+	require.NoError(t, d.Stop())
+	assert.ElementsMatch(t, []string{
+		"start a", "start b", "start c",
+		"ready a", "ready b", "ready c",
+		"stop a", "stop b", "stop c",
+	}, rec.calls)
+}
+
+func TestGroup(t *testing.T) {
+	failErr := errors.New("start failed")
+	rec := &recorder{}
+	group := tstr.Group("backend", rec.dep("db", nil), tstr.Parallel(rec.dep("api", nil), &namedDep{
+		DepFn: depfn.New(func() error { return failErr }, nil, nil),
+		name:  "worker",
+	}))
+
+	err := tstr.Run(
+		tstr.WithDeps(group),
+		tstr.WithFn(func() {}),
+	)
+	require.ErrorIs(t, err, failErr)
+
+	var depErr *tstr.DependencyError
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "backend", depErr.Name)
+	require.ErrorAs(t, depErr.Err, &depErr)
+	assert.Equal(t, "parallel(api, worker)", depErr.Name)
+	require.ErrorAs(t, depErr.Err, &depErr)
+	assert.Equal(t, "worker", depErr.Name)
+	assert.Equal(t, tstr.PhaseStart, depErr.Phase)
+
+	assert.Equal(t, []string{"start db", "ready db", "start api", "stop api", "stop db"}, rec.calls)
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+// dep returns a named dependency which records its calls and fails to become ready with readyErr.
+func (r *recorder) dep(name string, readyErr error) tstr.Dependency {
+	return &namedDep{
+		DepFn: depfn.New(
+			func() error { r.record("start " + name); return nil },
+			func() error { r.record("ready " + name); return readyErr },
+			func() error { r.record("stop " + name); return nil },
+		),
+		name: name,
+	}
+}
@@ -0,0 +1,143 @@
+package tstr
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const ErrLazyStopped = strerr.Error("lazy dependency has been stopped")
+
+// LazyDependency is a dependency which is started only when it's accessed for the first time.
+type LazyDependency[T Dependency] struct {
+	dep     T
+	mu      sync.Mutex
+	started bool
+	stopped bool
+	err     error
+}
+
+// Lazy wraps d so that it's started on the first call to Get instead of when the Runner starts the dependencies.
+// The started dependency is shared between all the subsequent callers of Get
+// and it's stopped by the Runner at the end only if it was actually started.
+//
+// Example:
+//
+//	var minio = tstr.Lazy(container.New(container.WithModule(minio.Run, "minio/minio:latest")))
+//
+//	func TestMain(m *testing.M) {
+//		tstr.RunMain(m, tstr.WithDeps(minio))
+//	}
+//
+//	func TestUpload(t *testing.T) {
+//		c := minio.Require(t)
+//		...
+//	}
+func Lazy[T Dependency](d T) *LazyDependency[T] {
+	return &LazyDependency[T]{dep: d}
+}
+
+// Get starts the dependency and waits for it to be ready if it hasn't been started yet.
+// The result of the first start is returned for all the subsequent calls until the dependency is stopped.
+// After the Runner has stopped the dependency Get returns ErrLazyStopped instead of starting it again.
+func (l *LazyDependency[T]) Get() (T, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return l.dep, fmt.Errorf("%w: %s", ErrLazyStopped, dependencyName(l.dep))
+	}
+	if !l.started {
+		l.started = true
+		l.err = step(0, l.dep, PhaseStart, l.dep.Start)
+		if l.err == nil {
+			l.err = step(0, l.dep, PhaseReady, l.dep.Ready)
+		}
+		if l.err != nil {
+			l.err = fmt.Errorf("%w: %w", ErrStartFailed, l.err)
+		}
+	}
+	return l.dep, l.err
+}
+
+// Require calls Get and stops the test with t.Fatal if the dependency fails to start.
+func (l *LazyDependency[T]) Require(t testing.TB) T {
+	t.Helper()
+	d, err := l.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// Started reports whether the dependency has been started.
+func (l *LazyDependency[T]) Started() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.started
+}
+
+// Name returns the name of the wrapped dependency.
+func (l *LazyDependency[T]) Name() string {
+	return dependencyName(l.dep)
+}
+
+// Start allows Get to start the dependency again after Stop, the dependency itself is started by Get.
+func (l *LazyDependency[T]) Start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = false
+	return nil
+}
+
+// Ready is a no-op, Get waits the dependency to be ready.
+func (l *LazyDependency[T]) Ready() error { return nil }
+
+// Stop stops the dependency if it was started. Get fails after Stop until the Runner starts the dependencies again.
+func (l *LazyDependency[T]) Stop() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	if !l.started {
+		return nil
+	}
+	l.started, l.err = false, nil
+	return l.dep.Stop()
+}
+
+// Outputs returns the outputs of the wrapped dependency if it was started and implements Publisher.
+func (l *LazyDependency[T]) Outputs() map[string]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := any(l.dep).(Publisher)
+	if !l.started || l.err != nil || !ok {
+		return nil
+	}
+	return p.Outputs()
+}
+
+// SetOutputs passes the outputs to the wrapped dependency if it implements OutputsReceiver.
+func (l *LazyDependency[T]) SetOutputs(outputs map[string]map[string]string) {
+	if r, ok := any(l.dep).(OutputsReceiver); ok {
+		r.SetOutputs(outputs)
+	}
+}
+
+// SetTraceContext passes the trace context to the wrapped dependency if it implements TraceContextReceiver.
+func (l *LazyDependency[T]) SetTraceContext(carrier map[string]string) {
+	if r, ok := any(l.dep).(TraceContextReceiver); ok {
+		r.SetTraceContext(carrier)
+	}
+}
+
+// CollectArtifacts collects the artifacts of the wrapped dependency if it was started and implements ArtifactCollector.
+func (l *LazyDependency[T]) CollectArtifacts(dir string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ac, ok := any(l.dep).(ArtifactCollector)
+	if !l.started || !ok {
+		return nil
+	}
+	return ac.CollectArtifacts(dir)
+}
@@ -0,0 +1,88 @@
+package tstr_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazy(t *testing.T) {
+	rec := &recorder{}
+	lazy := tstr.Lazy(rec.dep("minio", nil))
+
+	err := tstr.Run(
+		tstr.WithDeps(lazy),
+		tstr.WithFn(func() {
+			assert.False(t, lazy.Started())
+			assert.Empty(t, rec.calls)
+
+			var wg sync.WaitGroup
+			for range 3 {
+				wg.Go(func() {
+					d, err := lazy.Get()
+					assert.NoError(t, err)
+					assert.NotNil(t, d)
+				})
+			}
+			wg.Wait()
+			assert.True(t, lazy.Started())
+		}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"start minio", "ready minio", "stop minio"}, rec.calls)
+	assert.False(t, lazy.Started())
+
+	_, err = lazy.Get()
+	require.ErrorIs(t, err, tstr.ErrLazyStopped)
+	assert.False(t, lazy.Started())
+	assert.Equal(t, []string{"start minio", "ready minio", "stop minio"}, rec.calls)
+
+	require.NoError(t, lazy.Start())
+	_, err = lazy.Get()
+	require.NoError(t, err)
+	require.NoError(t, lazy.Stop())
+	assert.Equal(t, []string{"start minio", "ready minio", "stop minio", "start minio", "ready minio", "stop minio"}, rec.calls)
+}
+
+func TestLazy_NotAccessed(t *testing.T) {
+	rec := &recorder{}
+	err := tstr.Run(
+		tstr.WithDeps(tstr.Lazy(rec.dep("minio", nil))),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+	assert.Empty(t, rec.calls)
+}
+
+func TestLazy_Error(t *testing.T) {
+	readyErr := errors.New("not ready")
+	rec := &recorder{}
+	lazy := tstr.Lazy(rec.dep("minio", readyErr))
+
+	_, err := lazy.Get()
+	require.ErrorIs(t, err, tstr.ErrStartFailed)
+	require.ErrorIs(t, err, readyErr)
+
+	var depErr *tstr.DependencyError
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "minio", depErr.Name)
+	assert.Equal(t, tstr.PhaseReady, depErr.Phase)
+
+	_, err = lazy.Get()
+	require.ErrorIs(t, err, readyErr)
+	require.NoError(t, lazy.Stop())
+	assert.Equal(t, []string{"start minio", "ready minio", "stop minio"}, rec.calls)
+}
+
+func TestLazy_Require(t *testing.T) {
+	lazy := tstr.Lazy(depfn.New(nil, nil, nil))
+	assert.Equal(t, "depfn.DepFn", lazy.Name())
+	lazy.Require(t)
+	assert.True(t, lazy.Started())
+	require.NoError(t, lazy.Stop())
+}
@@ -0,0 +1,47 @@
+package tstr
+
+import "maps"
+
+// Publisher is implemented by dependencies that publish values, such as addresses and ports, for other dependencies.
+// The outputs are published under the name of the dependency, see Named.
+type Publisher interface {
+	Outputs() map[string]string
+}
+
+// OutputsReceiver is implemented by dependencies that use the outputs of other dependencies,
+// for example to resolve {{.name.Key}} placeholders with the expand package.
+// SetOutputs is called before Start with the outputs of the dependencies started before it,
+// keyed by dependency name and output key.
+type OutputsReceiver interface {
+	SetOutputs(outputs map[string]map[string]string)
+}
+
+// parent is implemented by dependencies composed of other dependencies.
+type parent interface {
+	Dependencies() []Dependency
+}
+
+// collectOutputs adds the outputs of deps and their children into outputs.
+// Later dependencies override the outputs of earlier dependencies with the same name.
+func collectOutputs(outputs map[string]map[string]string, deps ...Dependency) map[string]map[string]string {
+	for _, d := range deps {
+		if p, ok := d.(Publisher); ok {
+			if o := p.Outputs(); o != nil {
+				outputs[dependencyName(d)] = o
+			}
+		}
+		if p, ok := d.(parent); ok {
+			collectOutputs(outputs, p.Dependencies()...)
+		}
+	}
+	return outputs
+}
+
+// propagateOutputs passes the outputs of deps to d if it implements OutputsReceiver.
+func propagateOutputs(d Dependency, outputs map[string]map[string]string, deps ...Dependency) {
+	if r, ok := d.(OutputsReceiver); ok {
+		o := make(map[string]map[string]string, len(outputs))
+		maps.Copy(o, outputs)
+		r.SetOutputs(collectOutputs(o, deps...))
+	}
+}
@@ -0,0 +1,67 @@
+package tstr_test
+
+import (
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputs(t *testing.T) {
+	var (
+		db       = &publisherDep{name: "db", outputs: map[string]string{"Port": "5432"}}
+		api      = &publisherDep{name: "api", outputs: map[string]string{"URL": "http://localhost"}}
+		worker   = &receiverDep{}
+		migrate  = &receiverDep{}
+		frontend = &receiverDep{}
+	)
+
+	err := tstr.Run(
+		tstr.WithDeps(
+			worker,
+			db,
+			tstr.Sequence(migrate, api),
+			tstr.Lazy(&publisherDep{name: "lazy", outputs: map[string]string{"Key": "value"}}),
+			frontend,
+		),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+
+	assert.Empty(t, worker.outputs)
+	assert.Equal(t, map[string]map[string]string{
+		"db": {"Port": "5432"},
+	}, migrate.outputs)
+	assert.Equal(t, map[string]map[string]string{
+		"db":  {"Port": "5432"},
+		"api": {"URL": "http://localhost"},
+	}, frontend.outputs)
+}
+
+func TestOutputs_Lazy(t *testing.T) {
+	lazy := tstr.Lazy(&publisherDep{name: "lazy", outputs: map[string]string{"Key": "value"}})
+	assert.Nil(t, lazy.Outputs())
+	lazy.Require(t)
+	assert.Equal(t, map[string]string{"Key": "value"}, lazy.Outputs())
+	require.NoError(t, lazy.Stop())
+}
+
+type publisherDep struct {
+	depfn.DepFn
+	name    string
+	outputs map[string]string
+}
+
+func (d *publisherDep) Name() string               { return d.name }
+func (d *publisherDep) Outputs() map[string]string { return d.outputs }
+
+type receiverDep struct {
+	depfn.DepFn
+	outputs map[string]map[string]string
+}
+
+func (d *receiverDep) SetOutputs(outputs map[string]map[string]string) {
+	d.outputs = outputs
+}
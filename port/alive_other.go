@@ -0,0 +1,10 @@
+//go:build !unix
+
+package port
+
+import "time"
+
+// processAlive can't check the process on this platform so the lock is assumed to be alive until it gets old.
+func processAlive(_ int, locked time.Time) bool {
+	return time.Since(locked) < staleAfter
+}
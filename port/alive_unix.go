@@ -0,0 +1,14 @@
+//go:build unix
+
+package port
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+func processAlive(pid int, _ time.Time) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,271 @@
+// Package port provides allocation of free TCP and UDP ports for test dependencies.
+//
+// Reserved ports are held open until they are handed to the consumer with Release,
+// and lock files are used to coordinate with other test binaries running concurrently
+// so that two packages never pick the same port.
+package port
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-tstr/tstr/strerr"
+)
+
+const (
+	ErrReserve        = strerr.Error("failed to reserve port")
+	ErrLock           = strerr.Error("failed to lock port")
+	ErrUnknownNetwork = strerr.Error("unknown network")
+	ErrOptApply       = strerr.Error("failed to apply Opt")
+)
+
+// Network is the network of the port.
+type Network string
+
+const (
+	TCP Network = "tcp"
+	UDP Network = "udp"
+)
+
+// LockDirEnv is the environment variable which can be used to override the default lock directory.
+const LockDirEnv = "TSTR_PORT_LOCK_DIR"
+
+// staleAfter is the age after which a lock file is considered stale if its owner can't be checked.
+const staleAfter = time.Hour
+
+// maxAttempts is the number of ports tried before giving up.
+const maxAttempts = 100
+
+// Port is a reserved free port.
+// Port implements the tstr.Dependency interface and can be passed to tstr.WithDeps
+// so that the port is freed for other test binaries when the dependencies are stopped.
+type Port struct {
+	network Network
+	host    string
+	port    int
+	name    string
+	lockDir string
+
+	mu     sync.Mutex
+	holder io.Closer
+	lock   string
+}
+
+type Opt func(*Port) error
+
+// Reserve finds a free port on the loopback interface and holds it until Release or Close is called.
+// A lock file is created for the port so that other processes using this package won't reserve the same port
+// before Close is called.
+func Reserve(network Network, opts ...Opt) (*Port, error) {
+	p := &Port{
+		network: network,
+		host:    "127.0.0.1",
+		lockDir: os.Getenv(LockDirEnv),
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOptApply, err)
+		}
+	}
+	if p.lockDir == "" {
+		p.lockDir = filepath.Join(os.TempDir(), "tstr-ports")
+	}
+	if err := os.MkdirAll(p.lockDir, 0o750); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrLock, err)
+	}
+
+	for range maxAttempts {
+		holder, port, err := listen(network, p.host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrReserve, err)
+		}
+
+		lock := filepath.Join(p.lockDir, fmt.Sprintf("%s-%d.lock", network, port))
+		locked, err := acquireLock(lock)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("%w: %w", ErrLock, err), holder.Close())
+		}
+		if !locked {
+			// Port is reserved by another process which has already released it to its consumer.
+			if err := holder.Close(); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrReserve, err)
+			}
+			continue
+		}
+
+		p.port, p.holder, p.lock = port, holder, lock
+		return p, nil
+	}
+	return nil, fmt.Errorf("%w: no free port found after %d attempts", ErrReserve, maxAttempts)
+}
+
+// MustReserve calls Reserve and panics on error.
+// It's intended to be used when declaring dependencies, for example in TestMain.
+func MustReserve(network Network, opts ...Opt) *Port {
+	p, err := Reserve(network, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// WithName sets the name of the port, see Name.
+func WithName(name string) Opt {
+	return func(p *Port) error {
+		p.name = name
+		return nil
+	}
+}
+
+// WithLockDir overrides the directory used for lock files.
+// By default the value of TSTR_PORT_LOCK_DIR environment variable or tstr-ports directory under os.TempDir is used.
+// All the processes that need to coordinate must use the same directory.
+func WithLockDir(dir string) Opt {
+	return func(p *Port) error {
+		p.lockDir = dir
+		return nil
+	}
+}
+
+// Port returns the port number.
+func (p *Port) Port() int { return p.port }
+
+// String returns the port number as string so that it can be used in command arguments and env variables.
+func (p *Port) String() string { return strconv.Itoa(p.port) }
+
+// Host returns the host the port was reserved on.
+func (p *Port) Host() string { return p.host }
+
+// Addr returns the host:port address of the port.
+func (p *Port) Addr() string { return net.JoinHostPort(p.host, p.String()) }
+
+// Network returns the network of the port.
+func (p *Port) Network() Network { return p.network }
+
+// Name returns the name set with WithName or <network>-<port> by default.
+func (p *Port) Name() string {
+	if p.name != "" {
+		return p.name
+	}
+	return string(p.network) + "-" + p.String()
+}
+
+// Outputs returns the Port, Host and Addr of the port so that they can be referred
+// with placeholders such as {{.api.Port}}, see the expand package.
+func (p *Port) Outputs() map[string]string {
+	return map[string]string{
+		"Port": p.String(),
+		"Host": p.Host(),
+		"Addr": p.Addr(),
+	}
+}
+
+// Release closes the socket holding the port so that the consumer can bind it.
+// The lock file is kept until Close is called which keeps the other processes from reserving the same port.
+// Calling Release multiple times is safe.
+func (p *Port) Release() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.holder == nil {
+		return nil
+	}
+	err := p.holder.Close()
+	p.holder = nil
+	return err
+}
+
+// Close releases the port and removes the lock file.
+func (p *Port) Close() error {
+	err := p.Release()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.lock == "" {
+		return err
+	}
+	if rmErr := os.Remove(p.lock); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) {
+		err = errors.Join(err, rmErr)
+	}
+	p.lock = ""
+	return err
+}
+
+// Start is a no-op, the port is reserved by Reserve.
+func (p *Port) Start() error { return nil }
+
+// Ready is a no-op.
+func (p *Port) Ready() error { return nil }
+
+// Stop calls Close.
+func (p *Port) Stop() error { return p.Close() }
+
+func listen(network Network, host string) (io.Closer, int, error) {
+	addr := net.JoinHostPort(host, "0")
+	switch network {
+	case TCP:
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		return l, l.Addr().(*net.TCPAddr).Port, nil //nolint:forcetypeassert // Always *net.TCPAddr for tcp listener.
+	case UDP:
+		c, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return nil, 0, err
+		}
+		return c, c.LocalAddr().(*net.UDPAddr).Port, nil //nolint:forcetypeassert // Always *net.UDPAddr for udp conn.
+	default:
+		return nil, 0, fmt.Errorf("%w: %q", ErrUnknownNetwork, network)
+	}
+}
+
+// acquireLock creates the lock file containing the pid of the current process.
+// Stale lock files left behind by dead processes are removed.
+// It returns false if the lock is held by another live process or if it couldn't be written.
+func acquireLock(path string) (bool, error) {
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = f.WriteString(strconv.Itoa(os.Getpid()))
+			if err = errors.Join(err, f.Close()); err != nil {
+				// A lock file without the pid would look reserved to the other processes until it's stale.
+				return false, errors.Join(err, os.Remove(path))
+			}
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+		if !isStale(path) {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func isStale(path string) bool {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		// The owner might not have written its pid yet.
+		return time.Since(fi.ModTime()) > staleAfter
+	}
+	return !processAlive(pid, fi.ModTime())
+}
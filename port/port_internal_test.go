@@ -0,0 +1,46 @@
+package port
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcquireLock(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{
+			name:     "held by live process",
+			content:  strconv.Itoa(os.Getpid()),
+			expected: false,
+		},
+		{
+			name:     "held by dead process",
+			content:  strconv.Itoa(1 << 30),
+			expected: true,
+		},
+		{
+			name:     "pid not written yet",
+			content:  "",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tcp-1234.lock")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			got, err := acquireLock(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
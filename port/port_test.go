@@ -0,0 +1,116 @@
+package port_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/port"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserve_TCP(t *testing.T) {
+	p, err := port.Reserve(port.TCP, port.WithLockDir(t.TempDir()))
+	require.NoError(t, err)
+	assert.Positive(t, p.Port())
+	assert.Equal(t, strconv.Itoa(p.Port()), p.String())
+	assert.Equal(t, "127.0.0.1:"+p.String(), p.Addr())
+	assert.Equal(t, "tcp-"+p.String(), p.Name())
+
+	_, err = net.Listen("tcp", p.Addr())
+	require.Error(t, err, "port should be held until released")
+
+	require.NoError(t, p.Release())
+	l, err := net.Listen("tcp", p.Addr())
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+	require.NoError(t, p.Close())
+}
+
+func TestReserve_UDP(t *testing.T) {
+	p, err := port.Reserve(port.UDP, port.WithLockDir(t.TempDir()), port.WithName("dns"))
+	require.NoError(t, err)
+	assert.Equal(t, "dns", p.Name())
+	assert.Equal(t, port.UDP, p.Network())
+
+	_, err = net.ListenPacket("udp", p.Addr())
+	require.Error(t, err, "port should be held until released")
+
+	require.NoError(t, p.Release())
+	c, err := net.ListenPacket("udp", p.Addr())
+	require.NoError(t, err)
+	require.NoError(t, c.Close())
+	require.NoError(t, p.Close())
+}
+
+func TestReserve_UnknownNetwork(t *testing.T) {
+	_, err := port.Reserve("sctp", port.WithLockDir(t.TempDir()))
+	require.ErrorIs(t, err, port.ErrUnknownNetwork)
+}
+
+func TestReserve_LockFile(t *testing.T) {
+	dir := t.TempDir()
+	p, err := port.Reserve(port.TCP, port.WithLockDir(dir))
+	require.NoError(t, err)
+
+	lock := filepath.Join(dir, "tcp-"+p.String()+".lock")
+	b, err := os.ReadFile(lock)
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(os.Getpid()), string(b))
+
+	require.NoError(t, p.Release())
+	assert.FileExists(t, lock, "lock should be kept until closed")
+
+	require.NoError(t, p.Close())
+	assert.NoFileExists(t, lock)
+	require.NoError(t, p.Close())
+}
+
+func TestReserve_LockDirEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(port.LockDirEnv, dir)
+	p := port.MustReserve(port.TCP)
+	assert.FileExists(t, filepath.Join(dir, "tcp-"+p.String()+".lock"))
+	require.NoError(t, p.Close())
+}
+
+func TestReserve_Unique(t *testing.T) {
+	const n = 50
+	dir := t.TempDir()
+	ports := make([]*port.Port, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			p, err := port.Reserve(port.TCP, port.WithLockDir(dir))
+			assert.NoError(t, err)
+			// Release immediately so that the OS could hand the same port out again.
+			assert.NoError(t, p.Release())
+			ports[i] = p
+		})
+	}
+	wg.Wait()
+
+	seen := map[int]bool{}
+	for _, p := range ports {
+		require.NotNil(t, p)
+		assert.False(t, seen[p.Port()], "port %d reserved twice", p.Port())
+		seen[p.Port()] = true
+		require.NoError(t, p.Close())
+	}
+}
+
+func TestPort_Dependency(t *testing.T) {
+	dir := t.TempDir()
+	p := port.MustReserve(port.TCP, port.WithLockDir(dir))
+	err := tstr.Run(
+		tstr.WithDeps(p),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "tcp-"+p.String()+".lock"))
+}
@@ -0,0 +1,238 @@
+package tstr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit codes used by RunMain.
+const (
+	// ExitCodeTestsFailed is used when the tests fail without providing an exit code of their own.
+	ExitCodeTestsFailed = 1
+	// ExitCodeStartFailed is used when the options can't be applied or the dependencies fail to start.
+	ExitCodeStartFailed = 2
+	// ExitCodeTeardownFailed is used when the tests pass but stopping the dependencies or collecting artifacts fails.
+	ExitCodeTeardownFailed = 3
+)
+
+// output allows capturing RunMain output in tests.
+var output io.Writer = os.Stdout
+
+// report groups the errors returned by Tester by the stage where they happened.
+type report struct {
+	setup    []error
+	start    []error
+	tests    []error
+	teardown []error
+}
+
+func newReport(err error) report {
+	var r report
+	for _, e := range splitJoined(err) {
+		switch {
+		case errors.Is(e, ErrStartFailed):
+			r.start = append(r.start, e)
+		case errors.Is(e, ErrStopFailed), errors.Is(e, ErrCollectArtifacts):
+			r.teardown = append(r.teardown, e)
+		default:
+			r.tests = append(r.tests, e)
+		}
+	}
+	return r
+}
+
+func (r report) exitCode() int {
+	switch {
+	case len(r.setup) > 0, len(r.start) > 0:
+		return ExitCodeStartFailed
+	case len(r.tests) > 0:
+		for _, err := range r.tests {
+			var eErr ExitError
+			if errors.As(err, &eErr) {
+				return int(eErr)
+			}
+		}
+		return ExitCodeTestsFailed
+	default:
+		return ExitCodeTeardownFailed
+	}
+}
+
+// write renders the errors as an indented tree.
+func (r report) write(w io.Writer, color bool) {
+	type group struct {
+		title string
+		errs  []error
+	}
+
+	var (
+		groups []group
+		titles []string
+	)
+	for _, g := range []group{
+		{"setup failed", r.setup},
+		{"dependencies failed to start", r.start},
+		{"tests failed", r.tests},
+		{"teardown failed", r.teardown},
+	} {
+		if len(g.errs) > 0 {
+			groups = append(groups, g)
+			titles = append(titles, g.title)
+		}
+	}
+
+	p := treePrinter{w: w, color: color}
+	p.line("", p.red("tstr: "+strings.Join(titles, ", ")))
+	for i, g := range groups {
+		last := i == len(groups)-1
+		p.node("", last, p.red(g.title))
+		prefix := childPrefix("", last)
+		nodes := errorNodes(g.errs)
+		for j, n := range nodes {
+			p.tree(prefix, j == len(nodes)-1, n)
+		}
+	}
+}
+
+// errorNode is a single line in the error tree.
+type errorNode struct {
+	label    string
+	dep      bool
+	children []errorNode
+}
+
+// errorNodes converts errs into tree nodes so that each DependencyError becomes its own node
+// and the rest of the error messages become leaves.
+func errorNodes(errs []error) []errorNode {
+	var nodes []errorNode
+	for _, err := range errs {
+		depErrs := dependencyErrors(err)
+		if len(depErrs) == 0 {
+			for _, line := range strings.Split(err.Error(), "\n") {
+				nodes = append(nodes, errorNode{label: line})
+			}
+			continue
+		}
+		for _, de := range depErrs {
+			nodes = append(nodes, errorNode{
+				label:    fmt.Sprintf("%s (#%d) failed in %s phase after %s", de.Name, de.Index, de.Phase, de.Elapsed.Round(time.Millisecond)),
+				dep:      true,
+				children: errorNodes([]error{de.Err}),
+			})
+		}
+	}
+	return nodes
+}
+
+// dependencyErrors returns the outermost DependencyErrors in the tree of err.
+func dependencyErrors(err error) []*DependencyError {
+	var de *DependencyError
+	if !errors.As(err, &de) {
+		return nil
+	}
+	// errors.As stops at the first match, so the tree is walked further unless err itself is the DependencyError.
+	if _, ok := err.(*DependencyError); ok { //nolint:errorlint // Only the outermost DependencyErrors are wanted.
+		return []*DependencyError{de}
+	}
+
+	errs := []error{errors.Unwrap(err)}
+	if u, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = u.Unwrap()
+	}
+	var found []*DependencyError
+	for _, e := range errs {
+		found = append(found, dependencyErrors(e)...)
+	}
+	return found
+}
+
+// splitJoined splits errors created with errors.Join into their components.
+// Errors created with fmt.Errorf also implement Unwrap() []error when they wrap multiple errors,
+// so only errors whose message is the newline separated messages of their components are split.
+func splitJoined(err error) []error {
+	if err == nil {
+		return nil
+	}
+	u, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+
+	errs := u.Unwrap()
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	if err.Error() != strings.Join(msgs, "\n") {
+		return []error{err}
+	}
+
+	var split []error
+	for _, e := range errs {
+		split = append(split, splitJoined(e)...)
+	}
+	return split
+}
+
+type treePrinter struct {
+	w     io.Writer
+	color bool
+}
+
+func (p treePrinter) tree(prefix string, last bool, n errorNode) {
+	label := n.label
+	if n.dep {
+		label = p.bold(label)
+	}
+	p.node(prefix, last, label)
+	prefix = childPrefix(prefix, last)
+	for i, c := range n.children {
+		p.tree(prefix, i == len(n.children)-1, c)
+	}
+}
+
+func (p treePrinter) node(prefix string, last bool, label string) {
+	branch := "├─ "
+	if last {
+		branch = "└─ "
+	}
+	p.line(prefix+branch, label)
+}
+
+func (p treePrinter) line(prefix, label string) {
+	_, _ = fmt.Fprintln(p.w, prefix+label)
+}
+
+func (p treePrinter) red(s string) string  { return p.style("31;1", s) }
+func (p treePrinter) bold(s string) string { return p.style("1", s) }
+
+func (p treePrinter) style(code, s string) string {
+	if !p.color {
+		return s
+	}
+	return "\x1b[" + code + "m" + s + "\x1b[0m"
+}
+
+func childPrefix(prefix string, last bool) string {
+	if last {
+		return prefix + "   "
+	}
+	return prefix + "│  "
+}
+
+// colorEnabled reports whether w is a terminal and NO_COLOR is not set.
+func colorEnabled(w io.Writer) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
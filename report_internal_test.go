@@ -0,0 +1,79 @@
+package tstr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunMain_Output(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Opt
+		m        TestingM
+		expected string
+	}{
+		{
+			name: "start and stop failure",
+			opts: []Opt{WithDeps(
+				depfn.New(nil, nil, func() error { return errors.New("stop 0") }),
+				depfn.New(nil, nil, func() error { return errors.Join(errors.New("stop 1"), errors.New("signal: killed")) }),
+				depfn.New(nil, func() error { return errors.New("not ready") }, nil),
+			)},
+			m: MockTestingM(0),
+			expected: `tstr: dependencies failed to start, teardown failed
+├─ dependencies failed to start
+│  └─ depfn.DepFn (#2) failed in ready phase after 0s
+│     └─ not ready
+└─ teardown failed
+   ├─ depfn.DepFn (#1) failed in stop phase after 0s
+   │  ├─ stop 1
+   │  └─ signal: killed
+   └─ depfn.DepFn (#0) failed in stop phase after 0s
+      └─ stop 0
+`,
+		},
+		{
+			name: "tests failure",
+			m:    MockTestingM(1),
+			expected: `tstr: tests failed
+└─ tests failed
+   └─ exit status 1
+`,
+		},
+		{
+			name: "setup failure",
+			opts: []Opt{func(*Tester) error { return errors.New("bad option") }},
+			m:    MockTestingM(0),
+			expected: `tstr: setup failed
+└─ setup failed
+   └─ failed to apply option: bad option
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			exit = func(int) {}
+			output = buf
+			RunMain(tt.m, tt.opts...)
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestReport_Color(t *testing.T) {
+	buf := &bytes.Buffer{}
+	newReport(ExitError(1)).write(buf, true)
+	assert.Equal(t, "\x1b[31;1mtstr: tests failed\x1b[0m\n└─ \x1b[31;1mtests failed\x1b[0m\n   └─ exit status 1\n", buf.String())
+}
+
+func TestColorEnabled(t *testing.T) {
+	assert.False(t, colorEnabled(&bytes.Buffer{}))
+	t.Setenv("NO_COLOR", "1")
+	assert.False(t, colorEnabled(nil))
+}
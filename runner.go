@@ -1,10 +1,14 @@
 package tstr
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-tstr/tstr/strerr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -12,9 +16,52 @@ const (
 	ErrStopFailed  = strerr.Error("failed to stop test dependencies")
 )
 
+// Phase is a lifecycle phase of a dependency.
+type Phase string
+
+const (
+	PhaseStart Phase = "start"
+	PhaseReady Phase = "ready"
+	PhaseStop  Phase = "stop"
+)
+
+// DependencyError is returned by Runner when a dependency fails in one of its lifecycle phases.
+// Runner wraps it with ErrStartFailed or ErrStopFailed so both errors.Is and errors.As can be used to inspect the error.
+type DependencyError struct {
+	// Name is the name of the dependency, see Named.
+	Name string
+	// Index is the position of the dependency in the list given to the Runner.
+	Index int
+	// Phase is the lifecycle phase in which the dependency failed.
+	Phase Phase
+	// Elapsed is the time spent in the failed phase.
+	Elapsed time.Duration
+	// Err is the error returned by the dependency.
+	Err error
+}
+
+func (e *DependencyError) Error() string {
+	return fmt.Sprintf("dependency %d (%s) failed in %s phase after %s: %v", e.Index, e.Name, e.Phase, e.Elapsed.Round(time.Millisecond), e.Err)
+}
+
+func (e *DependencyError) Unwrap() error { return e.Err }
+
 type Runner struct {
 	runnables  []Dependency
 	stoppables []Stoppable
+	timeline   []Event
+	ctx        context.Context
+	tracer     trace.Tracer
+}
+
+// Event describes a single lifecycle step executed by the Runner.
+type Event struct {
+	Index      int           `json:"index"`
+	Dependency string        `json:"dependency"`
+	Phase      Phase         `json:"phase"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
 }
 
 // NewRunner creates a new Runner with the given dependencies.
@@ -27,6 +74,8 @@ type Runner struct {
 func NewRunner(rr ...Dependency) *Runner {
 	return &Runner{
 		runnables: rr,
+		ctx:       context.Background(),
+		tracer:    noopTracer(),
 	}
 }
 
@@ -37,10 +86,10 @@ func (t *Runner) Start() error {
 	for i := range t.runnables {
 		r := t.runnables[i]
 		t.stoppables = append(t.stoppables, r)
-		if err := r.Start(); err != nil {
+		if err := t.run(i, PhaseStart, r.Start); err != nil {
 			return fmt.Errorf("%w: %w", ErrStartFailed, err)
 		}
-		if err := r.Ready(); err != nil {
+		if err := t.run(i, PhaseReady, r.Ready); err != nil {
 			return fmt.Errorf("%w: %w", ErrStartFailed, err)
 		}
 	}
@@ -52,7 +101,7 @@ func (t *Runner) Stop() error {
 	var err error
 	for i := len(t.stoppables) - 1; i >= 0; i-- {
 		s := t.stoppables[i]
-		err = errors.Join(err, s.Stop())
+		err = errors.Join(err, t.run(i, PhaseStop, s.Stop))
 	}
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrStopFailed, err)
@@ -60,6 +109,64 @@ func (t *Runner) Stop() error {
 	return nil
 }
 
+// Timeline returns the lifecycle events recorded so far in the order they happened.
+func (t *Runner) Timeline() []Event {
+	return append([]Event(nil), t.timeline...)
+}
+
+// started returns the dependencies which Start has been called for.
+func (t *Runner) started() []Dependency {
+	return t.runnables[:len(t.stoppables)]
+}
+
+func (t *Runner) run(i int, phase Phase, fn func() error) error {
+	d := t.runnables[i]
+	e := Event{
+		Index:   i,
+		Phase:   phase,
+		Started: time.Now(),
+	}
+
+	ctx, span := t.tracer.Start(t.ctx, string(phase)+" "+dependencyName(d), trace.WithAttributes(
+		attribute.Int("tstr.dependency.index", i),
+		attribute.String("tstr.phase", string(phase)),
+	))
+	if phase == PhaseStart {
+		propagateTraceContext(ctx, d)
+		propagateOutputs(d, nil, t.runnables[:i]...)
+	}
+
+	err := fn()
+	e.Duration = time.Since(e.Started)
+	// Dependencies may apply their options, including the name, only in Start, so the name is resolved afterwards.
+	e.Dependency = dependencyName(d)
+	span.SetName(string(phase) + " " + e.Dependency)
+	span.SetAttributes(attribute.String("tstr.dependency.name", e.Dependency))
+	endSpan(span, err)
+	if err != nil {
+		e.Error = err.Error()
+		err = &DependencyError{
+			Name:    e.Dependency,
+			Index:   i,
+			Phase:   phase,
+			Elapsed: e.Duration,
+			Err:     err,
+		}
+	}
+	t.timeline = append(t.timeline, e)
+	return err
+}
+
+// dependencyName returns the name provided by Named or the type name of d.
+func dependencyName(d any) string {
+	if n, ok := d.(Named); ok {
+		if name := n.Name(); name != "" {
+			return name
+		}
+	}
+	return fmt.Sprintf("%T", d)
+}
+
 type Dependency interface {
 	Startable
 	Stoppable
@@ -73,3 +180,10 @@ type Startable interface {
 type Stoppable interface {
 	Stop() error
 }
+
+// Named is implemented by dependencies that provide a human readable name.
+// The name is used in errors, artifacts, traces and the Runner timeline.
+// Type name of the dependency is used for dependencies which don't implement Named.
+type Named interface {
+	Name() string
+}
@@ -1,9 +1,12 @@
 package tstr_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/cmd"
+	"github.com/go-tstr/tstr/dep/depfn"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -78,3 +81,93 @@ func (m *MockDep) Stop() error {
 	m.stopCh <- m.num
 	return nil
 }
+
+func TestRunnerTimeline(t *testing.T) {
+	startErr := errors.New("start failed")
+	r := tstr.NewRunner(
+		depfn.New(nil, nil, nil),
+		depfn.New(func() error { return startErr }, nil, nil),
+		depfn.New(nil, nil, nil),
+	)
+	require.ErrorIs(t, r.Start(), startErr)
+	require.NoError(t, r.Stop())
+
+	type step struct {
+		index int
+		phase tstr.Phase
+		err   string
+	}
+	timeline := r.Timeline()
+	got := make([]step, 0, len(timeline))
+	for _, e := range timeline {
+		got = append(got, step{index: e.Index, phase: e.Phase, err: e.Error})
+	}
+	assert.Equal(t, []step{
+		{index: 0, phase: tstr.PhaseStart},
+		{index: 0, phase: tstr.PhaseReady},
+		{index: 1, phase: tstr.PhaseStart, err: "start failed"},
+		{index: 1, phase: tstr.PhaseStop},
+		{index: 0, phase: tstr.PhaseStop},
+	}, got)
+}
+
+func TestRunnerDependencyError(t *testing.T) {
+	var (
+		readyErr = errors.New("ready failed")
+		stopErr  = errors.New("stop failed")
+	)
+	r := tstr.NewRunner(
+		depfn.New(nil, nil, func() error { return stopErr }),
+		&namedDep{
+			DepFn: depfn.New(nil, func() error { return readyErr }, nil),
+			name:  "postgres",
+		},
+	)
+
+	err := r.Start()
+	require.ErrorIs(t, err, tstr.ErrStartFailed)
+	require.ErrorIs(t, err, readyErr)
+
+	var depErr *tstr.DependencyError
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "postgres", depErr.Name)
+	assert.Equal(t, 1, depErr.Index)
+	assert.Equal(t, tstr.PhaseReady, depErr.Phase)
+	assert.Equal(t, readyErr, depErr.Err)
+	assert.Contains(t, err.Error(), "dependency 1 (postgres) failed in ready phase after")
+
+	err = r.Stop()
+	require.ErrorIs(t, err, tstr.ErrStopFailed)
+	require.ErrorIs(t, err, stopErr)
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "depfn.DepFn", depErr.Name)
+	assert.Equal(t, 0, depErr.Index)
+	assert.Equal(t, tstr.PhaseStop, depErr.Phase)
+}
+
+func TestRunnerDependencyError_NameSetInStart(t *testing.T) {
+	r := tstr.NewRunner(cmd.New(
+		cmd.WithName("api"),
+		cmd.WithCommand("tstr-command-that-does-not-exist"),
+	))
+
+	err := r.Start()
+	require.ErrorIs(t, err, tstr.ErrStartFailed)
+	var depErr *tstr.DependencyError
+	require.ErrorAs(t, err, &depErr)
+	assert.Equal(t, "api", depErr.Name)
+	assert.Equal(t, tstr.PhaseStart, depErr.Phase)
+	assert.Contains(t, err.Error(), "dependency 0 (api) failed in start phase")
+
+	require.NoError(t, r.Stop())
+	for _, e := range r.Timeline() {
+		assert.Equal(t, "api", e.Dependency)
+	}
+}
+
+type namedDep struct {
+	depfn.DepFn
+	name string
+}
+
+func (d *namedDep) Name() string { return d.name }
@@ -2,13 +2,19 @@
 package tstr
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/go-tstr/tstr/strerr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -49,7 +55,10 @@ func Run(opts ...Opt) error {
 
 // RunMain is a convinience wrapper around Run that can be used inside TestMain.
 // RunMain applies automatically WithM option which calls m.Run.
-// Also os.Exit is called with non-zero exit code if Run returns any error.
+// If Run returns any error, the error is printed as a tree and os.Exit is called with non-zero exit code:
+//   - ExitCodeStartFailed when the options can't be applied or the dependencies fail to start,
+//   - the exit code returned by m.Run or ExitCodeTestsFailed when the tests fail,
+//   - ExitCodeTeardownFailed when only stopping the dependencies or collecting artifacts fails.
 //
 // Example:
 //
@@ -57,25 +66,30 @@ func Run(opts ...Opt) error {
 //		tstr.RunMain(m, tstr.WithDeps(MyDependency()))
 //	}
 func RunMain(m TestingM, opts ...Opt) {
-	err := Run(append(opts, WithM(m))...)
-	if err == nil {
+	var r report
+	t := NewTester(append(opts, WithM(m))...)
+	if err := t.Init(); err != nil {
+		r.setup = []error{err}
+	} else if err := t.Run(); err != nil {
+		r = newReport(err)
+	} else {
 		return
 	}
 
-	exitCode := 1
-	var eErr ExitError
-	if errors.As(err, &eErr) {
-		exitCode = int(eErr)
-	}
-
-	fmt.Println(err)
-	exit(exitCode)
+	r.write(output, colorEnabled(output))
+	exit(r.exitCode())
 }
 
 type Tester struct {
-	opts []Opt
-	deps []Dependency
-	test func() error
+	opts          []Opt
+	deps          []Dependency
+	test          func() error
+	name          string
+	artifactsDir  string
+	artifactsMode ArtifactsMode
+	tracer        trace.Tracer
+	parentCtx     context.Context
+	ctx           context.Context
 }
 
 // NewTester creates a new Tester with the given options.
@@ -84,7 +98,9 @@ type Tester struct {
 // or if you want to reuse same Tester instance.
 func NewTester(opts ...Opt) *Tester {
 	return &Tester{
-		opts: opts,
+		opts:   opts,
+		tracer: noopTracer(),
+		ctx:    context.Background(),
 	}
 }
 
@@ -102,14 +118,34 @@ func (t *Tester) Init() error {
 }
 
 // Run starts the test dependencies, executes the test function and finally stops the dependencies.
-func (t *Tester) Run() error {
+// If artifacts are enabled they are collected before the dependencies are stopped.
+func (t *Tester) Run() (err error) {
+	ctx, span := t.tracer.Start(t.parentContext(), "tstr.Run", trace.WithAttributes(
+		attribute.String("tstr.name", t.testerName()),
+	))
+	defer func() { endSpan(span, err) }()
+	t.ctx = ctx
+
 	r := NewRunner(t.deps...)
-	if err := r.Start(); err != nil {
-		return errors.Join(err, r.Stop())
+	r.ctx, r.tracer = ctx, t.tracer
+	err = r.Start()
+	if err == nil {
+		err = t.test()
 	}
 
-	err := t.test()
-	return errors.Join(err, r.Stop())
+	a := t.artifacts()
+	artErr := a.collect(r, err != nil)
+	stopErr := r.Stop()
+	artErr = errors.Join(artErr, a.finish(r, errors.Join(err, stopErr)))
+	return errors.Join(err, stopErr, artErr)
+}
+
+// testerName returns the name set with WithName or the name of the test binary without the .test suffix.
+func (t *Tester) testerName() string {
+	if t.name != "" {
+		return t.name
+	}
+	return strings.TrimSuffix(filepath.Base(os.Args[0]), ".test")
 }
 
 func (t *Tester) setTest(fn func() error) error {
@@ -174,9 +210,14 @@ func WithTable[T any](tt TestingT, cases []T, test func(*testing.T, T)) Opt {
 		return t.setTest(func() error {
 			for _, tc := range cases {
 				name := reflect.ValueOf(&tc).Elem().FieldByName("Name").String()
-				tt.Run(name, func(t *testing.T) {
+				span := t.startSpan("case "+name, attribute.String("tstr.case", name))
+				ok := tt.Run(name, func(t *testing.T) {
 					test(t, tc)
 				})
+				if !ok {
+					span.SetStatus(codes.Error, "test case failed")
+				}
+				span.End()
 			}
 			return nil
 		})
@@ -2,6 +2,7 @@ package tstr
 
 import (
 	"errors"
+	"io"
 	"testing"
 
 	"github.com/go-tstr/tstr/dep/depfn"
@@ -31,7 +32,7 @@ func TestRunMain(t *testing.T) {
 			name:         "init failure",
 			opts:         []Opt{func(t *Tester) error { return errors.New("testing") }},
 			m:            MockTestingM(0),
-			expectedCode: 1,
+			expectedCode: ExitCodeStartFailed,
 		},
 		{
 			name: "start failure",
@@ -41,7 +42,7 @@ func TestRunMain(t *testing.T) {
 				nil,
 			))},
 			m:            MockTestingM(0),
-			expectedCode: 1,
+			expectedCode: ExitCodeStartFailed,
 		},
 		{
 			name: "ready failure",
@@ -51,7 +52,7 @@ func TestRunMain(t *testing.T) {
 				nil,
 			))},
 			m:            MockTestingM(0),
-			expectedCode: 1,
+			expectedCode: ExitCodeStartFailed,
 		},
 		{
 			name: "stop failure",
@@ -61,7 +62,17 @@ func TestRunMain(t *testing.T) {
 				func() error { return errors.New("testing") },
 			))},
 			m:            MockTestingM(0),
-			expectedCode: 1,
+			expectedCode: ExitCodeTeardownFailed,
+		},
+		{
+			name: "run and stop failure",
+			opts: []Opt{WithDeps(depfn.New(
+				nil,
+				nil,
+				func() error { return errors.New("testing") },
+			))},
+			m:            MockTestingM(4),
+			expectedCode: 4,
 		},
 	}
 
@@ -69,6 +80,7 @@ func TestRunMain(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			var gotCode int
 			exit = func(code int) { gotCode = code }
+			output = io.Discard
 			RunMain(tt.m, tt.opts...)
 			assert.Equal(t, tt.expectedCode, gotCode)
 		})
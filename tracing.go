@@ -0,0 +1,87 @@
+package tstr
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/go-tstr/tstr"
+
+// TraceContextReceiver is implemented by dependencies that pass the trace context on to the processes they start.
+// SetTraceContext is called before Start with the W3C trace context fields, such as traceparent, when tracing is enabled.
+type TraceContextReceiver interface {
+	SetTraceContext(carrier map[string]string)
+}
+
+// WithTracerProvider enables OpenTelemetry tracing using the given TracerProvider.
+// Tester.Run creates one span for the whole run with child spans for each dependency Start, Ready and Stop
+// and for each WithTable test case.
+// Dependencies implementing TraceContextReceiver receive the trace context of their start span.
+func WithTracerProvider(tp trace.TracerProvider) Opt {
+	return func(t *Tester) error {
+		t.tracer = tp.Tracer(tracerName)
+		return nil
+	}
+}
+
+// WithParentContext sets the context carrying the parent span of the tstr.Run span.
+// By default the parent is read from the TRACEPARENT and TRACESTATE environment variables,
+// so that a run started by a traced CI job or by a dependency with the trace context joins the same trace.
+func WithParentContext(ctx context.Context) Opt {
+	return func(t *Tester) error {
+		t.parentCtx = ctx
+		return nil
+	}
+}
+
+// parentContext returns the context set with WithParentContext or the trace context from the environment.
+func (t *Tester) parentContext() context.Context {
+	if t.parentCtx != nil {
+		return t.parentCtx
+	}
+	carrier := propagation.MapCarrier{}
+	for _, k := range (propagation.TraceContext{}).Fields() {
+		if v := os.Getenv(strings.ToUpper(k)); v != "" {
+			carrier[k] = v
+		}
+	}
+	return propagation.TraceContext{}.Extract(context.Background(), carrier)
+}
+
+// startSpan starts a child span of the current tester span.
+func (t *Tester) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := t.tracer.Start(t.ctx, name, trace.WithAttributes(attrs...))
+	return span
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func noopTracer() trace.Tracer {
+	return noop.NewTracerProvider().Tracer(tracerName)
+}
+
+// propagateTraceContext passes the trace context from ctx to d if it implements TraceContextReceiver.
+func propagateTraceContext(ctx context.Context, d Dependency) {
+	r, ok := d.(TraceContextReceiver)
+	if !ok {
+		return
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		r.SetTraceContext(carrier)
+	}
+}
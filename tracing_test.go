@@ -0,0 +1,147 @@
+package tstr_test
+
+import (
+	"testing"
+
+	"github.com/go-tstr/tstr"
+	"github.com/go-tstr/tstr/dep/depfn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithTracerProvider(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	err := tstr.Run(
+		tstr.WithName("tracing"),
+		tstr.WithTracerProvider(tp),
+		tstr.WithDeps(depfn.New(nil, nil, nil)),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 4)
+	root := spans[len(spans)-1]
+	assert.Equal(t, "tstr.Run", root.Name)
+	for i, name := range []string{"start depfn.DepFn", "ready depfn.DepFn", "stop depfn.DepFn"} {
+		assert.Equal(t, name, spans[i].Name)
+		assert.Equal(t, root.SpanContext.SpanID(), spans[i].Parent.SpanID())
+	}
+}
+
+func TestWithTracerProvider_Table(t *testing.T) {
+	type test struct {
+		Name string
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	err := tstr.Run(
+		tstr.WithTracerProvider(tp),
+		tstr.WithTable(t, []test{{Name: "case-1"}, {Name: "case-2"}}, func(*testing.T, test) {}),
+	)
+	require.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 3)
+	assert.Equal(t, "case case-1", spans[0].Name)
+	assert.Equal(t, "case case-2", spans[1].Name)
+	assert.Equal(t, spans[2].SpanContext.SpanID(), spans[0].Parent.SpanID())
+}
+
+func TestWithTracerProvider_Error(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	err := tstr.Run(
+		tstr.WithTracerProvider(tp),
+		tstr.WithM(exitCode(1)),
+	)
+	require.Error(t, err)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+}
+
+func TestWithTracerProvider_TraceContext(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	d := &traceContextDep{}
+
+	err := tstr.Run(
+		tstr.WithTracerProvider(tp),
+		tstr.WithDeps(d),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+
+	ctx := propagation.TraceContext{}.Extract(t.Context(), propagation.MapCarrier(d.carrier))
+	sc := trace.SpanContextFromContext(ctx)
+	require.True(t, sc.IsValid())
+
+	spans := exporter.GetSpans()
+	require.NotEmpty(t, spans)
+	assert.Equal(t, "start *tstr_test.traceContextDep", spans[0].Name)
+	assert.Equal(t, spans[0].SpanContext.TraceID(), sc.TraceID())
+	assert.Equal(t, spans[0].SpanContext.SpanID(), sc.SpanID())
+}
+
+func TestWithTracerProvider_Parent(t *testing.T) {
+	const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	parent := trace.SpanContextFromContext(
+		propagation.TraceContext{}.Extract(t.Context(), propagation.MapCarrier{"traceparent": traceparent}),
+	)
+	require.True(t, parent.IsValid())
+
+	tests := []struct {
+		name string
+		env  string
+		opts []tstr.Opt
+	}{
+		{name: "env", env: traceparent},
+		{name: "context", opts: []tstr.Opt{tstr.WithParentContext(trace.ContextWithRemoteSpanContext(t.Context(), parent))}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRACEPARENT", tt.env)
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+			err := tstr.Run(append(tt.opts, tstr.WithTracerProvider(tp), tstr.WithFn(func() {}))...)
+			require.NoError(t, err)
+
+			spans := exporter.GetSpans()
+			require.Len(t, spans, 1)
+			assert.Equal(t, parent.TraceID(), spans[0].SpanContext.TraceID())
+			assert.Equal(t, parent.SpanID(), spans[0].Parent.SpanID())
+		})
+	}
+}
+
+func TestWithoutTracerProvider_TraceContext(t *testing.T) {
+	d := &traceContextDep{}
+	err := tstr.Run(
+		tstr.WithDeps(d),
+		tstr.WithFn(func() {}),
+	)
+	require.NoError(t, err)
+	assert.Nil(t, d.carrier)
+}
+
+type traceContextDep struct {
+	depfn.DepFn
+	carrier map[string]string
+}
+
+func (d *traceContextDep) SetTraceContext(carrier map[string]string) {
+	d.carrier = carrier
+}